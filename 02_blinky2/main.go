@@ -5,6 +5,7 @@ import (
 	"machine"
 	"time"
 
+	"github.com/tinygo-keeb/workshop/ledcolor"
 	pio "github.com/tinygo-org/pio/rp2-pio"
 	"github.com/tinygo-org/pio/rp2-pio/piolib"
 )
@@ -34,24 +35,20 @@ func (ws *WS2812B) WriteRaw(rawGRB []uint32) error {
 func main() {
 	ws := NewWS2812B(machine.GPIO1)
 
-	colors := [2][]uint32{
-		{
-			0xFFFFFFFF, 0xFF0000FF, 0x00FF00FF, 0x0000FFFF,
-			0xFFFFFFFF, 0xFF0000FF, 0x00FF00FF, 0x0000FFFF,
-			0xFFFFFFFF, 0xFF0000FF, 0x00FF00FF, 0x0000FFFF,
-		},
-		{
-			0x00000000, 0x00000000, 0x00000000, 0x00000000,
-			0x00000000, 0x00000000, 0x00000000, 0x00000000,
-			0x00000000, 0x00000000, 0x00000000, 0x00000000,
-		},
+	colors := []ledcolor.RGB{
+		ledcolor.White, ledcolor.Green, ledcolor.Red, ledcolor.Blue,
+		ledcolor.White, ledcolor.Green, ledcolor.Red, ledcolor.Blue,
+		ledcolor.White, ledcolor.Green, ledcolor.Red, ledcolor.Blue,
 	}
+	// packs the colors as GRB and keeps the LEDs under 200mA so that full
+	// white on all 12 LEDs does not draw too much from USB
+	strip := ledcolor.NewStrip(len(colors))
 	for {
-		for i := range colors[0] {
+		for i := range colors {
 			time.Sleep(time.Millisecond * 100)
-			ws.WriteRaw(colors[0][:i+1])
+			ws.WriteRaw(strip.Render(colors[:i+1]))
 		}
 		time.Sleep(time.Millisecond * 500)
-		ws.WriteRaw(colors[1])
+		ws.WriteRaw(strip.Render(nil))
 	}
 }
@@ -5,11 +5,21 @@ import (
 	"machine/usb/adc/midi"
 	"time"
 
+	"github.com/tinygo-keeb/workshop/jukebox"
+	"github.com/tinygo-keeb/workshop/synth"
+	"github.com/tinygo-keeb/workshop/usbmidi"
 	"tinygo.org/x/drivers/encoders"
 )
 
 // Try it easily by opening the following site in Chrome.
 // https://www.onlinemusictools.com/kb/
+//
+// The notes and chords also sound on a piezo buzzer connected to the 3V3 and
+// EX01 pins, so the keyboard can be played without a PC. Chords are played by
+// switching between their notes quickly.
+//
+// | EX01 | EX03 | 3V3 | SDA0 | 3V3 | 3V3 |     |        GROVE            |
+// | EX02 | EX04 | GND | SCL0 | GND | GND | - - | GND | 3V3 | SDA0 | SCL0 |
 
 const (
 	cable    = 0
@@ -22,6 +32,14 @@ func main() {
 	btn.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
 
 	m := midi.Port()
+
+	buzzer, err := jukebox.NewSpeaker(machine.PWM7, machine.GPIO14)
+	if err != nil {
+		println("failed to configure PWM")
+		return
+	}
+	poly := synth.New(buzzer, synth.MaxVoices)
+	poly.Envelope = synth.Piano
 	colPins := []machine.Pin{
 		machine.GPIO5,
 		machine.GPIO6,
@@ -95,11 +113,15 @@ func main() {
 
 	time.Sleep(2 * time.Second)
 	pcOfs := 0x1E
-	m.Write(programChange(cable, channel, uint8(pcOfs))) // Distortion Guitar
+	pc := usbmidi.ProgramChange(cable, channel, uint8(pcOfs)) // Distortion Guitar
+	m.Write(pc[:])
 
 	prevX := uint16(0)
 	prevY := uint16(0)
 	for {
+		now := time.Now()
+		poly.Update(now)
+
 		{
 			x := ax.Get()
 			if 0x7000 <= x && x <= 0x9000 {
@@ -146,8 +168,9 @@ func main() {
 					v += 128
 				}
 				// m.ProgramChange() sends a 3-byte packet, which does not work in some environments.
-				// Here, the programChange() function created within this source code will be used instead.
-				m.Write(programChange(cable, channel, uint8(v+pcOfs)&0x7F))
+				// Here, usbmidi.ProgramChange() is used instead.
+				pc := usbmidi.ProgramChange(cable, channel, uint8(v+pcOfs)&0x7F)
+				m.Write(pc[:])
 			}
 			encOldValue = newValue
 		}
@@ -156,11 +179,13 @@ func main() {
 			if current {
 				for _, note := range chords[index].notes {
 					m.NoteOff(cable, channel, note, velocity)
+					poly.NoteOff(uint8(note), now)
 				}
 				index = (index + 1) % len(chords)
 			} else {
 				for _, note := range chords[index].notes {
 					m.NoteOn(cable, channel, note, velocity)
+					poly.NoteOn(uint8(note), velocity, now)
 				}
 			}
 			prev = current
@@ -171,9 +196,11 @@ func main() {
 			switch s {
 			case off2on:
 				m.NoteOn(cable, channel, note, velocity)
+				poly.NoteOn(uint8(note), velocity, now)
 				time.Sleep(1 * time.Millisecond)
 			case on2off:
 				m.NoteOff(cable, channel, note, velocity)
+				poly.NoteOff(uint8(note), now)
 				time.Sleep(1 * time.Millisecond)
 			}
 		}
@@ -265,10 +292,3 @@ func updateState(s State, btn bool) State {
 	}
 	return ret
 }
-
-var pbuf [4]byte
-
-func programChange(cable, channel uint8, patch uint8) []byte {
-	pbuf[0], pbuf[1], pbuf[2], pbuf[3] = ((cable&0xf)<<4)|midi.CINProgramChange, midi.MsgProgramChange|((channel-1)&0xf), patch&0x7f, 0x00
-	return pbuf[:4]
-}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"machine/usb/adc/midi"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/arp"
+	"github.com/tinygo-keeb/workshop/midiclock"
+)
+
+// アルペジエーター
+// 押しているキーの音を順番に鳴らす。テンポはドラムと同じクロックに合わせる
+// (Slave では受信した MIDI クロック、ドラム再生中はドラムのクロック、それ以外は内部クロック)
+type arpPlayer struct {
+	arp      arp.Arp
+	nextTick int // 次に処理する tick
+}
+
+var arpeggio = arpPlayer{
+	arp: arp.Arp{Mode: arp.Up, Rate: arp.Sixteenth, Octaves: 1, Gate: 50},
+}
+
+// 設定メニューで選べる値
+var (
+	arpModes = []arp.Mode{arp.Up, arp.Down, arp.UpDown, arp.Random, arp.AsPlayed}
+	arpRates = []arp.Rate{arp.Eighth, arp.Sixteenth, arp.EighthTriplet, arp.SixteenthTriplet}
+)
+
+// noteOn と noteOff は押されたキーをアルペジエーターに渡す
+func (a *arpPlayer) noteOn(n midi.Note) {
+	a.arp.NoteOn(uint8(n))
+}
+
+func (a *arpPlayer) noteOff(n midi.Note) {
+	a.arp.NoteOff(uint8(n))
+}
+
+// stop は鳴っている音を止めて押されたキーを忘れる
+func (a *arpPlayer) stop() {
+	a.arp.Stop(a.emit)
+}
+
+func (a *arpPlayer) emit(note uint8, on bool) {
+	m := midi.Port()
+	if on {
+		m.NoteOn(cable, channel, midi.Note(note), velocity)
+		loop.record(0x90|(channel-1), note, velocity)
+	} else {
+		m.NoteOff(cable, channel, midi.Note(note), 0)
+		loop.record(0x80|(channel-1), note, 0)
+	}
+}
+
+// update は 1ms 毎に呼ばれ、進んだ tick の分だけアルペジエーターを動かす
+func (a *arpPlayer) update(state *State, now time.Time) {
+	if !state.Arp {
+		return
+	}
+	pos, ok := drum.position(state, now)
+	if !ok || pos < 0 {
+		return
+	}
+	// クロックが切り替わったり巻き戻ったりした場合は合わせ直す
+	if pos < a.nextTick-midiclock.PPQN || pos > a.nextTick+midiclock.PPQN {
+		a.nextTick = pos
+	}
+	for ; a.nextTick <= pos; a.nextTick++ {
+		a.arp.Tick(a.nextTick, a.emit)
+	}
+}
+
+// colors は押されているキーを暗く、鳴っている音のキーを明るく光らせる
+func (a *arpPlayer) colors(state State, colors []uint32) []uint32 {
+	for i := range colors {
+		if state.Keys[i] || state.RxNotes[i] > 0 {
+			colors[i] = 0x080808FF
+		} else {
+			colors[i] = black
+		}
+	}
+	for _, n := range a.arp.Notes() {
+		// ラッチ中で離したキーも暗く光らせる
+		for i, note := range notes {
+			if uint8(note) == n && colors[i] == black {
+				colors[i] = 0x080808FF
+			}
+		}
+	}
+	if n, ok := a.arp.Sounding(); ok {
+		if i := keyForNote(midi.Note(n)); i >= 0 {
+			colors[i] = noteColor(midi.Note(n))
+		}
+	}
+	return colors
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"machine/usb/adc/midi"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/midiclock"
+	"github.com/tinygo-keeb/workshop/sched"
+	"github.com/tinygo-keeb/workshop/usbmidi"
+)
+
+// ClockMode はドラムパターンのテンポをどこから取るか
+type ClockMode int
+
+const (
+	ClockInternal ClockMode = iota // 内部テンポで再生 (MIDI クロックは送信しない)
+	ClockMaster                    // 内部テンポで再生し、MIDI クロックを送信する
+	ClockSlave                     // 受信した MIDI クロックに合わせて再生する
+)
+
+var clockModeNames = []string{"Internal", "Master", "Slave"}
+
+// テンポの範囲
+const (
+	minBPM = 40
+	maxBPM = 300
+)
+
+// patternBPM はパターンの StepLen (16分音符の長さ) からテンポを求める
+func patternBPM(p DrumPattern) int {
+	return 60000 / (p.StepLen * 4)
+}
+
+// タップテンポ (直近 4 回の間隔の平均)
+var tapTempo midiclock.Tap
+
+// drumPlayer はドラムパターンを MIDI クロックの tick (4分音符 = 24 tick) 単位で再生する
+// 16分音符 1 ステップは 6 tick
+type drumPlayer struct {
+	master   midiclock.Master   // Internal / Master で tick を作る
+	follower midiclock.Follower // Slave で受信したクロックを追従する
+	nextTick int                // Slave で次に処理する tick
+	free     midiclock.Master   // ドラム停止中にアルペジエーターとルーパーが使う内部クロック
+}
+
+var drum drumPlayer
+
+// ドラムの音の長さ
+const drumGate = 40 * time.Millisecond
+
+// drumOut はドラムの音を tick の予定時刻に合わせて送り、drumGate 後に止める
+// drumSound は PCM サンプルで鳴らすかどうかを持つ出力先 (drumpcm.go)
+var (
+	drumSound = &drumOutput{}
+	drumOut   = sched.New(sched.SystemClock{}, drumSound)
+)
+
+// midiOutput は sched.Output を USB MIDI に送る
+type midiOutput struct{}
+
+func (midiOutput) NoteOn(channel, note, velocity uint8) {
+	midi.Port().NoteOn(cable, channel, midi.Note(note), velocity)
+}
+
+func (midiOutput) NoteOff(channel, note, velocity uint8) {
+	midi.Port().NoteOff(cable, channel, midi.Note(note), velocity)
+}
+
+// start は再生を開始する
+// 途中から再開する場合は Master では Song Position Pointer と Continue を送る
+func (d *drumPlayer) start(state *State, now time.Time) {
+	if state.ClockMode == ClockSlave {
+		return
+	}
+	m := midi.Port()
+	pos := d.master.Position()
+	if pos == 0 {
+		d.master.Start(now)
+		if state.ClockMode == ClockMaster {
+			pkt := usbmidi.Start(cable)
+			m.Write(pkt[:])
+		}
+		return
+	}
+
+	// 直前のステップの頭から再開する
+	pos -= pos % midiclock.TicksPerStep
+	d.master.StartAt(pos, now)
+	if state.ClockMode == ClockMaster {
+		pkt := usbmidi.SongPosition(cable, uint16(pos/midiclock.TicksPerStep))
+		m.Write(pkt[:])
+		pkt = usbmidi.Continue(cable)
+		m.Write(pkt[:])
+	}
+}
+
+// stop は再生を止めて鳴っている音を消す
+func (d *drumPlayer) stop(state *State) {
+	if state.ClockMode != ClockSlave && d.master.Running() {
+		d.master.Stop()
+		if state.ClockMode == ClockMaster {
+			pkt := usbmidi.Stop(cable)
+			midi.Port().Write(pkt[:])
+		}
+	}
+	d.noteOff()
+}
+
+// rewind は次の再生をパターンの先頭から始める
+func (d *drumPlayer) rewind() {
+	d.master.Rewind()
+	d.nextTick = 0
+}
+
+// setBPM は再生中のテンポを変更する
+// すでに送った tick はそのままで、次の tick から新しい間隔になる
+func (d *drumPlayer) setBPM(bpm int) {
+	d.master.SetBPM(bpm)
+}
+
+// loadTempo は選択中のパターンのテンポとスイングにする
+func (d *drumPlayer) loadTempo(state *State) {
+	pattern := drumPatterns[state.DrumPatternIndex]
+	if state.ClockMode != ClockSlave {
+		d.setBPM(patternBPM(pattern))
+	}
+	state.Swing = pattern.Swing
+	if state.Swing < 50 {
+		state.Swing = 50
+	}
+}
+
+// bpm は現在のテンポを返す
+func (d *drumPlayer) bpm(state *State) int {
+	if state.ClockMode == ClockSlave {
+		return d.follower.BPM()
+	}
+	return d.master.BPM()
+}
+
+// receive は受信したシステムリアルタイムメッセージを処理する (Slave のみ)
+func (d *drumPlayer) receive(state *State, msg usbmidi.Message, now time.Time) {
+	if state.ClockMode != ClockSlave {
+		return
+	}
+	switch msg.Type {
+	case usbmidi.TimingClockMsg:
+		d.follower.Clock(now)
+	case usbmidi.StartMsg:
+		d.follower.Start()
+		d.nextTick = 0
+		state.DrumPlaying = true
+	case usbmidi.ContinueMsg:
+		d.follower.Continue()
+		state.DrumPlaying = true
+	case usbmidi.StopMsg:
+		d.follower.Stop()
+		d.noteOff()
+		state.DrumPlaying = false
+	case usbmidi.SongPositionMsg:
+		d.follower.SongPosition(msg.SongPosition())
+		d.nextTick = int(msg.SongPosition()) * midiclock.TicksPerStep
+	}
+}
+
+// update は 1ms 毎に呼ばれ、時間になったステップを鳴らす
+// Swing が 50 より大きいときは偶数番目のステップを遅らせる
+func (d *drumPlayer) update(state *State, now time.Time) {
+	// 時間になった音を止める
+	drumSound.pcm = state.DrumPCM
+	drumOut.Poll()
+
+	if !state.DrumPlaying {
+		return
+	}
+	pattern := drumPatterns[state.DrumPatternIndex]
+
+	if state.ClockMode == ClockSlave {
+		if !d.follower.Running() {
+			return
+		}
+		for pos := d.follower.Position(now); d.nextTick <= pos; d.nextTick++ {
+			if step, ok := midiclock.StepAt(d.nextTick, state.Swing); ok {
+				// 受信したクロックは予定時刻が分からないので今すぐ鳴らす
+				d.playStep(pattern, step, now)
+			}
+		}
+		return
+	}
+
+	for {
+		tick, ok := d.master.Next(now)
+		if !ok {
+			break
+		}
+		if state.ClockMode == ClockMaster {
+			pkt := usbmidi.TimingClock(cable)
+			midi.Port().Write(pkt[:])
+		}
+		if step, ok := midiclock.StepAt(tick, state.Swing); ok {
+			d.playStep(pattern, step, d.master.TickTime(tick))
+		}
+	}
+}
+
+// step は現在のステップ番号を返す
+func (d *drumPlayer) step(state *State) int {
+	var tick int
+	if state.ClockMode == ClockSlave {
+		tick = d.nextTick - 1
+	} else {
+		tick = d.master.Position() - 1
+	}
+	if tick < 0 {
+		return 0
+	}
+	return tick / midiclock.TicksPerStep % len(drumPatterns[state.DrumPatternIndex].Steps)
+}
+
+// playStep はステップの音を鳴らす
+// due はステップの予定時刻で、ノートオフは due から drumGate 後になる
+func (d *drumPlayer) playStep(pattern DrumPattern, step int, due time.Time) {
+	for _, note := range pattern.Steps[step%len(pattern.Steps)] {
+		drumOut.Play(due, drumCh, note, velocity, drumGate)
+	}
+}
+
+// preview はステップ編集で置いた音を 1 回鳴らす
+func (d *drumPlayer) preview(note uint8, now time.Time) {
+	drumOut.Play(now, drumCh, note, velocity, drumGate)
+}
+
+// noteOff は鳴っている音をすべて止める
+func (d *drumPlayer) noteOff() {
+	drumOut.Flush()
+}
+
+// position はアルペジエーターとルーパーが同期するクロックの現在の tick を返す
+// (Slave では受信した MIDI クロック、ドラム再生中はドラムのクロック、それ以外は内部クロック)
+func (d *drumPlayer) position(state *State, now time.Time) (int, bool) {
+	switch {
+	case state.ClockMode == ClockSlave:
+		return d.follower.Position(now), d.follower.Running()
+	case d.master.Running():
+		d.free.Stop()
+		return d.master.Position() - 1, true
+	}
+
+	if bpm := d.bpm(state); d.free.BPM() != bpm {
+		d.free.SetBPM(bpm)
+	}
+	if !d.free.Running() {
+		d.free.Start(now)
+	}
+	pos := d.free.Position() - 1
+	for {
+		tick, ok := d.free.Next(now)
+		if !ok {
+			break
+		}
+		pos = tick
+	}
+	return pos, true
+}
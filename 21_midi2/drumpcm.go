@@ -0,0 +1,69 @@
+package main
+
+// Please connect a small speaker or a piezo buzzer to the EX03 and GND pins on
+// the back terminal to hear the drums without a PC.
+//
+// | EX01 | EX03 | 3V3 | SDA0 | 3V3 | 3V3 |     |        GROVE            |
+// | EX02 | EX04 | GND | SCL0 | GND | GND | - - | GND | 3V3 | SDA0 | SCL0 |
+
+import (
+	"machine"
+
+	"github.com/tinygo-keeb/workshop/pcm"
+)
+
+// PCM サンプルでドラムを鳴らす DAC (EX03)
+// EX01 / EX02 はブザーと同じ PWM7 なので、別の PWM5 を使う
+var (
+	drumDAC   *pcm.DAC
+	drumDACOK bool
+)
+
+func initDrumDAC() {
+	var err error
+	drumDAC, err = pcm.NewDAC(machine.PWM5, machine.GPIO26)
+	drumDACOK = err == nil
+}
+
+// タムはバスドラムのサンプルを速く再生して音を高くする
+var (
+	lowTomSample  = &pcm.Sample{Name: "LowTom", Data: pcm.Kick.Data, Rate: pcm.SampleRate * 3 / 2}
+	midTomSample  = &pcm.Sample{Name: "MidTom", Data: pcm.Kick.Data, Rate: pcm.SampleRate * 2}
+	highTomSample = &pcm.Sample{Name: "HighTom", Data: pcm.Kick.Data, Rate: pcm.SampleRate * 5 / 2}
+)
+
+// ドラム音と PCM サンプルの対応 (ないものは鳴らさない)
+var drumSamples = map[uint8]*pcm.Sample{
+	BassDrum:      pcm.Kick,
+	SideStick:     pcm.Snare,
+	SnareDrum:     pcm.Snare,
+	HandClap:      pcm.Clap,
+	ElectricSnare: pcm.Snare,
+	LowFloorTom:   lowTomSample,
+	ClosedHiHat:   pcm.Hat,
+	HighFloorTom:  lowTomSample,
+	PedalHiHat:    pcm.Hat,
+	LowTom:        midTomSample,
+	OpenHiHat:     pcm.Hat,
+	LowMidTom:     midTomSample,
+	HighMidTom:    highTomSample,
+	HighTom:       highTomSample,
+	Tambourine:    pcm.Hat,
+	Maracas:       pcm.Hat,
+}
+
+// drumOutput はドラムの音を USB MIDI に送り、pcm が true なら PCM サンプルでも鳴らす
+type drumOutput struct {
+	midiOutput
+	pcm bool
+}
+
+func (o *drumOutput) NoteOn(channel, note, velocity uint8) {
+	o.midiOutput.NoteOn(channel, note, velocity)
+	if o.pcm && drumDACOK {
+		if s, ok := drumSamples[note]; ok {
+			// 2 つ重なっても割れにくい音量にする
+			drumDAC.Play(s, velocity+velocity/2)
+		}
+	}
+}
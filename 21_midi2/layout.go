@@ -0,0 +1,78 @@
+package main
+
+import (
+	"machine/usb/adc/midi"
+
+	"github.com/tinygo-keeb/workshop/keylayout"
+	"github.com/tinygo-keeb/workshop/pitch"
+	"github.com/tinygo-keeb/workshop/scale"
+)
+
+// キーへの音の割り当て
+// 下段の左から右、中段、上段の順に、選んだキーとスケールの音を 1 つずつ並べる
+//
+//	 8  9 10 11
+//	 4  5  6  7
+//	 0  1  2  3   (数字はスケールの度数)
+//
+// コードモードでは各キーがその度数の三和音 (または四和音) を鳴らす
+
+// ChordMode はキー 1 つで鳴らす音の数
+type ChordMode int
+
+const (
+	ChordOff     ChordMode = iota // 単音
+	ChordTriad                    // 三和音
+	ChordSeventh                  // 四和音 (セブンス)
+)
+
+var chordModeNames = []string{"Off", "Triad", "7th"}
+
+// 押したキーで鳴らした音 (キーを離したときに止める)
+var heldNotes [12][]midi.Note
+
+// keyDegree はキー番号に対応するスケールの度数を返す
+func keyDegree(i int) int {
+	k := keylayout.Keys[i]
+	return (keylayout.Rows-1-k.Row)*keylayout.Cols + k.Col
+}
+
+// applyLayout は選んだキーとスケールで notes を作り直す
+func applyLayout(state *State) {
+	ns := state.Layout.Notes(len(notes))
+	for i := range notes {
+		notes[i] = midi.Note(ns[keyDegree(i)])
+	}
+}
+
+// keyNotes はキー i で鳴らす音を返す
+func keyNotes(state *State, i int) []midi.Note {
+	size := 1
+	switch state.ChordMode {
+	case ChordTriad:
+		size = 3
+	case ChordSeventh:
+		size = 4
+	}
+	if size == 1 {
+		return []midi.Note{notes[i]}
+	}
+	chord := state.Layout.Chord(keyDegree(i), size)
+	ns := make([]midi.Note, len(chord))
+	for j, n := range chord {
+		ns[j] = midi.Note(n)
+	}
+	return ns
+}
+
+// keyName は押したキーの表示名を返す (コードモードではコード名)
+func keyName(state *State, i int) string {
+	if state.ChordMode != ChordOff && len(heldNotes[i]) > 1 {
+		chord := make([]uint8, len(heldNotes[i]))
+		for j, n := range heldNotes[i] {
+			chord[j] = uint8(n)
+		}
+		return scale.ChordName(chord)
+	}
+	return pitch.Note(notes[i]).Katakana()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"machine/usb/adc/midi"
+	"strconv"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/looper"
+	"github.com/tinygo-keeb/workshop/midiclock"
+	"github.com/tinygo-keeb/workshop/usbmidi"
+)
+
+// フレーズルーパー
+// キーで弾いた音とピッチベンド、モジュレーションをドラムと同じクロックの tick で録音し、繰り返し鳴らす
+// 設定メニューの LoopKey で選んだキーで操作する
+//
+//	空       → 押すと近い方の拍の頭から録音を始める
+//	録音中   → 押すと小節単位の長さで録音を終えてループ再生する
+//	再生中   → 押すと重ね録りを始める
+//	重ね録り → 押すと重ね録りを終える
+//	停止中   → 押すと拍の頭から再生する
+//
+// 1 秒長押しすると最後に録音したレイヤーを取り消す
+type loopPlayer struct {
+	looper   looper.Looper
+	quantize int       // クオンタイズ (loopQuantizeTicks の番号)
+	tick     int       // ルーパーの tick (クロックが切り替わっても途切れずに進む)
+	last     int       // 前回のクロックの位置
+	synced   bool      // last が有効かどうか
+	pressed  time.Time // ルーパーキーを押した時刻 (離しているときはゼロ)
+	dubbed   bool      // 押したときに重ね録りを始めたかどうか
+	undone   bool      // 長押しで取り消したかどうか
+}
+
+var loop loopPlayer
+
+// 長押しで取り消すまでの時間
+const loopUndoHold = 1 * time.Second
+
+// 設定メニューで選べるクオンタイズ
+var (
+	loopQuantizeNames = []string{"Off", "1/4", "1/8", "1/16", "1/8T", "1/16T"}
+	loopQuantizeTicks = []int{0, 24, 12, 6, 8, 4}
+)
+
+// setQuantize はクオンタイズを変える。再生中でも次に鳴らす音から変わる
+func (l *loopPlayer) setQuantize(i int) {
+	l.quantize = i
+	l.looper.Quantize = loopQuantizeTicks[i]
+}
+
+// beat は一番近い拍の頭の tick を返す
+func (l *loopPlayer) beat() int {
+	return (l.tick + midiclock.PPQN/2) / midiclock.PPQN * midiclock.PPQN
+}
+
+// action はルーパーキーを押したときの動作をする
+func (l *loopPlayer) action() {
+	l.dubbed = false
+	switch l.looper.State() {
+	case looper.Empty:
+		l.looper.Record(l.beat())
+	case looper.Recording, looper.Overdubbing:
+		l.looper.Play(l.tick)
+	case looper.Playing:
+		l.looper.Record(l.tick)
+		l.dubbed = true
+	case looper.Stopped:
+		l.looper.Play(l.beat())
+	}
+}
+
+// press と release はルーパーキーを押したときと離したときに呼ぶ
+func (l *loopPlayer) press(now time.Time) {
+	l.action()
+	l.pressed = now
+	l.undone = false
+}
+
+func (l *loopPlayer) release() {
+	l.pressed = time.Time{}
+}
+
+// undo は最後に録音したレイヤーを取り消す
+// 長押しの始めに重ね録りを始めていた場合は、その重ね録りも取り消す
+func (l *loopPlayer) undo() {
+	if l.dubbed && l.looper.State() == looper.Overdubbing {
+		l.looper.Undo(l.emit)
+	}
+	l.looper.Undo(l.emit)
+	l.dubbed = false
+}
+
+// stop はループを止めて鳴っている音を消す
+func (l *loopPlayer) stop() {
+	l.looper.Stop(l.tick, l.emit)
+}
+
+// clear は録音したものをすべて消す
+func (l *loopPlayer) clear() {
+	l.looper.Clear(l.emit)
+}
+
+// record は演奏した MIDI メッセージを録音する (録音中でなければ何もしない)
+func (l *loopPlayer) record(status, data1, data2 uint8) {
+	l.looper.Input(l.tick, status, data1, data2)
+}
+
+func (l *loopPlayer) emit(e looper.Event) {
+	pkt := usbmidi.ChannelMessage(cable, e.Status, e.Data1, e.Data2)
+	midi.Port().Write(pkt[:])
+}
+
+// update は 1ms 毎に呼ばれ、進んだ tick の分だけループを鳴らす
+func (l *loopPlayer) update(state *State, now time.Time) {
+	if !l.pressed.IsZero() && !l.undone && now.Sub(l.pressed) >= loopUndoHold {
+		l.undo()
+		l.undone = true
+	}
+
+	pos, ok := drum.position(state, now)
+	if !ok {
+		return
+	}
+	// クロックが切り替わったり巻き戻ったりした場合は合わせ直す
+	// 鳴らしていないときはドラムの拍に合わせ、鳴らしているときはそのまま続ける
+	if !l.synced || pos < l.last || pos > l.last+midiclock.PPQN {
+		if st := l.looper.State(); st == looper.Empty || st == looper.Stopped {
+			l.tick = pos
+		}
+		l.last = pos
+		l.synced = true
+	}
+	for ; l.last < pos; l.last++ {
+		l.tick++
+		l.looper.Tick(l.tick, l.emit)
+	}
+}
+
+// status は画面に表示するルーパーの状態を返す (空のときは "")
+func (l *loopPlayer) status() string {
+	switch st := l.looper.State(); st {
+	case looper.Empty:
+		return ""
+	case looper.Recording:
+		return st.String()
+	default:
+		return st.String() + strconv.Itoa(l.looper.Layers())
+	}
+}
+
+// colors はルーパーキーを状態に合わせて光らせる
+func (l *loopPlayer) colors(state State, colors []uint32) []uint32 {
+	if state.LoopKey == 0 {
+		return colors
+	}
+	c := uint32(black)
+	switch l.looper.State() {
+	case looper.Recording:
+		c = red
+	case looper.Overdubbing:
+		c = orange
+	case looper.Playing:
+		c = green
+	case looper.Stopped:
+		c = 0x080808FF
+	}
+	colors[state.LoopKey-1] = c
+	return colors
+}
@@ -4,8 +4,11 @@ import (
 	"image/color"
 	"machine"
 	"machine/usb/adc/midi"
+	"strconv"
 	"time"
 
+	"github.com/tinygo-keeb/workshop/scale"
+	"github.com/tinygo-keeb/workshop/usbmidi"
 	pio "github.com/tinygo-org/pio/rp2-pio"
 	"github.com/tinygo-org/pio/rp2-pio/piolib"
 	"tinygo.org/x/drivers"
@@ -21,7 +24,6 @@ const (
 	channel  = 1  // ピアノチャンネル
 	drumCh   = 10 // ドラムチャンネル
 	velocity = 0x7F
-	bpm      = 100 // リズムパターンのテンポ
 
 	BassDrum      = 36 // バスドラム
 	SideStick     = 37 // サイドスティック/リムショット
@@ -70,15 +72,24 @@ var (
 	display      *ssd1306.Device
 )
 
-// Not番号から音名のマッピング
-var noteNamesKatakana = map[midi.Note]string{
-	midi.C3: "ド3", midi.C4: "ド4", midi.C5: "ド5", midi.C6: "ド6",
-	midi.D3: "レ3", midi.D4: "レ4", midi.D5: "レ5", midi.D6: "レ6",
-	midi.E3: "ミ3", midi.E4: "ミ4", midi.E5: "ミ5", midi.E6: "ミ6",
-	midi.F3: "ファ3", midi.F4: "ファ4", midi.F5: "ファ5", midi.F6: "ファ6",
-	midi.G3: "ソ3", midi.G4: "ソ4", midi.G5: "ソ5", midi.G6: "ソ6",
-	midi.A3: "ラ3", midi.A4: "ラ4", midi.A5: "ラ5", midi.A6: "ラ6",
-	midi.B3: "シ3", midi.B4: "シ4", midi.B5: "シ5", midi.B6: "シ6",
+// ピアノ (キー番号順)
+// 選んだキーとスケールから applyLayout で作る (初期値は C4 から G5 までの C メジャー)
+var notes = make([]midi.Note, 12)
+
+// Note Colors
+var noteColors = map[midi.Note]uint32{
+	midi.C4: white,
+	midi.C5: white,
+	midi.D4: red,
+	midi.D5: red,
+	midi.E4: green,
+	midi.E5: green,
+	midi.F4: blue,
+	midi.F5: blue,
+	midi.G4: yellow,
+	midi.G5: yellow,
+	midi.A4: purple,
+	midi.B4: pink,
 }
 
 // ドラム音のマッピング
@@ -101,290 +112,17 @@ var drumNames = map[uint8]string{
 	Maracas:       "マラカス",
 }
 
-var lastNoteOnTime time.Time
-var notesToTurnOff []uint8
 var lastRedrawTime time.Time
 
+// DrumPattern は 1 小節分のドラムパターン
+// drumPatterns は patterns.drum から go generate で作る
+//
+//go:generate go run ../drumpat/cmd/drumpat gen -o patterns_gen.go patterns.drum
 type DrumPattern struct {
 	Name    string    // パターン名
 	Steps   [][]uint8 // 各ステップで鳴るドラム音のリスト
 	StepLen int       // 1ステップの長さ (ミリ秒)
-}
-
-var metronomeBeat = DrumPattern{
-	Name: "Metronome",
-	Steps: [][]uint8{
-		{SnareDrum}, // 1拍目: スネア
-		{},          // 2
-		{Claves},    // 3
-		{},          // 4
-		{Claves},    // 5
-		{},          // 6
-		{Claves},    // 7
-		{},          // 8
-		{Claves},    // 9
-		{},          // 10
-		{Claves},    // 11
-		{},          // 12
-		{Claves},    // 13
-		{},          // 14
-		{Claves},    // 15
-		{},          // 16
-	},
-	StepLen: 60000 / bpm / 4, // 16分音符の長さ
-}
-
-var basicBeat = DrumPattern{
-	Name: "8Beat",
-	Steps: [][]uint8{
-		{BassDrum, ClosedHiHat},  // 1拍目
-		{ClosedHiHat},            // 2
-		{SnareDrum, ClosedHiHat}, // 3
-		{OpenHiHat},              // 4
-		{BassDrum, ClosedHiHat},  // 5
-		{ClosedHiHat},            // 6
-		{SnareDrum, ClosedHiHat}, // 7
-		{ClosedHiHat},            // 8
-		{BassDrum, ClosedHiHat},  // 9
-		{ClosedHiHat},            // 10
-		{SnareDrum, ClosedHiHat}, // 11
-		{ClosedHiHat},            // 12
-		{BassDrum, ClosedHiHat},  // 13
-		{ClosedHiHat},            // 14
-		{SnareDrum, ClosedHiHat}, // 15
-		{CrashCymbal1},           // 16
-	},
-	StepLen: 60000 / 100 / 4,
-}
-
-var latinBeatBrazil = DrumPattern{
-	Name: "LatinBrazil",
-	Steps: [][]uint8{
-		{BassDrum, Maracas},  // 1
-		{Claves},             // 2
-		{SideStick, Maracas}, // 3
-		{Cowbell},            // 4
-
-		{BassDrum, Maracas},  // 5
-		{Claves},             // 6
-		{SideStick, Maracas}, // 7
-		{Cowbell},            // 8
-
-		{BassDrum, Maracas},  // 9
-		{Claves},             // 10
-		{SideStick, Maracas}, // 11
-		{Cowbell},            // 12
-
-		{SideStick, Maracas}, // 13
-		{Claves},             // 14
-		{Maracas, Cowbell},   // 15
-		{BassDrum, Claves},   // 16
-	},
-	StepLen: 60000 / 115 / 4,
-}
-
-var drumBassBeat1 = DrumPattern{
-	Name: "DnB 1",
-	Steps: [][]uint8{
-		{BassDrum, ClosedHiHat},  // 1
-		{ClosedHiHat},            // 2
-		{ClosedHiHat},            // 3
-		{BassDrum},               // 4
-		{SnareDrum, ClosedHiHat}, // 5
-		{ClosedHiHat},            // 6
-		{ClosedHiHat},            // 7
-		{BassDrum},               // 8
-		{ClosedHiHat},            // 9
-		{ClosedHiHat},            // 10
-		{ClosedHiHat},            // 11
-		{BassDrum},               // 12
-		{SnareDrum, ClosedHiHat}, // 13
-		{ClosedHiHat},            // 14
-		{ClosedHiHat},            // 15
-		{ClosedHiHat},            // 16
-	},
-	StepLen: 60000 / 174 / 4,
-}
-
-var drumBassBeat2 = DrumPattern{
-	Name: "DnB 2",
-	Steps: [][]uint8{
-		{BassDrum, ClosedHiHat}, // 1
-		{ClosedHiHat},           // 2
-		{ClosedHiHat},           // 3
-		{BassDrum},              // 4
-
-		{SnareDrum, ClosedHiHat}, // 5
-		{ClosedHiHat},            // 6
-		{ClosedHiHat, BassDrum},  // 7
-		{ClosedHiHat},            // 8
-
-		{BassDrum, ClosedHiHat}, // 9
-		{ClosedHiHat},           // 10
-		{SnareDrum},             // 11
-		{OpenHiHat},             // 12
-
-		{SnareDrum, ClosedHiHat}, // 13
-		{ClosedHiHat},            // 14
-		{SideStick, BassDrum},    // 15
-		{ClosedHiHat},            // 16
-	},
-	StepLen: 60000 / 176 / 4,
-}
-
-var drumBassJungle = DrumPattern{
-	Name: "DnB Jungle",
-	Steps: [][]uint8{
-		{BassDrum, ClosedHiHat, CrashCymbal1},
-		{ClosedHiHat},
-		{BassDrum, ClosedHiHat},
-		{ClosedHiHat},
-
-		{SnareDrum, ClosedHiHat},
-		{ClosedHiHat},
-		{BassDrum, ClosedHiHat},
-		{ClosedHiHat},
-
-		{BassDrum, ClosedHiHat},
-		{BassDrum, ClosedHiHat},
-		{ClosedHiHat},
-		{OpenHiHat, SideStick},
-
-		{SnareDrum, ClosedHiHat},
-		{BassDrum, ClosedHiHat},
-		{ClosedHiHat},
-		{ClosedHiHat},
-	},
-	StepLen: 60000 / 185 / 4,
-}
-
-var drumBassRollin = DrumPattern{
-	Name: "DnB Rollin",
-	Steps: [][]uint8{
-		{BassDrum, ClosedHiHat},
-		{ClosedHiHat},
-		{BassDrum},
-		{ClosedHiHat},
-		{SnareDrum, ClosedHiHat},
-		{ClosedHiHat},
-		{BassDrum, ClosedHiHat},
-		{ClosedHiHat},
-		{BassDrum, ClosedHiHat},
-		{ClosedHiHat},
-		{SnareDrum, ClosedHiHat},
-		{ClosedHiHat},
-		{BassDrum, OpenHiHat},
-		{ClosedHiHat},
-		{SideStick, ClosedHiHat},
-		{ClosedHiHat},
-	},
-	StepLen: 60000 / 180 / 4,
-}
-
-var drumBassStepJump = DrumPattern{
-	Name: "DnB StepJump",
-	Steps: [][]uint8{
-		{BassDrum, ClosedHiHat, CrashCymbal1},
-		{},
-		{ClosedHiHat},
-		{BassDrum, ClosedHiHat},
-		{},
-		{SnareDrum, OpenHiHat},
-		{BassDrum},
-		{ClosedHiHat},
-		{BassDrum},
-		{},
-		{ClosedHiHat},
-		{SnareDrum, ClosedHiHat},
-		{BassDrum},
-		{ClosedHiHat},
-		{SideStick},
-		{OpenHiHat},
-	},
-	StepLen: 60000 / 174 / 4,
-}
-
-var drumBassTechstep = DrumPattern{
-	Name: "DnB TechStep",
-	Steps: [][]uint8{
-		{BassDrum, ClosedHiHat},
-		{},
-		{ClosedHiHat},
-		{BassDrum, ClosedHiHat},
-		{SnareDrum},
-		{},
-		{BassDrum, ClosedHiHat},
-		{ClosedHiHat},
-		{BassDrum},
-		{ClosedHiHat},
-		{SnareDrum},
-		{ClosedHiHat},
-		{ClosedHiHat},
-		{},
-		{BassDrum, SideStick},
-		{ClosedHiHat},
-	},
-	StepLen: 60000 / 176 / 4,
-}
-
-var drumBassNeuro = DrumPattern{
-	Name: "DnB Neuro",
-	Steps: [][]uint8{
-		{BassDrum, ClosedHiHat, CrashCymbal1}, // 1
-		{},                                    // 2
-		{ClosedHiHat},                         // 3
-		{SnareDrum, ClosedHiHat},              // 4
-		{ClosedHiHat},                         // 5
-		{BassDrum, ClosedHiHat},               // 6
-		{ClosedHiHat},                         // 7
-		{ClosedHiHat},                         // 8
-		{BassDrum, ClosedHiHat},               // 9
-		{},                                    // 10
-		{ClosedHiHat, SnareDrum},              // 11
-		{OpenHiHat},                           // 12
-		{BassDrum, ClosedHiHat},               // 13
-		{ClosedHiHat},                         // 14
-		{SideStick, ClosedHiHat},              // 15
-		{ClosedHiHat},                         // 16
-	},
-	StepLen: 60000 / 178 / 4,
-}
-
-var drumBassLiquid = DrumPattern{
-	Name: "DnB Liquid",
-	Steps: [][]uint8{
-		{BassDrum, ClosedHiHat},  // 1
-		{ClosedHiHat},            // 2
-		{ClosedHiHat},            // 3
-		{SnareDrum, ClosedHiHat}, // 4
-		{ClosedHiHat},            // 5
-		{BassDrum, ClosedHiHat},  // 6
-		{ClosedHiHat},            // 7
-		{ClosedHiHat},            // 8
-		{BassDrum, ClosedHiHat},  // 9
-		{ClosedHiHat},            // 10
-		{SnareDrum, ClosedHiHat}, // 11
-		{ClosedHiHat},            // 12
-		{ClosedHiHat},            // 13
-		{ClosedHiHat},            // 14
-		{ClosedHiHat},            // 15
-		{ClosedHiHat},            // 16
-	},
-	StepLen: 60000 / 172 / 4,
-}
-
-var drumPatterns = []DrumPattern{
-	metronomeBeat,
-	basicBeat,
-	latinBeatBrazil,
-	drumBassBeat1,
-	drumBassBeat2,
-	drumBassJungle,
-	drumBassRollin,
-	drumBassStepJump,
-	drumBassTechstep,
-	drumBassNeuro,
-	drumBassLiquid,
+	Swing   int       // 2 ステップのうち前のステップが占める割合 (50 でスイングなし、最大 75)
 }
 
 type State struct {
@@ -397,9 +135,34 @@ type State struct {
 	RotaryLeft       bool
 	RotaryRight      bool
 	Keys             [12]bool
-	ActiveNotes      [12]string // 押されているキーに対応する音名
-	DrumPlaying      bool       // ドラムが再生中かどうか
-	DrumPatternIndex int        // 現在のドラムパターン
+	ActiveNotes      [12]string   // 押されているキーに対応する音名
+	RxNotes          [12]uint8    // 受信して鳴っているノートの数
+	BuzzerEcho       bool         // 受信したノートをブザーで鳴らすかどうか
+	DrumPCM          bool         // ドラムを PCM サンプルで鳴らすかどうか (EX03)
+	DrumPlaying      bool         // ドラムが再生中かどうか
+	DrumPatternIndex int          // 現在のドラムパターン
+	ClockMode        ClockMode    // MIDI クロックのモード
+	Mode             Mode         // 演奏 / ステップ編集 / 設定メニュー
+	MenuIndex        int          // 選択中のメニュー項目
+	EditVoice        int          // ステップ編集中のドラム音 (drumVoices の番号)
+	EditPage         int          // ステップ編集中のページ
+	EditSaved        bool         // 編集したパターンを保存済みかどうか
+	Arp              bool         // アルペジエーターを使うかどうか
+	Layout           scale.Layout // キーに割り当てるキー (調) とスケール
+	ChordMode        ChordMode    // コードモード
+	EncoderMode      EncoderMode  // 演奏モードでのロータリーエンコーダーの動作
+	Swing            int          // スイング (50 でなし、最大 75)
+	TapKey           int          // タップテンポに使うキー (キー番号 + 1、0 で使わない)
+	ZonesOn          bool         // キーボードをゾーンに分けるかどうか
+	Zones            [3]Zone      // ゾーンの設定 (zoneCount 個)
+	ZoneEdit         int          // 設定メニューで編集中のゾーン
+	ZonesSaved       bool         // ゾーン設定を保存済みかどうか
+	LoopKey          int          // ルーパーの操作に使うキー (キー番号 + 1、0 で使わない)
+}
+
+// KeyOn はキーが押されているか受信したノートで光っているかを返す
+func (s State) KeyOn(i int) bool {
+	return s.Keys[i] || s.RxNotes[i] > 0
 }
 
 // WS2812B LED
@@ -463,45 +226,19 @@ func main() {
 		c.Configure(machine.PinConfig{Mode: machine.PinInputPulldown})
 	}
 
-	// ピアノ
-	notes := []midi.Note{
-		midi.D5,
-		midi.G4,
-		midi.C4,
-
-		midi.E5,
-		midi.A4,
-		midi.D4,
-
-		midi.F5,
-		midi.B4,
-		midi.E4,
-
-		midi.G5,
-		midi.C5,
-		midi.F4,
-	}
-
-	// Note Colors
-	noteColors := map[midi.Note]uint32{
-		midi.C4: white,
-		midi.C5: white,
-		midi.D4: red,
-		midi.D5: red,
-		midi.E4: green,
-		midi.E5: green,
-		midi.F4: blue,
-		midi.F5: blue,
-		midi.G4: yellow,
-		midi.G5: yellow,
-		midi.A4: purple,
-		midi.B4: pink,
-	}
-
 	state := State{
 		DrumPlaying:      false,
 		DrumPatternIndex: 0, // 最初のドラムパターンを選択
+		EditSaved:        true,
+		Zones:            defaultZones,
+		ZonesSaved:       true,
+		Layout:           scale.Layout{Root: 0, Octave: 4, Scale: scale.Major},
 	}
+	applyLayout(&state)
+
+	// 保存済みのステップ編集したパターンとゾーン設定を読み込む
+	loadPatterns()
+	loadZones(&state)
 
 	// LED
 	colors := make([]uint32, 12)
@@ -509,6 +246,8 @@ func main() {
 		colors[i] = black
 	}
 
+	editColors := make([]uint32, 12) // ステップ編集モードとアルペジエーターの LED
+
 	ws := NewWS2812B(machine.GPIO1)
 
 	// ロータリーエンコーダーボタン
@@ -516,6 +255,11 @@ func main() {
 	rotaryButton.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
 	prevRotaryButton := rotaryButton.Get()
 
+	// ジョイスティックボタン (演奏 / ステップ編集 / 設定メニューの切り替え)
+	joystickButton := machine.GPIO0
+	joystickButton.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	prevJoystickButton := joystickButton.Get()
+
 	// ジョイスティック
 	machine.InitADC()
 
@@ -534,38 +278,83 @@ func main() {
 	})
 	encOldValue := 0
 
+	// MIDI 受信とブザー、ドラムの PCM 再生
+	initMIDIIn()
+	initBuzzer()
+	initDrumDAC()
+
 	// 初期化待ち
 	time.Sleep(1 * time.Second)
 
-	// 初期音色
-	pcOfs := 0x00 // Piano
-	m.Write(programChange(cable, channel, uint8(pcOfs)))
+	// 初期音色 (ゾーンを使わないときはピアノ)
+	sendPrograms(&state)
 
 	prevX := uint16(0)
 	prevY := uint16(0)
+	prevUp := false
+	prevDown := false
+	prevLeft := false
+	prevRight := false
+
+	// 初期テンポ
+	drum.loadTempo(&state)
+	lastEncoderTime := time.Time{}
 
 	// 初期表示
 	redraw(state)
 
-	var lastDrumTime time.Time
-	currentStep := 0
-
 	ticker := time.Tick(1 * time.Millisecond)
 	for {
 		// ジョイスティック X 軸処理
-		{
+		if state.Mode == ModePlay {
 			x := ax.Get()
 			if 0x7000 <= x && x <= 0x9000 {
 				x = 0x8000
 			}
 			if prevX != x {
 				m.PitchBend(cable, channel, x>>2)
+				loop.record(0xE0|(channel-1), uint8(x>>2&0x7F), uint8(x>>9))
 				prevX = x
 			}
 		}
 
 		// ジョイスティック Y 軸処理
-		{
+		if state.Mode == ModeMenu {
+			// 設定メニューでは上下で項目を選ぶ
+			y := ay.Get()
+			up := 0xA000 < y
+			down := y < 0x6000
+			if up && !prevUp {
+				state.MenuIndex = wrap(state.MenuIndex-1, len(menuItems))
+				redraw(state)
+			}
+			if down && !prevDown {
+				state.MenuIndex = wrap(state.MenuIndex+1, len(menuItems))
+				redraw(state)
+			}
+			prevUp, prevDown = up, down
+		} else if state.Mode == ModeStepEdit {
+			// ステップ編集では上下左右で操作する
+			x, y := ax.Get(), ay.Get()
+			up, down := 0xA000 < y, y < 0x6000
+			left, right := x < 0x6000, 0xA000 < x
+			cmd := stepCommand(-1)
+			switch {
+			case up && !prevUp:
+				cmd = stepPlay
+			case right && !prevRight:
+				cmd = stepLength
+			case left && !prevLeft:
+				cmd = stepClear
+			case down && !prevDown:
+				cmd = stepSave
+			}
+			if cmd >= 0 {
+				stepEditCommand(&state, cmd, time.Now())
+				redraw(state)
+			}
+			prevUp, prevDown, prevLeft, prevRight = up, down, left, right
+		} else if state.Mode == ModePlay {
 			y := ay.Get()
 			if 0x7000 <= y && y <= 0x9000 {
 				y = 0x8000
@@ -573,6 +362,7 @@ func main() {
 			if y >= 0x8000 {
 				if prevY != y {
 					m.ControlChange(cable, channel, midi.CCModulationWheel, byte((y-0x8000)>>8))
+					loop.record(0xB0|(channel-1), midi.CCModulationWheel, byte((y-0x8000)>>8))
 					prevY = y
 				}
 			}
@@ -581,12 +371,38 @@ func main() {
 		// ロータリーエンコーダー位置変更時の処理
 		if newValue := rotaryEncoder.Position(); newValue != encOldValue {
 			// エンコーダーの変化方向を検出
-			if newValue > encOldValue {
-				// 右回転 - ドラムパターンを次へ
-				state.DrumPatternIndex = (state.DrumPatternIndex + 1) % len(drumPatterns)
+			delta := 1
+			if newValue < encOldValue {
+				delta = -1
+			}
+			now := time.Now()
+			accel := encoderAccel(now.Sub(lastEncoderTime))
+			lastEncoderTime = now
+			if state.Mode == ModeMenu {
+				// 設定メニューでは選択中の項目の値を変更
+				item := menuItems[state.MenuIndex]
+				if item.accel {
+					delta *= accel
+				}
+				item.change(&state, delta)
+			} else if state.Mode == ModeStepEdit {
+				// ステップ編集では編集するドラム音を変更
+				state.EditVoice = wrap(state.EditVoice+delta, len(drumVoices))
+			} else if state.EncoderMode == EncoderTranspose {
+				// 半音ずつ移調
+				state.Layout = state.Layout.Transpose(delta)
+				applyLayout(&state)
+			} else if state.EncoderMode == EncoderTempo {
+				// テンポを変更
+				changeTempo(&state, delta*accel)
 			} else {
-				// 左回転 - ドラムパターンを前へ
-				state.DrumPatternIndex = (state.DrumPatternIndex - 1 + len(drumPatterns)) % len(drumPatterns)
+				// 右回転 - ドラムパターンを次へ、左回転 - ドラムパターンを前へ
+				state.DrumPatternIndex = wrap(state.DrumPatternIndex+delta, len(drumPatterns))
+				if !state.DrumPlaying {
+					// 停止中はパターンのテンポとスイングにする
+					// (再生中はそのままのテンポで次のパターンに切り替える)
+					drum.loadTempo(&state)
+				}
 			}
 
 			// ディスプレイ更新
@@ -597,73 +413,126 @@ func main() {
 
 		// ロータリーエンコーダーボタン処理
 		currentRotaryButton := rotaryButton.Get()
-		if prevRotaryButton && !currentRotaryButton {
+		if prevRotaryButton && !currentRotaryButton && state.Mode == ModeStepEdit {
+			// ステップ編集ではページを切り替える
+			state.EditPage = (state.EditPage + 1) % stepEditPages(state)
+			redraw(state)
+		} else if prevRotaryButton && !currentRotaryButton {
 			// ボタンが押された
 			state.DrumPlaying = !state.DrumPlaying
+			if state.DrumPlaying {
+				drum.start(&state, time.Now())
+			} else {
+				drum.stop(&state)
+			}
 			// ディスプレイ更新
 			redraw(state)
 		}
 		prevRotaryButton = currentRotaryButton
 
+		// ジョイスティックボタン処理
+		currentJoystickButton := joystickButton.Get()
+		if prevJoystickButton && !currentJoystickButton {
+			state.Mode = (state.Mode + 1) % modeCount
+			state.EditPage = 0
+			redraw(state)
+		}
+		prevJoystickButton = currentJoystickButton
+
+		// 受信した MIDI メッセージの処理
+		readMIDIIn(func(msg usbmidi.Message) {
+			switch {
+			case !msg.IsNoteOn() && !msg.IsNoteOff():
+				drum.receive(&state, msg, time.Now())
+			case !keyboardChannel(&state, msg.Channel):
+				// ドラム (チャンネル 10) など、キーボードのチャンネル以外のノートは表示しない
+			case msg.IsNoteOn():
+				receivedNoteOn(&state, colors, midi.Note(msg.Note()))
+			default:
+				receivedNoteOff(&state, colors, midi.Note(msg.Note()))
+			}
+		})
+
 		<-ticker
 		// ドラムパターン再生処理
-		if state.DrumPlaying && state.DrumPatternIndex >= 0 && state.DrumPatternIndex < len(drumPatterns) {
-			currentPattern := drumPatterns[state.DrumPatternIndex]
+		drum.update(&state, time.Now())
+
+		// アルペジエーター
+		arpeggio.update(&state, time.Now())
+
+		// ルーパー
+		loop.update(&state, time.Now())
 
-			// ノートオフ処理（前回の音を止める）
-			if !lastNoteOnTime.IsZero() && time.Since(lastNoteOnTime) >= 40*time.Millisecond && len(notesToTurnOff) > 0 {
-				for _, note := range notesToTurnOff {
-					m.NoteOff(cable, drumCh, midi.Note(note), 0)
+		// キーの状態更新と処理
+		for i, s := range getKeys(colPins, rowPins) {
+			// ステップ編集中はキーでステップを切り替える
+			// (演奏モードで押したままのキーは離すまでピアノとして扱う)
+			if state.Mode == ModeStepEdit && !state.Keys[i] {
+				if s == off2on {
+					stepEditKey(&state, i, time.Now())
+					redraw(state)
 				}
-				notesToTurnOff = nil // クリア
+				continue
 			}
 
-			// 次のステップを再生する時間になったか確認
-			if lastDrumTime.IsZero() || time.Since(lastDrumTime) >= time.Duration(currentPattern.StepLen)*time.Millisecond {
-				// 新しい音を鳴らす
-				notesToTurnOff = currentPattern.Steps[currentStep] // オフにする必要のあるノートを保存
-				for _, note := range notesToTurnOff {
-					m.NoteOn(cable, drumCh, midi.Note(note), velocity)
+			// タップテンポ
+			if state.TapKey == i+1 {
+				switch s {
+				case off2on:
+					if bpm, ok := tapTempo.Tap(time.Now()); ok {
+						changeTempo(&state, bpm-drum.bpm(&state))
+					}
+					colors[i] = white
+				case on2off:
+					colors[i] = black
 				}
-				lastNoteOnTime = time.Now() // ノートオン時刻を記録
+				continue
+			}
 
-				// 次のステップに進む
-				currentStep = (currentStep + 1) % len(currentPattern.Steps)
-				lastDrumTime = time.Now()
+			// ルーパー
+			if state.LoopKey == i+1 {
+				switch s {
+				case off2on:
+					loop.press(time.Now())
+				case on2off:
+					loop.release()
+				}
+				continue
 			}
-		}
 
-		// キーの状態更新と処理
-		for i, s := range getKeys(colPins, rowPins) {
-			note := notes[i]
 			switch s {
 			case off2on:
-				m.NoteOn(cable, channel, note, velocity)
-
-				// 対応する色をLEDに設定
-				if color, exists := noteColors[note]; exists {
-					colors[i] = color
+				// 離すまでに設定が変わっても同じ音を止められるように覚えておく
+				heldNotes[i] = keyNotes(&state, i)
+				if state.Arp {
+					for _, note := range heldNotes[i] {
+						arpeggio.noteOn(note)
+					}
 				} else {
-					colors[i] = white // マッピングがない場合は白色を使用
+					zoneNoteOn(&state, i, heldNotes[i])
 				}
 
-				// カタカナ音名を保存
-				if name, exists := noteNamesKatakana[note]; exists {
-					state.ActiveNotes[i] = name
-				} else {
-					state.ActiveNotes[i] = ""
-				}
+				// 対応する色をLEDに設定
+				colors[i] = noteColor(notes[i])
+
+				// カタカナ音名 (コードモードではコード名) を保存
+				state.ActiveNotes[i] = keyName(&state, i)
 
 				state.Keys[i] = true
 
 			case on2off:
-				m.NoteOff(cable, channel, note, velocity)
-
-				// LED の色をリセット
-				colors[i] = black
+				// 押している間にアルペジエーターを切り替えても音が残らないように両方止める
+				for _, note := range heldNotes[i] {
+					arpeggio.noteOff(note)
+				}
+				zoneNoteOff(i)
+				heldNotes[i] = nil
 
-				// 音名をクリア
-				state.ActiveNotes[i] = ""
+				// LED の色と音名をリセット (受信中のノートがあればそのまま)
+				if state.RxNotes[i] == 0 {
+					colors[i] = black
+					state.ActiveNotes[i] = ""
+				}
 				state.Keys[i] = false
 			}
 		}
@@ -673,7 +542,13 @@ func main() {
 		if true {
 			if lastRedrawTime.IsZero() || now.Sub(lastRedrawTime) >= 100*time.Millisecond {
 				// LED に色を反映
-				ws.WriteRaw(colors)
+				if state.Mode == ModeStepEdit {
+					ws.WriteRaw(stepEditColors(state, editColors))
+				} else if state.Arp {
+					ws.WriteRaw(loop.colors(state, arpeggio.colors(state, editColors)))
+				} else {
+					ws.WriteRaw(loop.colors(state, colors))
+				}
 
 				// 画面を更新
 				redraw(state)
@@ -684,6 +559,15 @@ func main() {
 }
 
 func redraw(state State) {
+	switch state.Mode {
+	case ModeMenu:
+		redrawMenu(state)
+		return
+	case ModeStepEdit:
+		redrawStepEdit(state)
+		return
+	}
+
 	display.ClearBuffer()
 
 	sz := int16(8)
@@ -695,11 +579,35 @@ func redraw(state State) {
 	}
 	tinyfont.WriteLine(display, &shnm.Shnmk12, 5, 12, patternName, displayWhite)
 
+	// テンポ (M: Master / S: Slave)
+	tempo := strconv.Itoa(drum.bpm(&state))
+	switch state.ClockMode {
+	case ClockMaster:
+		tempo = "M" + tempo
+	case ClockSlave:
+		tempo = "S" + tempo
+	}
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 98, 12, tempo, displayWhite)
+
 	if state.DrumPlaying {
 		tinyfont.WriteLine(display, &shnm.Shnmk12, 5, 24, "State: Playing", displayWhite)
 	} else {
 		tinyfont.WriteLine(display, &shnm.Shnmk12, 5, 24, "State: Pausing", displayWhite)
 	}
+	if state.BuzzerEcho {
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 110, 24, "♪", displayWhite)
+	}
+	if state.DrumPCM {
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 98, 24, "D", displayWhite)
+	}
+
+	// ルーパーの状態と重ねたレイヤー数
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 98, 60, loop.status(), displayWhite)
+
+	// キー (調) とスケール
+	key := scale.RootNames[state.Layout.Root] + strconv.Itoa(state.Layout.Octave)
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 48, key, displayWhite)
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 60, state.Layout.Scale.Name, displayWhite)
 
 	// キーボード表示
 	x := 128/2 - (sz+2)*2
@@ -708,10 +616,10 @@ func redraw(state State) {
 	fontKeyNameY := (sz+2)*(3+0) + sz + 8
 
 	// 1行目のキー
-	Rectangle(state.Keys[0], display, x+(sz+2)*0, (sz+2)*(3+0), sz, sz, displayWhite)
-	Rectangle(state.Keys[3], display, x+(sz+2)*1, (sz+2)*(3+0), sz, sz, displayWhite)
-	Rectangle(state.Keys[6], display, x+(sz+2)*2, (sz+2)*(3+0), sz, sz, displayWhite)
-	Rectangle(state.Keys[9], display, x+(sz+2)*3, (sz+2)*(3+0), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(0), display, x+(sz+2)*0, (sz+2)*(3+0), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(3), display, x+(sz+2)*1, (sz+2)*(3+0), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(6), display, x+(sz+2)*2, (sz+2)*(3+0), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(9), display, x+(sz+2)*3, (sz+2)*(3+0), sz, sz, displayWhite)
 
 	// 音名表示
 	if state.ActiveNotes[0] != "" {
@@ -728,10 +636,10 @@ func redraw(state State) {
 	}
 
 	// 2行目のキー
-	Rectangle(state.Keys[1], display, x+(sz+2)*0, (sz+2)*(3+1), sz, sz, displayWhite)
-	Rectangle(state.Keys[4], display, x+(sz+2)*1, (sz+2)*(3+1), sz, sz, displayWhite)
-	Rectangle(state.Keys[7], display, x+(sz+2)*2, (sz+2)*(3+1), sz, sz, displayWhite)
-	Rectangle(state.Keys[10], display, x+(sz+2)*3, (sz+2)*(3+1), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(1), display, x+(sz+2)*0, (sz+2)*(3+1), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(4), display, x+(sz+2)*1, (sz+2)*(3+1), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(7), display, x+(sz+2)*2, (sz+2)*(3+1), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(10), display, x+(sz+2)*3, (sz+2)*(3+1), sz, sz, displayWhite)
 
 	// 音名表示
 	if state.ActiveNotes[1] != "" {
@@ -748,10 +656,10 @@ func redraw(state State) {
 	}
 
 	// 3行目のキー
-	Rectangle(state.Keys[2], display, x+(sz+2)*0, (sz+2)*(3+2), sz, sz, displayWhite)
-	Rectangle(state.Keys[5], display, x+(sz+2)*1, (sz+2)*(3+2), sz, sz, displayWhite)
-	Rectangle(state.Keys[8], display, x+(sz+2)*2, (sz+2)*(3+2), sz, sz, displayWhite)
-	Rectangle(state.Keys[11], display, x+(sz+2)*3, (sz+2)*(3+2), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(2), display, x+(sz+2)*0, (sz+2)*(3+2), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(5), display, x+(sz+2)*1, (sz+2)*(3+2), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(8), display, x+(sz+2)*2, (sz+2)*(3+2), sz, sz, displayWhite)
+	Rectangle(state.KeyOn(11), display, x+(sz+2)*3, (sz+2)*(3+2), sz, sz, displayWhite)
 
 	// 音名表示
 	if state.ActiveNotes[2] != "" {
@@ -884,12 +792,3 @@ func updateState(s state, btn bool) state {
 	}
 	return ret
 }
-
-func programChange(cable, channel uint8, patch uint8) []byte {
-	var pbuf [4]byte
-	pbuf[0] = ((cable & 0xf) << 4) | midi.CINProgramChange
-	pbuf[1] = midi.MsgProgramChange | ((channel - 1) & 0x0f) // ← 1-origin に対応
-	pbuf[2] = patch & 0x7f
-	pbuf[3] = 0x00
-	return pbuf[:4]
-}
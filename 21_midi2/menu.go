@@ -0,0 +1,501 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/keylayout"
+	"github.com/tinygo-keeb/workshop/scale"
+	"tinygo.org/x/tinyfont"
+	"tinygo.org/x/tinyfont/shnm"
+)
+
+// Mode は画面と操作のモード
+// ジョイスティックボタンで 演奏 → ステップ編集 → 設定メニュー の順に切り替える
+type Mode int
+
+const (
+	ModePlay     Mode = iota // 演奏
+	ModeStepEdit             // ドラムパターンのステップ編集
+	ModeMenu                 // 設定メニュー
+
+	modeCount
+)
+
+// EncoderMode は演奏モードでロータリーエンコーダーを回したときの動作
+type EncoderMode int
+
+const (
+	EncoderPattern   EncoderMode = iota // ドラムパターンの切り替え
+	EncoderTranspose                    // 半音ずつ移調
+	EncoderTempo                        // テンポの変更 (速く回すと大きく変わる)
+)
+
+var encoderModeNames = []string{"Pattern", "Transpose", "Tempo"}
+
+// menuItem は設定メニューの 1 項目
+// ジョイスティックの上下で項目を選び、ロータリーエンコーダーで値を変更する
+type menuItem struct {
+	name   string
+	value  func(state *State) string
+	change func(state *State, delta int)
+	accel  bool // 速く回したときに delta を大きくする
+}
+
+var menuItems = []menuItem{
+	{
+		name: "Tempo",
+		value: func(state *State) string {
+			return strconv.Itoa(drum.bpm(state))
+		},
+		change: changeTempo,
+		accel:  true,
+	},
+	{
+		name: "Swing",
+		value: func(state *State) string {
+			return strconv.Itoa(state.Swing) + "%"
+		},
+		change: func(state *State, delta int) {
+			state.Swing = clamp(state.Swing+delta, 50, 75)
+		},
+	},
+	{
+		name: "TapKey",
+		value: func(state *State) string {
+			if state.TapKey == 0 {
+				return "Off"
+			}
+			return "SW" + strconv.Itoa(keylayout.Keys[state.TapKey-1].Switch)
+		},
+		change: func(state *State, delta int) {
+			state.TapKey = wrap(state.TapKey+delta, len(notes)+1)
+		},
+	},
+	{
+		name: "Clock",
+		value: func(state *State) string {
+			return clockModeNames[state.ClockMode]
+		},
+		change: func(state *State, delta int) {
+			// モードを変える前に再生を止める
+			drum.stop(state)
+			drum.rewind()
+			state.DrumPlaying = false
+			state.ClockMode = ClockMode(wrap(int(state.ClockMode)+delta, len(clockModeNames)))
+		},
+	},
+	{
+		name: "Key",
+		value: func(state *State) string {
+			return scale.RootNames[state.Layout.Root]
+		},
+		change: func(state *State, delta int) {
+			state.Layout.Root = wrap(state.Layout.Root+delta, 12)
+			applyLayout(state)
+		},
+	},
+	{
+		name: "Scale",
+		value: func(state *State) string {
+			return state.Layout.Scale.Name
+		},
+		change: func(state *State, delta int) {
+			i := 0
+			for j, sc := range scale.Scales {
+				if sc.Name == state.Layout.Scale.Name {
+					i = j
+				}
+			}
+			state.Layout.Scale = scale.Scales[wrap(i+delta, len(scale.Scales))]
+			applyLayout(state)
+		},
+	},
+	{
+		name: "Octave",
+		value: func(state *State) string {
+			return strconv.Itoa(state.Layout.Octave)
+		},
+		change: func(state *State, delta int) {
+			// 2 から 6 オクターブ
+			state.Layout.Octave = wrap(state.Layout.Octave-2+delta, 5) + 2
+			applyLayout(state)
+		},
+	},
+	{
+		name: "Chord",
+		value: func(state *State) string {
+			return chordModeNames[state.ChordMode]
+		},
+		change: func(state *State, delta int) {
+			state.ChordMode = ChordMode(wrap(int(state.ChordMode)+delta, len(chordModeNames)))
+		},
+	},
+	{
+		name: "Encoder",
+		value: func(state *State) string {
+			return encoderModeNames[state.EncoderMode]
+		},
+		change: func(state *State, delta int) {
+			state.EncoderMode = EncoderMode(wrap(int(state.EncoderMode)+delta, len(encoderModeNames)))
+		},
+	},
+	{
+		name: "Zones",
+		value: func(state *State) string {
+			return onOff(state.ZonesOn)
+		},
+		change: func(state *State, delta int) {
+			state.ZonesOn = !state.ZonesOn
+			changeZones(state)
+		},
+	},
+	{
+		// 以下の Z で始まる項目で設定するゾーン
+		name: "Zone",
+		value: func(state *State) string {
+			return strconv.Itoa(state.ZoneEdit + 1)
+		},
+		change: func(state *State, delta int) {
+			state.ZoneEdit = wrap(state.ZoneEdit+delta, zoneCount)
+		},
+	},
+	{
+		name: "Z On",
+		value: func(state *State) string {
+			return onOff(state.Zones[state.ZoneEdit].Enabled)
+		},
+		change: func(state *State, delta int) {
+			z := &state.Zones[state.ZoneEdit]
+			z.Enabled = !z.Enabled
+			changeZones(state)
+		},
+	},
+	{
+		// 範囲はスケールの度数 (下段の左が 0、上段の右が 11)
+		name: "Z Low",
+		value: func(state *State) string {
+			return strconv.Itoa(state.Zones[state.ZoneEdit].Low)
+		},
+		change: func(state *State, delta int) {
+			z := &state.Zones[state.ZoneEdit]
+			z.Low = clamp(z.Low+delta, 0, z.High)
+			changeZones(state)
+		},
+	},
+	{
+		name: "Z High",
+		value: func(state *State) string {
+			return strconv.Itoa(state.Zones[state.ZoneEdit].High)
+		},
+		change: func(state *State, delta int) {
+			z := &state.Zones[state.ZoneEdit]
+			z.High = clamp(z.High+delta, z.Low, len(notes)-1)
+			changeZones(state)
+		},
+	},
+	{
+		name: "Z Ch",
+		value: func(state *State) string {
+			return strconv.Itoa(int(state.Zones[state.ZoneEdit].Channel))
+		},
+		change: func(state *State, delta int) {
+			z := &state.Zones[state.ZoneEdit]
+			z.Channel = uint8(wrap(int(z.Channel)-1+delta, 16) + 1)
+			changeZones(state)
+		},
+	},
+	{
+		name: "Z Prog",
+		value: func(state *State) string {
+			return strconv.Itoa(int(state.Zones[state.ZoneEdit].Program))
+		},
+		change: func(state *State, delta int) {
+			z := &state.Zones[state.ZoneEdit]
+			z.Program = uint8(wrap(int(z.Program)+delta, 128))
+			changeZones(state)
+		},
+		accel: true,
+	},
+	{
+		name: "Z Oct",
+		value: func(state *State) string {
+			return strconv.Itoa(state.Zones[state.ZoneEdit].Octave)
+		},
+		change: func(state *State, delta int) {
+			z := &state.Zones[state.ZoneEdit]
+			z.Octave = clamp(z.Octave+delta, -3, 3)
+			changeZones(state)
+		},
+	},
+	{
+		name: "Z Vel",
+		value: func(state *State) string {
+			return strconv.Itoa(int(state.Zones[state.ZoneEdit].Velocity))
+		},
+		change: func(state *State, delta int) {
+			z := &state.Zones[state.ZoneEdit]
+			z.Velocity = uint8(clamp(int(z.Velocity)+delta, 1, 127))
+			changeZones(state)
+		},
+		accel: true,
+	},
+	{
+		// 回すとゾーン設定をフラッシュに保存する
+		name: "Z Save",
+		value: func(state *State) string {
+			if state.ZonesSaved {
+				return "Saved"
+			}
+			return "-"
+		},
+		change: func(state *State, delta int) {
+			if saveZones(state) == nil {
+				state.ZonesSaved = true
+			}
+		},
+	},
+	{
+		name: "Arp",
+		value: func(state *State) string {
+			if !state.Arp {
+				return "Off"
+			}
+			return arpeggio.arp.Mode.String()
+		},
+		change: func(state *State, delta int) {
+			// Off, Up, Down, UpDown, Random, Played の順に切り替える
+			i := 0
+			if state.Arp {
+				i = int(arpeggio.arp.Mode) + 1
+			}
+			i = wrap(i+delta, len(arpModes)+1)
+			if i == 0 {
+				arpeggio.stop()
+				state.Arp = false
+				return
+			}
+			state.Arp = true
+			arpeggio.arp.Mode = arpModes[i-1]
+		},
+	},
+	{
+		name: "ArpRate",
+		value: func(state *State) string {
+			return arpeggio.arp.Rate.String()
+		},
+		change: func(state *State, delta int) {
+			arpeggio.arp.Rate = arpRates[wrap(int(arpeggio.arp.Rate)+delta, len(arpRates))]
+		},
+	},
+	{
+		name: "ArpOct",
+		value: func(state *State) string {
+			return strconv.Itoa(arpeggio.arp.Octaves)
+		},
+		change: func(state *State, delta int) {
+			arpeggio.arp.Octaves = wrap(arpeggio.arp.Octaves-1+delta, 4) + 1
+		},
+	},
+	{
+		name: "ArpGate",
+		value: func(state *State) string {
+			return strconv.Itoa(arpeggio.arp.Gate) + "%"
+		},
+		change: func(state *State, delta int) {
+			arpeggio.arp.Gate = wrap(arpeggio.arp.Gate/10-1+delta, 10)*10 + 10
+		},
+	},
+	{
+		name: "Latch",
+		value: func(state *State) string {
+			return onOff(arpeggio.arp.Latch)
+		},
+		change: func(state *State, delta int) {
+			arpeggio.arp.SetLatch(!arpeggio.arp.Latch)
+		},
+	},
+	{
+		name: "LoopKey",
+		value: func(state *State) string {
+			if state.LoopKey == 0 {
+				return "Off"
+			}
+			return "SW" + strconv.Itoa(keylayout.Keys[state.LoopKey-1].Switch)
+		},
+		change: func(state *State, delta int) {
+			state.LoopKey = wrap(state.LoopKey+delta, len(notes)+1)
+		},
+	},
+	{
+		// 右に回すとルーパーキーと同じ動作、左に回すと止める
+		name: "Loop",
+		value: func(state *State) string {
+			return loop.looper.State().String() + " " + strconv.Itoa(loop.looper.Layers())
+		},
+		change: func(state *State, delta int) {
+			if delta > 0 {
+				loop.action()
+			} else {
+				loop.stop()
+			}
+		},
+	},
+	{
+		name: "LoopQ",
+		value: func(state *State) string {
+			return loopQuantizeNames[loop.quantize]
+		},
+		change: func(state *State, delta int) {
+			loop.setQuantize(wrap(loop.quantize+delta, len(loopQuantizeNames)))
+		},
+	},
+	{
+		// 回すと最後に録音したレイヤーを取り消す
+		name: "L Undo",
+		value: func(state *State) string {
+			return strconv.Itoa(loop.looper.Layers())
+		},
+		change: func(state *State, delta int) {
+			loop.undo()
+		},
+	},
+	{
+		// 回すと録音したものをすべて消す (表示は録音したイベント数)
+		name: "L Clear",
+		value: func(state *State) string {
+			return strconv.Itoa(loop.looper.Events())
+		},
+		change: func(state *State, delta int) {
+			loop.clear()
+		},
+	},
+	{
+		// ドラムの音を予定時刻からどれだけ遅れて送れたか (平均/最大)
+		// 回すとリセットする
+		name: "Latency",
+		value: func(state *State) string {
+			st := drumOut.Stats()
+			return msString(st.MeanLatency) + "/" + msString(st.MaxLatency)
+		},
+		change: func(state *State, delta int) {
+			drumOut.ResetStats()
+		},
+	},
+	{
+		// 遅れのばらつき
+		name: "Jitter",
+		value: func(state *State) string {
+			return msString(drumOut.Stats().Jitter) + "ms"
+		},
+		change: func(state *State, delta int) {
+			drumOut.ResetStats()
+		},
+	},
+	{
+		name: "Buzzer",
+		value: func(state *State) string {
+			return onOff(state.BuzzerEcho)
+		},
+		change: func(state *State, delta int) {
+			state.BuzzerEcho = !state.BuzzerEcho
+			if !state.BuzzerEcho && buzzerOK {
+				buzzer.Stop()
+			}
+		},
+	},
+	{
+		// ドラムを PCM サンプルで鳴らす (EX03)
+		name: "PCM",
+		value: func(state *State) string {
+			return onOff(state.DrumPCM)
+		},
+		change: func(state *State, delta int) {
+			state.DrumPCM = !state.DrumPCM
+			if !state.DrumPCM && drumDACOK {
+				drumDAC.Stop()
+			}
+		},
+	},
+}
+
+// 一度に表示できる項目数
+const menuLines = 4
+
+func redrawMenu(state State) {
+	display.ClearBuffer()
+
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 5, 12, "Menu", displayWhite)
+
+	// 選択中の項目が見えるようにスクロールする
+	first := 0
+	if state.MenuIndex >= menuLines {
+		first = state.MenuIndex - menuLines + 1
+	}
+	for i := first; i < len(menuItems) && i < first+menuLines; i++ {
+		y := int16(12 * (i - first + 2))
+		if i == state.MenuIndex {
+			tinyfont.WriteLine(display, &shnm.Shnmk12, 0, y, ">", displayWhite)
+		}
+		item := menuItems[i]
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 8, y, item.name, displayWhite)
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 64, y, item.value(&state), displayWhite)
+	}
+
+	display.Display()
+}
+
+// changeZones はゾーン設定を変えたときに呼び、音色を送り直す
+func changeZones(state *State) {
+	state.ZonesSaved = false
+	sendPrograms(state)
+}
+
+// changeTempo はテンポを変える (Slave では受信したクロックに従うので変えない)
+// 再生中でも小節の頭に戻らずにそのままのタイミングで速さだけが変わる
+func changeTempo(state *State, delta int) {
+	if state.ClockMode == ClockSlave {
+		return
+	}
+	drum.setBPM(clamp(drum.bpm(state)+delta, minBPM, maxBPM))
+}
+
+// encoderAccel はロータリーエンコーダーを回す間隔が短いほど大きな倍率を返す
+func encoderAccel(interval time.Duration) int {
+	switch {
+	case interval < 25*time.Millisecond:
+		return 10
+	case interval < 60*time.Millisecond:
+		return 4
+	case interval < 120*time.Millisecond:
+		return 2
+	}
+	return 1
+}
+
+// msString はミリ秒を小数 1 桁で表す
+func msString(d time.Duration) string {
+	tenths := int((d + 50*time.Microsecond) / (100 * time.Microsecond))
+	return strconv.Itoa(tenths/10) + "." + strconv.Itoa(tenths%10)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func wrap(v, n int) int {
+	return ((v % n) + n) % n
+}
+
+func onOff(b bool) string {
+	if b {
+		return "On"
+	}
+	return "Off"
+}
@@ -0,0 +1,136 @@
+package main
+
+// Please connect a piezo buzzer to the 3V3 and EX01 pins on the back terminal
+// to hear the received notes.
+//
+// | EX01 | EX03 | 3V3 | SDA0 | 3V3 | 3V3 |     |        GROVE            |
+// | EX02 | EX04 | GND | SCL0 | GND | GND | - - | GND | 3V3 | SDA0 | SCL0 |
+
+import (
+	"machine"
+	"machine/usb/adc/midi"
+	"runtime/volatile"
+
+	"github.com/tinygo-keeb/workshop/pitch"
+	"github.com/tinygo-keeb/workshop/usbmidi"
+	"tinygo.org/x/drivers/tone"
+)
+
+// MIDI 受信
+// SetRxHandler のコールバックは USB の割り込み中に呼ばれるため、
+// パケットをリングバッファに積むだけにしてメインループ側で処理する
+var (
+	rxPackets [32]usbmidi.Packet
+	rxHead    volatile.Register8
+	rxTail    volatile.Register8
+	rxParser  usbmidi.Parser
+)
+
+func initMIDIIn() {
+	midi.Port().SetRxHandler(func(b []byte) {
+		for len(b) >= 4 {
+			head := rxHead.Get()
+			next := (head + 1) % uint8(len(rxPackets))
+			if next != rxTail.Get() { // 溢れた場合は捨てる
+				copy(rxPackets[head][:], b[:4])
+				rxHead.Set(next)
+			}
+			b = b[4:]
+		}
+	})
+}
+
+// readMIDIIn は受信済みのメッセージを handle に渡す
+func readMIDIIn(handle func(m usbmidi.Message)) {
+	for rxTail.Get() != rxHead.Get() {
+		tail := rxTail.Get()
+		p := rxPackets[tail]
+		rxTail.Set((tail + 1) % uint8(len(rxPackets)))
+		rxParser.FeedPacket(p, handle)
+	}
+}
+
+// keyForNote は受信したノートを光らせるキー番号を返す
+// 同じノートのキーが無い場合は同じ音名 (オクターブ違い) のキーを使う
+func keyForNote(n midi.Note) int {
+	for i, note := range notes {
+		if note == n {
+			return i
+		}
+	}
+	for i, note := range notes {
+		if note%12 == n%12 {
+			return i
+		}
+	}
+	return -1
+}
+
+// noteColor はノートに対応する LED の色を返す
+func noteColor(n midi.Note) uint32 {
+	if c, ok := noteColors[n]; ok {
+		return c
+	}
+	for note, c := range noteColors {
+		if note%12 == n%12 {
+			return c
+		}
+	}
+	return white // マッピングがない場合は白色を使用
+}
+
+// 受信したノートを鳴らすブザー (EX01)
+var (
+	buzzer     tone.Speaker
+	buzzerOK   bool
+	buzzerNote midi.Note
+)
+
+func initBuzzer() {
+	var err error
+	buzzer, err = tone.New(machine.PWM7, machine.GPIO14)
+	buzzerOK = err == nil
+}
+
+// keyboardChannel は ch がキーボードのチャンネル (ゾーンを使うときはゾーンのチャンネル) かを返す
+func keyboardChannel(state *State, ch uint8) bool {
+	if !state.ZonesOn {
+		return ch == channel
+	}
+	for _, z := range state.Zones {
+		if z.Enabled && z.Channel == ch {
+			return true
+		}
+	}
+	return false
+}
+
+// receivedNoteOn は DAW やブラウザから受信した NoteOn を LED / OLED / ブザーに反映する
+func receivedNoteOn(state *State, colors []uint32, n midi.Note) {
+	if i := keyForNote(n); i >= 0 {
+		state.RxNotes[i]++
+		colors[i] = noteColor(n)
+		state.ActiveNotes[i] = pitch.Note(n).Katakana()
+	}
+
+	if state.BuzzerEcho && buzzerOK {
+		buzzer.SetNote(tone.Note(n))
+		buzzerNote = n
+	}
+}
+
+// receivedNoteOff は receivedNoteOn で光らせたキーを消す
+func receivedNoteOff(state *State, colors []uint32, n midi.Note) {
+	if i := keyForNote(n); i >= 0 && state.RxNotes[i] > 0 {
+		state.RxNotes[i]--
+		if state.RxNotes[i] == 0 && !state.Keys[i] {
+			colors[i] = black
+			state.ActiveNotes[i] = ""
+		}
+	}
+
+	if buzzerOK && buzzerNote == n {
+		buzzer.Stop()
+		buzzerNote = 0
+	}
+}
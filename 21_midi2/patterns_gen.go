@@ -0,0 +1,259 @@
+// Code generated by drumpat from patterns.drum; DO NOT EDIT.
+
+package main
+
+var drumPatterns = []DrumPattern{
+	{
+		Name: "Metronome",
+		Steps: [][]uint8{
+			{SnareDrum}, // 1
+			{},          // 2
+			{Claves},    // 3
+			{},          // 4
+			{Claves},    // 5
+			{},          // 6
+			{Claves},    // 7
+			{},          // 8
+			{Claves},    // 9
+			{},          // 10
+			{Claves},    // 11
+			{},          // 12
+			{Claves},    // 13
+			{},          // 14
+			{Claves},    // 15
+			{},          // 16
+		},
+		StepLen: 60000 / 100 / 4,
+		Swing:   50,
+	},
+	{
+		Name: "8Beat",
+		Steps: [][]uint8{
+			{BassDrum, ClosedHiHat},  // 1
+			{ClosedHiHat},            // 2
+			{ClosedHiHat, SnareDrum}, // 3
+			{OpenHiHat},              // 4
+			{BassDrum, ClosedHiHat},  // 5
+			{ClosedHiHat},            // 6
+			{ClosedHiHat, SnareDrum}, // 7
+			{ClosedHiHat},            // 8
+			{BassDrum, ClosedHiHat},  // 9
+			{ClosedHiHat},            // 10
+			{ClosedHiHat, SnareDrum}, // 11
+			{ClosedHiHat},            // 12
+			{BassDrum, ClosedHiHat},  // 13
+			{ClosedHiHat},            // 14
+			{ClosedHiHat, SnareDrum}, // 15
+			{CrashCymbal1},           // 16
+		},
+		StepLen: 60000 / 100 / 4,
+		Swing:   50,
+	},
+	{
+		Name: "LatinBrazil",
+		Steps: [][]uint8{
+			{BassDrum, Maracas},  // 1
+			{Claves},             // 2
+			{Maracas, SideStick}, // 3
+			{Cowbell},            // 4
+			{BassDrum, Maracas},  // 5
+			{Claves},             // 6
+			{Maracas, SideStick}, // 7
+			{Cowbell},            // 8
+			{BassDrum, Maracas},  // 9
+			{Claves},             // 10
+			{Maracas, SideStick}, // 11
+			{Cowbell},            // 12
+			{Maracas, SideStick}, // 13
+			{Claves},             // 14
+			{Maracas, Cowbell},   // 15
+			{BassDrum, Claves},   // 16
+		},
+		StepLen: 60000 / 115 / 4,
+		Swing:   50,
+	},
+	{
+		Name: "DnB 1",
+		Steps: [][]uint8{
+			{BassDrum, ClosedHiHat},  // 1
+			{ClosedHiHat},            // 2
+			{ClosedHiHat},            // 3
+			{BassDrum},               // 4
+			{ClosedHiHat, SnareDrum}, // 5
+			{ClosedHiHat},            // 6
+			{ClosedHiHat},            // 7
+			{BassDrum},               // 8
+			{ClosedHiHat},            // 9
+			{ClosedHiHat},            // 10
+			{ClosedHiHat},            // 11
+			{BassDrum},               // 12
+			{ClosedHiHat, SnareDrum}, // 13
+			{ClosedHiHat},            // 14
+			{ClosedHiHat},            // 15
+			{ClosedHiHat},            // 16
+		},
+		StepLen: 60000 / 174 / 4,
+		Swing:   50,
+	},
+	{
+		Name: "DnB 2",
+		Steps: [][]uint8{
+			{BassDrum, ClosedHiHat},  // 1
+			{ClosedHiHat},            // 2
+			{ClosedHiHat},            // 3
+			{BassDrum},               // 4
+			{ClosedHiHat, SnareDrum}, // 5
+			{ClosedHiHat},            // 6
+			{BassDrum, ClosedHiHat},  // 7
+			{ClosedHiHat},            // 8
+			{BassDrum, ClosedHiHat},  // 9
+			{ClosedHiHat},            // 10
+			{SnareDrum},              // 11
+			{OpenHiHat},              // 12
+			{ClosedHiHat, SnareDrum}, // 13
+			{ClosedHiHat},            // 14
+			{BassDrum, SideStick},    // 15
+			{ClosedHiHat},            // 16
+		},
+		StepLen: 60000 / 176 / 4,
+		Swing:   50,
+	},
+	{
+		Name: "DnB Jungle",
+		Steps: [][]uint8{
+			{BassDrum, ClosedHiHat, CrashCymbal1}, // 1
+			{ClosedHiHat},                         // 2
+			{BassDrum, ClosedHiHat},               // 3
+			{ClosedHiHat},                         // 4
+			{ClosedHiHat, SnareDrum},              // 5
+			{ClosedHiHat},                         // 6
+			{BassDrum, ClosedHiHat},               // 7
+			{ClosedHiHat},                         // 8
+			{BassDrum, ClosedHiHat},               // 9
+			{BassDrum, ClosedHiHat},               // 10
+			{ClosedHiHat},                         // 11
+			{OpenHiHat, SideStick},                // 12
+			{ClosedHiHat, SnareDrum},              // 13
+			{BassDrum, ClosedHiHat},               // 14
+			{ClosedHiHat},                         // 15
+			{ClosedHiHat},                         // 16
+		},
+		StepLen: 60000 / 185 / 4,
+		Swing:   50,
+	},
+	{
+		Name: "DnB Rollin",
+		Steps: [][]uint8{
+			{BassDrum, ClosedHiHat},  // 1
+			{ClosedHiHat},            // 2
+			{BassDrum},               // 3
+			{ClosedHiHat},            // 4
+			{ClosedHiHat, SnareDrum}, // 5
+			{ClosedHiHat},            // 6
+			{BassDrum, ClosedHiHat},  // 7
+			{ClosedHiHat},            // 8
+			{BassDrum, ClosedHiHat},  // 9
+			{ClosedHiHat},            // 10
+			{ClosedHiHat, SnareDrum}, // 11
+			{ClosedHiHat},            // 12
+			{BassDrum, OpenHiHat},    // 13
+			{ClosedHiHat},            // 14
+			{ClosedHiHat, SideStick}, // 15
+			{ClosedHiHat},            // 16
+		},
+		StepLen: 60000 / 180 / 4,
+		Swing:   50,
+	},
+	{
+		Name: "DnB StepJump",
+		Steps: [][]uint8{
+			{BassDrum, ClosedHiHat, CrashCymbal1}, // 1
+			{},                                    // 2
+			{ClosedHiHat},                         // 3
+			{BassDrum, ClosedHiHat},               // 4
+			{},                                    // 5
+			{SnareDrum, OpenHiHat},                // 6
+			{BassDrum},                            // 7
+			{ClosedHiHat},                         // 8
+			{BassDrum},                            // 9
+			{},                                    // 10
+			{ClosedHiHat},                         // 11
+			{ClosedHiHat, SnareDrum},              // 12
+			{BassDrum},                            // 13
+			{ClosedHiHat},                         // 14
+			{SideStick},                           // 15
+			{OpenHiHat},                           // 16
+		},
+		StepLen: 60000 / 174 / 4,
+		Swing:   50,
+	},
+	{
+		Name: "DnB TechStep",
+		Steps: [][]uint8{
+			{BassDrum, ClosedHiHat}, // 1
+			{},                      // 2
+			{ClosedHiHat},           // 3
+			{BassDrum, ClosedHiHat}, // 4
+			{SnareDrum},             // 5
+			{},                      // 6
+			{BassDrum, ClosedHiHat}, // 7
+			{ClosedHiHat},           // 8
+			{BassDrum},              // 9
+			{ClosedHiHat},           // 10
+			{SnareDrum},             // 11
+			{ClosedHiHat},           // 12
+			{ClosedHiHat},           // 13
+			{},                      // 14
+			{BassDrum, SideStick},   // 15
+			{ClosedHiHat},           // 16
+		},
+		StepLen: 60000 / 176 / 4,
+		Swing:   50,
+	},
+	{
+		Name: "DnB Neuro",
+		Steps: [][]uint8{
+			{BassDrum, ClosedHiHat, CrashCymbal1}, // 1
+			{},                                    // 2
+			{ClosedHiHat},                         // 3
+			{ClosedHiHat, SnareDrum},              // 4
+			{ClosedHiHat},                         // 5
+			{BassDrum, ClosedHiHat},               // 6
+			{ClosedHiHat},                         // 7
+			{ClosedHiHat},                         // 8
+			{BassDrum, ClosedHiHat},               // 9
+			{},                                    // 10
+			{ClosedHiHat, SnareDrum},              // 11
+			{OpenHiHat},                           // 12
+			{BassDrum, ClosedHiHat},               // 13
+			{ClosedHiHat},                         // 14
+			{ClosedHiHat, SideStick},              // 15
+			{ClosedHiHat},                         // 16
+		},
+		StepLen: 60000 / 178 / 4,
+		Swing:   50,
+	},
+	{
+		Name: "DnB Liquid",
+		Steps: [][]uint8{
+			{BassDrum, ClosedHiHat},  // 1
+			{ClosedHiHat},            // 2
+			{ClosedHiHat},            // 3
+			{ClosedHiHat, SnareDrum}, // 4
+			{ClosedHiHat},            // 5
+			{BassDrum, ClosedHiHat},  // 6
+			{ClosedHiHat},            // 7
+			{ClosedHiHat},            // 8
+			{BassDrum, ClosedHiHat},  // 9
+			{ClosedHiHat},            // 10
+			{ClosedHiHat, SnareDrum}, // 11
+			{ClosedHiHat},            // 12
+			{ClosedHiHat},            // 13
+			{ClosedHiHat},            // 14
+			{ClosedHiHat},            // 15
+			{ClosedHiHat},            // 16
+		},
+		StepLen: 60000 / 172 / 4,
+		Swing:   50,
+	},
+}
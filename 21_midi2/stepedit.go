@@ -0,0 +1,223 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"tinygo.org/x/tinydraw"
+	"tinygo.org/x/tinyfont"
+	"tinygo.org/x/tinyfont/shnm"
+)
+
+// ステップ編集モード
+//
+// 12 キーが 1 ページ分のステップ (16 ステップは 2 ページ、32 ステップは 3 ページ)
+//
+//	step1 step2  step3  step4
+//	step5 step6  step7  step8
+//	step9 step10 step11 step12
+//
+// ロータリーエンコーダーで編集するドラム音を、エンコーダーボタンでページを切り替える
+// ジョイスティックの上で再生 / 停止、右で長さ (16 / 32 ステップ)、左で消去、下で保存
+const stepsPerPage = 12
+
+// 編集できるドラム音 (drumNames のキーをノート番号順に並べたもの)
+var drumVoices = []uint8{
+	BassDrum,
+	SideStick,
+	SnareDrum,
+	HandClap,
+	ElectricSnare,
+	LowFloorTom,
+	ClosedHiHat,
+	HighFloorTom,
+	PedalHiHat,
+	LowTom,
+	OpenHiHat,
+	CrashCymbal1,
+	RideCymbal1,
+	Cowbell,
+	Maracas,
+	Claves,
+}
+
+// ジョイスティックで選ぶ操作
+type stepCommand int
+
+const (
+	stepPlay   stepCommand = iota // 再生 / 停止
+	stepLength                    // 16 ステップと 32 ステップを切り替える
+	stepClear                     // 選択中のドラム音を消す
+	stepSave                      // 保存する
+)
+
+// stepKeys はページ内のステップ番号に対応するキー番号
+var stepKeys = [stepsPerPage]int{0, 3, 6, 9, 1, 4, 7, 10, 2, 5, 8, 11}
+
+// stepEditCommand はステップ編集モードの操作 cmd を行う
+func stepEditCommand(state *State, cmd stepCommand, now time.Time) {
+	pattern := &drumPatterns[state.DrumPatternIndex]
+	voice := drumVoices[state.EditVoice]
+
+	switch cmd {
+	case stepPlay:
+		state.DrumPlaying = !state.DrumPlaying
+		if state.DrumPlaying {
+			drum.start(state, now)
+		} else {
+			drum.stop(state)
+		}
+	case stepLength:
+		// 16 ステップ以下なら 32 ステップにして、後半は前半の 16 ステップを繰り返す
+		// それより長ければ最初の 16 ステップだけにする
+		length := 16
+		if len(pattern.Steps) <= 16 {
+			length = 32
+		}
+		steps := make([][]uint8, length)
+		for s := range steps {
+			switch {
+			case s < len(pattern.Steps):
+				steps[s] = pattern.Steps[s]
+			case s >= 16:
+				steps[s] = append([]uint8{}, steps[s-16]...)
+			default:
+				steps[s] = []uint8{}
+			}
+		}
+		pattern.Steps = steps
+		state.EditPage = 0
+		state.EditSaved = false
+	case stepClear:
+		// 選択中のドラム音をすべてのステップから消す
+		for s := range pattern.Steps {
+			pattern.Steps[s] = removeVoice(pattern.Steps[s], voice)
+		}
+		state.EditSaved = false
+	case stepSave:
+		state.EditSaved = savePatterns() == nil
+	}
+}
+
+// stepEditKey はステップ編集モードでキー i が押されたときの処理
+func stepEditKey(state *State, i int, now time.Time) {
+	pattern := &drumPatterns[state.DrumPatternIndex]
+	voice := drumVoices[state.EditVoice]
+
+	for k, key := range stepKeys {
+		if key != i {
+			continue
+		}
+		s := state.EditPage*stepsPerPage + k
+		if s >= len(pattern.Steps) {
+			break
+		}
+		if hasVoice(pattern.Steps[s], voice) {
+			pattern.Steps[s] = removeVoice(pattern.Steps[s], voice)
+		} else {
+			pattern.Steps[s] = append(pattern.Steps[s][:len(pattern.Steps[s]):len(pattern.Steps[s])], voice)
+			if !state.DrumPlaying {
+				drum.preview(voice, now)
+			}
+		}
+		state.EditSaved = false
+	}
+}
+
+// stepEditPages はパターンのページ数を返す
+func stepEditPages(state State) int {
+	return (len(drumPatterns[state.DrumPatternIndex].Steps) + stepsPerPage - 1) / stepsPerPage
+}
+
+func hasVoice(step []uint8, voice uint8) bool {
+	for _, n := range step {
+		if n == voice {
+			return true
+		}
+	}
+	return false
+}
+
+// removeVoice は voice を除いた新しいスライスを返す
+// パターンのリテラル同士で配列を共有していることがあるので元のスライスは書き換えない
+func removeVoice(step []uint8, voice uint8) []uint8 {
+	ret := make([]uint8, 0, len(step))
+	for _, n := range step {
+		if n != voice {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+// stepEditColors はステップ編集モードの LED の色を返す
+func stepEditColors(state State, colors []uint32) []uint32 {
+	pattern := drumPatterns[state.DrumPatternIndex]
+	voice := drumVoices[state.EditVoice]
+	playhead := -1
+	if state.DrumPlaying {
+		playhead = drum.step(&state)
+	}
+
+	for k, key := range stepKeys {
+		s := state.EditPage*stepsPerPage + k
+		switch {
+		case s >= len(pattern.Steps):
+			colors[key] = black
+		case s == playhead:
+			colors[key] = white
+		case hasVoice(pattern.Steps[s], voice):
+			colors[key] = orange
+		default:
+			colors[key] = black
+		}
+	}
+	return colors
+}
+
+func redrawStepEdit(state State) {
+	display.ClearBuffer()
+
+	pattern := drumPatterns[state.DrumPatternIndex]
+	voice := drumVoices[state.EditVoice]
+
+	title := pattern.Name
+	if !state.EditSaved {
+		title += "*"
+	}
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 5, 12, title, displayWhite)
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 5, 26, drumNames[voice], displayWhite)
+
+	page := "P" + strconv.Itoa(state.EditPage+1) + "/" + strconv.Itoa(stepEditPages(state))
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 98, 12, page, displayWhite)
+	if state.DrumPlaying {
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 98, 26, "PLAY", displayWhite)
+	} else {
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 98, 26, "STOP", displayWhite)
+	}
+
+	// ステップの一覧 (16 ステップ毎に 1 行)
+	playhead := -1
+	if state.DrumPlaying {
+		playhead = drum.step(&state)
+	}
+	for s, step := range pattern.Steps {
+		x := int16(s%16)*8 + 1
+		y := int16(s/16)*10 + 36
+		switch {
+		case s == playhead:
+			tinydraw.FilledRectangle(display, x+2, y+2, 2, 2, displayWhite)
+			tinydraw.Rectangle(display, x, y, 6, 6, displayWhite)
+		case hasVoice(step, voice):
+			tinydraw.FilledRectangle(display, x, y, 6, 6, displayWhite)
+		default:
+			tinydraw.Rectangle(display, x, y, 6, 6, displayWhite)
+		}
+		// 編集中のページに下線を引く
+		if s/stepsPerPage == state.EditPage {
+			tinydraw.Line(display, x, y+8, x+5, y+8, displayWhite)
+		}
+	}
+
+	display.Display()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"machine"
+)
+
+// ステップ編集したドラムパターンとキーボードのゾーン設定をフラッシュに保存する
+// machine.Flash はプログラム領域の後ろの空き領域を指すので、
+// その先頭から消去ブロック単位で使う
+//
+//	ブロック 0: ドラムパターン
+//	ブロック 1: ゾーン
+//
+// ドラムパターンの形式:
+//
+//	"DRP1" パターン数
+//	パターン毎に 名前の長さ 名前 ステップ数 (ステップ毎に ノート数 ノート...)
+var storageMagic = [4]byte{'D', 'R', 'P', '1'}
+
+const (
+	patternsBlock = 0
+	zonesBlock    = 1
+)
+
+var (
+	errNoSavedPatterns = errors.New("no saved patterns")
+	errTooLarge        = errors.New("too large to save")
+)
+
+// writeBlock は消去ブロック block を消して先頭から buf を書き込む
+func writeBlock(block int64, buf []byte) error {
+	eraseSize := machine.Flash.EraseBlockSize()
+	if int64(len(buf)) > eraseSize {
+		return errTooLarge
+	}
+
+	// 書き込みはページ単位なので埋めておく
+	if n := int(machine.Flash.WriteBlockSize()); len(buf)%n != 0 {
+		buf = append(buf, make([]byte, n-len(buf)%n)...)
+	}
+
+	if err := machine.Flash.EraseBlocks(block, 1); err != nil {
+		return err
+	}
+	_, err := machine.Flash.WriteAt(buf, block*eraseSize)
+	return err
+}
+
+// savePatterns は drumPatterns をすべて保存する
+func savePatterns() error {
+	buf := append([]byte(nil), storageMagic[:]...)
+	buf = append(buf, byte(len(drumPatterns)))
+	for _, p := range drumPatterns {
+		buf = append(buf, byte(len(p.Name)))
+		buf = append(buf, p.Name...)
+		buf = append(buf, byte(len(p.Steps)))
+		for _, step := range p.Steps {
+			buf = append(buf, byte(len(step)))
+			buf = append(buf, step...)
+		}
+	}
+	return writeBlock(patternsBlock, buf)
+}
+
+// loadPatterns は保存済みのパターンを読み込み、同じ名前の drumPatterns を置き換える
+func loadPatterns() error {
+	var header [5]byte
+	if _, err := machine.Flash.ReadAt(header[:], 0); err != nil {
+		return err
+	}
+	if [4]byte(header[:4]) != storageMagic {
+		return errNoSavedPatterns
+	}
+
+	off := int64(len(header))
+	readByte := func() (byte, error) {
+		var b [1]byte
+		_, err := machine.Flash.ReadAt(b[:], off)
+		off++
+		return b[0], err
+	}
+	readBytes := func(n byte) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := machine.Flash.ReadAt(b, off)
+		off += int64(n)
+		return b, err
+	}
+
+	for i := 0; i < int(header[4]); i++ {
+		n, err := readByte()
+		if err != nil {
+			return err
+		}
+		name, err := readBytes(n)
+		if err != nil {
+			return err
+		}
+		n, err = readByte()
+		if err != nil {
+			return err
+		}
+		steps := make([][]uint8, n)
+		for j := range steps {
+			if n, err = readByte(); err != nil {
+				return err
+			}
+			if steps[j], err = readBytes(n); err != nil {
+				return err
+			}
+		}
+
+		for k := range drumPatterns {
+			if drumPatterns[k].Name == string(name) && len(steps) > 0 {
+				drumPatterns[k].Steps = steps
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"machine"
+	"machine/usb/adc/midi"
+
+	"github.com/tinygo-keeb/workshop/usbmidi"
+)
+
+// キーボードのゾーン (スプリットとレイヤー)
+// 12 個のキーをスケールの度数 (layout.go を参照) の範囲で分け、
+// 範囲ごとに別の MIDI チャンネル、音色、オクターブ、ベロシティで鳴らす
+// 範囲が重なったゾーンは同じキーで一緒に鳴る (レイヤー)
+//
+// 初期設定では下段 (度数 0-3) をチャンネル 2 のベース、
+// 中段と上段 (度数 4-11) をチャンネル 1 のピアノにする
+// ゾーン 3 を有効にするとピアノにチャンネル 3 のストリングスが重なる
+
+// Zone はキーボードの 1 つのゾーン
+type Zone struct {
+	Enabled  bool
+	Low      int   // 最低の度数 (0-11)
+	High     int   // 最高の度数 (0-11)
+	Channel  uint8 // MIDI チャンネル (1-16)
+	Program  uint8 // 音色 (プログラム番号 0-127)
+	Octave   int   // オクターブのずらし (-3 から 3)
+	Velocity uint8 // ベロシティ (1-127)
+}
+
+// Contains はキーの度数 degree がゾーンの範囲に入っているかを返す
+func (z Zone) Contains(degree int) bool {
+	return z.Enabled && z.Low <= degree && degree <= z.High
+}
+
+const zoneCount = 3
+
+var defaultZones = [zoneCount]Zone{
+	{Enabled: true, Low: 0, High: 3, Channel: 2, Program: 33, Octave: -1, Velocity: 100}, // Finger Bass
+	{Enabled: true, Low: 4, High: 11, Channel: 1, Program: 0, Octave: 0, Velocity: 100},  // Piano
+	{Enabled: false, Low: 4, High: 11, Channel: 3, Program: 48, Octave: 0, Velocity: 80}, // Strings
+}
+
+// zoneNote はキーで鳴らした 1 つの音
+type zoneNote struct {
+	channel uint8
+	note    midi.Note
+}
+
+// 押したキーで鳴らした音 (キーを離したときに同じチャンネルの同じ音を止める)
+var heldZoneNotes [12][]zoneNote
+
+// zoneNoteOn はキー i で notes を鳴らす
+// ゾーンを使わないときはピアノチャンネルで、使うときはキーが入るゾーンごとに鳴らす
+func zoneNoteOn(state *State, i int, notes []midi.Note) {
+	m := midi.Port()
+	held := heldZoneNotes[i][:0]
+	if !state.ZonesOn {
+		for _, n := range notes {
+			m.NoteOn(cable, channel, n, velocity)
+			loop.record(0x90|(channel-1), uint8(n), velocity)
+			held = append(held, zoneNote{channel, n})
+		}
+		heldZoneNotes[i] = held
+		return
+	}
+
+	degree := keyDegree(i)
+	for _, z := range state.Zones {
+		if !z.Contains(degree) {
+			continue
+		}
+		for _, n := range notes {
+			note := int(n) + 12*z.Octave
+			if note < 0 || note > 127 {
+				continue
+			}
+			m.NoteOn(cable, z.Channel, midi.Note(note), z.Velocity)
+			loop.record(0x90|(z.Channel-1), uint8(note), z.Velocity)
+			held = append(held, zoneNote{z.Channel, midi.Note(note)})
+		}
+	}
+	heldZoneNotes[i] = held
+}
+
+// zoneNoteOff はキー i で鳴らした音を止める
+func zoneNoteOff(i int) {
+	m := midi.Port()
+	for _, zn := range heldZoneNotes[i] {
+		m.NoteOff(cable, zn.channel, zn.note, 0)
+		loop.record(0x80|(zn.channel-1), uint8(zn.note), 0)
+	}
+	heldZoneNotes[i] = heldZoneNotes[i][:0]
+}
+
+// sendPrograms は有効なゾーンの音色を送る
+// ゾーンを使わないときはピアノチャンネルをピアノに戻す
+func sendPrograms(state *State) {
+	m := midi.Port()
+	if !state.ZonesOn {
+		pc := usbmidi.ProgramChange(cable, channel, 0)
+		m.Write(pc[:])
+		return
+	}
+	for _, z := range state.Zones {
+		if z.Enabled {
+			pc := usbmidi.ProgramChange(cable, z.Channel, z.Program)
+			m.Write(pc[:])
+		}
+	}
+}
+
+// ゾーン設定の保存形式:
+//
+//	"ZON1" ゾーン使用の有無 ゾーン数
+//	ゾーン毎に 有効 最低度数 最高度数 チャンネル 音色 オクターブ+3 ベロシティ
+var zonesMagic = [4]byte{'Z', 'O', 'N', '1'}
+
+const zoneSize = 7
+
+var errNoSavedZones = errors.New("no saved zones")
+
+// saveZones はゾーン設定を保存する
+func saveZones(state *State) error {
+	buf := append([]byte(nil), zonesMagic[:]...)
+	buf = append(buf, boolByte(state.ZonesOn), zoneCount)
+	for _, z := range state.Zones {
+		buf = append(buf,
+			boolByte(z.Enabled),
+			byte(z.Low),
+			byte(z.High),
+			z.Channel,
+			z.Program,
+			byte(z.Octave+3),
+			z.Velocity,
+		)
+	}
+	return writeBlock(zonesBlock, buf)
+}
+
+// loadZones は保存済みのゾーン設定を読み込む
+func loadZones(state *State) error {
+	var buf [6 + zoneCount*zoneSize]byte
+	if _, err := machine.Flash.ReadAt(buf[:], zonesBlock*machine.Flash.EraseBlockSize()); err != nil {
+		return err
+	}
+	if [4]byte(buf[:4]) != zonesMagic || buf[5] != zoneCount {
+		return errNoSavedZones
+	}
+
+	var zones [zoneCount]Zone
+	for i := range zones {
+		b := buf[6+i*zoneSize:]
+		z := Zone{
+			Enabled:  b[0] != 0,
+			Low:      int(b[1]),
+			High:     int(b[2]),
+			Channel:  b[3],
+			Program:  b[4],
+			Octave:   int(b[5]) - 3,
+			Velocity: b[6],
+		}
+		// 消去したままの領域などおかしな値は読み込まない
+		if z.Low > z.High || z.High > 11 || z.Channel < 1 || z.Channel > 16 ||
+			z.Program > 127 || z.Octave < -3 || z.Octave > 3 || z.Velocity < 1 || z.Velocity > 127 {
+			return errNoSavedZones
+		}
+		zones[i] = z
+	}
+	state.ZonesOn = buf[4] != 0
+	state.Zones = zones
+	return nil
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
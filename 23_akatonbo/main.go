@@ -6,239 +6,83 @@ package main
 // | EX02 | EX04 | GND | SCL0 | GND | GND | - - | GND | 3V3 | SDA0 | SCL0 |
 
 import (
+	_ "embed"
 	"fmt"
 	"machine"
 	"time"
+
+	"github.com/tinygo-keeb/workshop/jukebox"
+	"github.com/tinygo-keeb/workshop/mml"
+	"github.com/tinygo-keeb/workshop/pitch"
+	"github.com/tinygo-keeb/workshop/sfx"
+	"tinygo.org/x/drivers/encoders"
 	"tinygo.org/x/drivers/tone"
 )
 
-// タクトスイッチのピン定義
-const BUTTON_PIN = machine.GPIO2
+// タクトスイッチ (ロータリーエンコーダーボタン) とジョイスティックボタンのピン定義
+const (
+	BUTTON_PIN = machine.GPIO2
+	STOP_PIN   = machine.GPIO0
+)
 
 // ボタンの初期化
 func initButton() {
 	BUTTON_PIN.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	STOP_PIN.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
 }
 
-// ボタンが押されたかチェック（チャタリング対策付き）
-func isButtonPressed() bool {
-	if !BUTTON_PIN.Get() { // プルアップなので押されると false
-		time.Sleep(50 * time.Millisecond) // チャタリング対策
-		if !BUTTON_PIN.Get() {            // 再確認
-			// ボタンが離されるまで待つ
-			for !BUTTON_PIN.Get() {
-				time.Sleep(10 * time.Millisecond)
-			}
-			time.Sleep(50 * time.Millisecond) // 離した後のチャタリング対策
-			return true
-		}
-	}
-	return false
+// Button は押された瞬間を調べるボタン (チャタリング対策付き)
+// 待たずにすぐ戻るので、メインループから毎回呼べる
+type Button struct {
+	pin     machine.Pin
+	pressed bool      // 押されているかどうか
+	changed time.Time // 最後に状態が変わった時刻
 }
 
-type NoteWithDuration struct {
-	Note     tone.Note
-	Duration time.Duration
+// Pressed はボタンが押された瞬間に true を返す
+func (b *Button) Pressed(now time.Time) bool {
+	down := !b.pin.Get() // プルアップなので押されると false
+	if down == b.pressed || now.Sub(b.changed) < 50*time.Millisecond {
+		return false
+	}
+	b.pressed = down
+	b.changed = now
+	return down
 }
 
 var pinToPWM = map[machine.Pin]tone.PWM{
 	machine.GPIO14: machine.PWM7, // for EX01
 }
 
-// ブザーを初期化する関数
-func initBuzzer() (tone.Speaker, error) {
+// ブザーを初期化する関数 (音量を変えられる)
+func initBuzzer() (*jukebox.Speaker, error) {
 	bzrPin := machine.GPIO14
 	pwm := pinToPWM[bzrPin]
-	speaker, err := tone.New(pwm, bzrPin)
-	if err != nil {
-		return tone.Speaker{}, err
-	}
-	return speaker, nil
+	return jukebox.NewSpeaker(pwm, bzrPin)
 }
 
-func getSong() []interface{} {
-	const bpm = 100
-	beat := time.Minute / bpm
-	eighth := beat / 2
-	quarter := beat
-	dottedQuarter := beat * 3 / 2
-	dottedHalf := beat * 3
-
-	return []interface{}{
-		"夕焼け",
-		NoteWithDuration{tone.G4, eighth},
-		NoteWithDuration{tone.C5, eighth},
-		NoteWithDuration{tone.C5, dottedQuarter},
-		NoteWithDuration{tone.D5, eighth},
-
-		"小焼けの",
-		NoteWithDuration{tone.E5, eighth},
-		NoteWithDuration{tone.G5, eighth},
-		NoteWithDuration{tone.C6, eighth},
-		NoteWithDuration{tone.A5, eighth},
-		NoteWithDuration{tone.G5, quarter},
-
-		"赤とんぼ",
-		NoteWithDuration{tone.A5, eighth},
-		NoteWithDuration{tone.C5, eighth},
-		NoteWithDuration{tone.C5, quarter},
-		NoteWithDuration{tone.D5, quarter},
-		NoteWithDuration{tone.E5, dottedHalf},
-
-		"負われて",
-		NoteWithDuration{tone.E5, eighth},
-		NoteWithDuration{tone.A5, eighth},
-		NoteWithDuration{tone.G5, dottedQuarter},
-		NoteWithDuration{tone.A5, eighth},
-
-		"見たのは",
-		NoteWithDuration{tone.C6, eighth},
-		NoteWithDuration{tone.A5, eighth},
-		NoteWithDuration{tone.G5, eighth},
-		NoteWithDuration{tone.A5, eighth},
-		NoteWithDuration{tone.G5, eighth},
-		NoteWithDuration{tone.E5, eighth},
-
-		"何時の日か",
-		NoteWithDuration{tone.G5, eighth},
-		NoteWithDuration{tone.E5, eighth},
-		NoteWithDuration{tone.C5, eighth},
-		NoteWithDuration{tone.E5, eighth},
-		NoteWithDuration{tone.D5, eighth},
-		NoteWithDuration{tone.C5, eighth},
-		NoteWithDuration{tone.C5, dottedHalf},
-	}
-}
+// 楽曲データ (MML)
+// 音の高さと長さは akatonbo.mml に書いてある
+//
+//go:embed akatonbo.mml
+var songMML string
 
 // 音符名と周波数を取得する関数（全オクターブ対応）
-func getNoteName(note tone.Note) string {
-	switch note {
-	// 3オクターブ
-	case tone.C3:
-		return "ド(C3) 131Hz"
-	case tone.CS3:
-		return "ド#(C#3) 139Hz"
-	case tone.D3:
-		return "レ(D3) 147Hz"
-	case tone.DS3:
-		return "レ#(D#3) 156Hz"
-	case tone.E3:
-		return "ミ(E3) 165Hz"
-	case tone.F3:
-		return "ファ(F3) 175Hz"
-	case tone.FS3:
-		return "ファ#(F#3) 185Hz"
-	case tone.G3:
-		return "ソ(G3) 196Hz"
-	case tone.GS3:
-		return "ソ#(G#3) 208Hz"
-	case tone.A3:
-		return "ラ(A3) 220Hz"
-	case tone.AS3:
-		return "ラ#(A#3) 233Hz"
-	case tone.B3:
-		return "シ(B3) 247Hz"
-
-	// 4オクターブ
-	case tone.C4:
-		return "ド(C4) 262Hz"
-	case tone.CS4:
-		return "ド#(C#4) 277Hz"
-	case tone.D4:
-		return "レ(D4) 294Hz"
-	case tone.DS4:
-		return "レ#(D#4) 311Hz"
-	case tone.E4:
-		return "ミ(E4) 330Hz"
-	case tone.F4:
-		return "ファ(F4) 349Hz"
-	case tone.FS4:
-		return "ファ#(F#4) 370Hz"
-	case tone.G4:
-		return "ソ(G4) 392Hz"
-	case tone.GS4:
-		return "ソ#(G#4) 415Hz"
-	case tone.A4:
-		return "ラ(A4) 440Hz"
-	case tone.AS4:
-		return "ラ#(A#4) 466Hz"
-	case tone.B4:
-		return "シ(B4) 494Hz"
-
-	// 5オクターブ
-	case tone.C5:
-		return "ド(C5) 523Hz"
-	case tone.CS5:
-		return "ド#(C#5) 554Hz"
-	case tone.D5:
-		return "レ(D5) 587Hz"
-	case tone.DS5:
-		return "レ#(D#5) 622Hz"
-	case tone.E5:
-		return "ミ(E5) 659Hz"
-	case tone.F5:
-		return "ファ(F5) 698Hz"
-	case tone.FS5:
-		return "ファ#(F#5) 740Hz"
-	case tone.G5:
-		return "ソ(G5) 784Hz"
-	case tone.GS5:
-		return "ソ#(G#5) 831Hz"
-	case tone.A5:
-		return "ラ(A5) 880Hz"
-	case tone.AS5:
-		return "ラ#(A#5) 932Hz"
-	case tone.B5:
-		return "シ(B5) 988Hz"
-
-	// 6オクターブ
-	case tone.C6:
-		return "ド(C6) 1047Hz"
-	case tone.CS6:
-		return "ド#(C#6) 1109Hz"
-	case tone.D6:
-		return "レ(D6) 1175Hz"
-	case tone.DS6:
-		return "レ#(D#6) 1245Hz"
-	case tone.E6:
-		return "ミ(E6) 1319Hz"
-	case tone.F6:
-		return "ファ(F6) 1397Hz"
-	case tone.FS6:
-		return "ファ#(F#6) 1480Hz"
-	case tone.G6:
-		return "ソ(G6) 1568Hz"
-	case tone.GS6:
-		return "ソ#(G#6) 1661Hz"
-	case tone.A6:
-		return "ラ(A6) 1760Hz"
-	case tone.AS6:
-		return "ラ#(A#6) 1865Hz"
-	case tone.B6:
-		return "シ(B6) 1976Hz"
-
-	default:
-		return "不明な音"
-	}
+// 例: ド(C4) 262Hz
+func getNoteName(note pitch.Note) string {
+	name := pitch.ClassName(note.Class(), pitch.Katakana, pitch.Sharps)
+	return fmt.Sprintf("%s(%s) %.0fHz", name, note.Name(), note.Frequency())
 }
 
-// 楽曲を演奏する関数（画面表示付き）
-func playSong(speaker tone.Speaker, song []interface{}, display *Display) {
-	noteIndex := 0
-	for _, element := range song {
-		switch v := element.(type) {
-		case string:
-			display.UpdateStatus(v)
-		case NoteWithDuration:
-			noteIndex++
-			noteName := getNoteName(v.Note)
-			display.PrintLine(fmt.Sprintf("%d: %s", noteIndex, noteName))
-
-			speaker.SetNote(v.Note)
-			time.Sleep(v.Duration)
-			speaker.Stop()
-			time.Sleep(10 * time.Millisecond)
-		}
+// showEvent は演奏中の音と歌詞を画面に表示する
+func showEvent(e jukebox.Event, noteIndex *int, display *Display) {
+	switch e.Kind {
+	case jukebox.Lyric:
+		display.UpdateStatus(e.Event.Lyric)
+	case jukebox.Note:
+		*noteIndex++
+		noteName := getNoteName(pitch.Note(e.Event.Note))
+		display.PrintLine(fmt.Sprintf("%d: %s", *noteIndex, noteName))
 	}
 }
 
@@ -272,10 +116,43 @@ func main() {
 	fmt.Println("ブザー初期化完了")
 	display.PrintLine("ブザー初期化完了")
 
+	// ロータリーエンコーダー (音量)
+	rotaryEncoder := encoders.NewQuadratureViaInterrupt(
+		machine.GPIO3,
+		machine.GPIO4,
+	)
+	rotaryEncoder.Configure(encoders.QuadratureConfig{
+		Precision: 4,
+	})
+	encOldValue := 0
+	volume := jukebox.MaxVolume
+
 	// 楽曲データの取得
-	song := getSong()
+	song, err := mml.Parse(songMML)
+	if err != nil {
+		fmt.Println("failed to parse MML:", err)
+		display.PrintLine("MMLエラー")
+		return
+	}
 	fmt.Println("楽曲データ取得完了")
 	display.PrintLine("楽曲データ取得完了")
+	akatonbo := &jukebox.Item{Name: "赤とんぼ", Song: song, Priority: jukebox.Music}
+
+	// 演奏はバックグラウンドで進み、進み具合は events で受け取って画面に表示する
+	// (コールバックは演奏側の goroutine で呼ばれるので、ここでは画面を触らない)
+	events := make(chan jukebox.Event, 16)
+	player := jukebox.New(speaker, func(e jukebox.Event) {
+		select {
+		case events <- e:
+		default: // 表示が追いつかないときは捨てる
+		}
+	})
+	// 効果音 (音量を変えたときのクリック音)
+	effects := sfx.NewPlayer(player)
+
+	noteIndex := 0
+	playing := false // 赤とんぼを演奏中 (一時停止中も含む)
+	paused := false
 
 	// 演奏回数カウンター
 	playCount := 0
@@ -285,20 +162,72 @@ func main() {
 	fmt.Println("ボタン待機中...")
 	display.UpdateStatus("待機中")
 
+	playButton := Button{pin: BUTTON_PIN}
+	stopButton := Button{pin: STOP_PIN}
 	for {
-		if isButtonPressed() {
-			playCount++
-			fmt.Printf("ボタンが押されました - 演奏回数: %d\n", playCount)
-			display.PrintLine(fmt.Sprintf("演奏開始 (%d回目)", playCount))
-			display.UpdateStatus("演奏中...")
+		now := time.Now()
+
+		// 演奏 / 一時停止 / 再開
+		if playButton.Pressed(now) {
+			switch {
+			case !playing:
+				playCount++
+				noteIndex = 0
+				playing = true
+				fmt.Printf("ボタンが押されました - 演奏回数: %d\n", playCount)
+				display.PrintLine(fmt.Sprintf("演奏開始 (%d回目)", playCount))
+				player.Play(akatonbo)
+			case paused:
+				paused = false
+				player.Resume()
+			default:
+				paused = true
+				player.Pause()
+			}
+		}
 
-			playSong(speaker, song, display)
+		// 停止
+		if stopButton.Pressed(now) && playing {
+			player.Stop()
+		}
+
+		// 音量 (効果音は演奏に割り込んで鳴り、終わると演奏が続く)
+		if newValue := rotaryEncoder.Position(); newValue != encOldValue {
+			volume += newValue - encOldValue
+			if volume < 0 {
+				volume = 0
+			} else if volume > jukebox.MaxVolume {
+				volume = jukebox.MaxVolume
+			}
+			encOldValue = newValue
+			player.SetVolume(uint8(volume))
+			if !paused {
+				effects.Play(sfx.KeyClick)
+			}
+			display.PrintLine(fmt.Sprintf("音量 %d", volume))
+		}
 
-			fmt.Printf("演奏完了 - %d回目\n", playCount)
-			display.PrintLine(fmt.Sprintf("演奏完了 (%d回目)", playCount))
-			display.PrintLine("ボタンを押す")
-			display.UpdateStatus("待機中")
+		// 演奏の進み具合を表示する
+		for len(events) > 0 {
+			e := <-events
+			if effects.IsEffect(e.Item) {
+				continue
+			}
+			showEvent(e, &noteIndex, display)
+			switch e.Kind {
+			case jukebox.Started, jukebox.Unpaused:
+				display.UpdateStatus("演奏中...")
+			case jukebox.Paused:
+				display.UpdateStatus("一時停止")
+			case jukebox.Finished, jukebox.Stopped:
+				playing, paused = false, false
+				fmt.Printf("演奏完了 - %d回目\n", playCount)
+				display.PrintLine(fmt.Sprintf("演奏完了 (%d回目)", playCount))
+				display.PrintLine("ボタンを押す")
+				display.UpdateStatus("待機中")
+			}
 		}
-		time.Sleep(100 * time.Millisecond) // CPU負荷軽減
+
+		time.Sleep(5 * time.Millisecond) // CPU負荷軽減
 	}
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	_ "embed"
+	"machine"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/ledanim"
+	"github.com/tinygo-keeb/workshop/ledcolor"
+	pio "github.com/tinygo-org/pio/rp2-pio"
+	"github.com/tinygo-org/pio/rp2-pio/piolib"
+	"tinygo.org/x/drivers/encoders"
+)
+
+// Animations are plain text files, see ledanim.Parse for the format.
+var (
+	//go:embed startup.anim
+	startupAnim string
+	//go:embed idle.anim
+	idleAnim string
+	//go:embed notify.anim
+	notifyAnim string
+)
+
+type WS2812B struct {
+	Pin machine.Pin
+	ws  *piolib.WS2812B
+}
+
+func NewWS2812B(pin machine.Pin) *WS2812B {
+	s, _ := pio.PIO0.ClaimStateMachine()
+	ws, _ := piolib.NewWS2812B(s, pin)
+	ws.EnableDMA(true)
+	return &WS2812B{
+		ws: ws,
+	}
+}
+
+func (ws *WS2812B) WriteRaw(rawGRB []uint32) error {
+	return ws.ws.WriteRaw(rawGRB)
+}
+
+func main() {
+	startup := ledanim.MustParse(startupAnim)
+	idle := ledanim.MustParse(idleAnim)
+	notify := ledanim.MustParse(notifyAnim)
+
+	ws := NewWS2812B(machine.GPIO1)
+	strip := ledcolor.NewStrip(12)
+	strip.Brightness = 0x80
+	frame := make([]ledcolor.RGB, 12)
+
+	// press the rotary encoder to play the notification
+	btn := machine.GPIO2
+	btn.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	prev := btn.Get()
+
+	// turn the rotary encoder to change the brightness
+	enc := encoders.NewQuadratureViaInterrupt(
+		machine.GPIO3,
+		machine.GPIO4,
+	)
+	enc.Configure(encoders.QuadratureConfig{
+		Precision: 4,
+	})
+	encOldValue := 0
+
+	player := ledanim.Player{}
+	player.Play(startup)
+
+	for {
+		current := btn.Get()
+		if prev && !current {
+			player.Play(notify)
+		}
+		prev = current
+
+		if newValue := enc.Position(); newValue != encOldValue {
+			b := int(strip.Brightness) + (newValue-encOldValue)*0x10
+			if b < 0x10 {
+				b = 0x10
+			} else if b > 0xFF {
+				b = 0xFF
+			}
+			strip.Brightness = uint8(b)
+			encOldValue = newValue
+		}
+
+		// go back to the idle animation when a one shot animation ends
+		if player.Done() {
+			player.Play(idle)
+		}
+
+		player.Frame(frame)
+		ws.WriteRaw(strip.Render(frame))
+		time.Sleep(16 * time.Millisecond)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+// Standard MIDI File (.mid) を USB MIDI またはブザーで再生する
+//
+// ロータリーエンコーダー       : 1 小節ずつ早送り / 巻き戻し
+// ロータリーエンコーダーボタン : 再生 / 一時停止
+// ジョイスティック上下         : 曲の切り替え
+// ジョイスティックボタン       : 出力の切り替え (USB MIDI / ブザー)
+//
+// ブザーで鳴らす場合は 3V3 と EX01 に圧電ブザーを接続する
+//
+// | EX01 | EX03 | 3V3 | SDA0 | 3V3 | 3V3 |     |        GROVE            |
+// | EX02 | EX04 | GND | SCL0 | GND | GND | - - | GND | 3V3 | SDA0 | SCL0 |
+
+import (
+	_ "embed"
+	"image/color"
+	"machine"
+	"machine/usb/adc/midi"
+	"strconv"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/smf"
+	"github.com/tinygo-keeb/workshop/usbmidi"
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/encoders"
+	"tinygo.org/x/drivers/ssd1306"
+	"tinygo.org/x/drivers/tone"
+	"tinygo.org/x/tinydraw"
+	"tinygo.org/x/tinyfont"
+	"tinygo.org/x/tinyfont/shnm"
+)
+
+const cable = 0
+
+// 埋め込む曲
+// akatonbo.mid はテンポが途中で変わる format 1、kaeru.mid は format 0
+var (
+	//go:embed akatonbo.mid
+	akatonboMid []byte
+	//go:embed kaeru.mid
+	kaeruMid []byte
+)
+
+// Output は再生先
+type Output int
+
+const (
+	OutputMIDI   Output = iota // USB MIDI
+	OutputBuzzer               // EX01 のブザー (一番高い音だけを鳴らす)
+)
+
+var outputNames = []string{"USB MIDI", "ブザー"}
+
+var (
+	white    = color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	display  *ssd1306.Device
+	buzzer   tone.Speaker
+	buzzerOK bool
+	mono     smf.Mono
+)
+
+func main() {
+	machine.I2C0.Configure(machine.I2CConfig{
+		Frequency: 2.8 * machine.MHz,
+		SDA:       machine.GPIO12,
+		SCL:       machine.GPIO13,
+	})
+
+	display = ssd1306.NewI2C(machine.I2C0)
+	display.Configure(ssd1306.Config{
+		Address: 0x3C,
+		Width:   128,
+		Height:  64,
+	})
+	display.SetRotation(drivers.Rotation180)
+	display.ClearDisplay()
+
+	var err error
+	buzzer, err = tone.New(machine.PWM7, machine.GPIO14)
+	buzzerOK = err == nil
+
+	// 曲を読み込む
+	var songs []*smf.Song
+	for _, data := range [][]byte{akatonboMid, kaeruMid} {
+		f, err := smf.Parse(data)
+		if err != nil {
+			println(err.Error())
+			continue
+		}
+		songs = append(songs, f.Song())
+	}
+	if len(songs) == 0 {
+		return
+	}
+	songIndex := 0
+	player := smf.NewPlayer(songs[songIndex])
+	output := OutputMIDI
+
+	rotaryButton := machine.GPIO2
+	rotaryButton.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	prevRotaryButton := rotaryButton.Get()
+
+	joystickButton := machine.GPIO0
+	joystickButton.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	prevJoystickButton := joystickButton.Get()
+
+	machine.InitADC()
+	ay := machine.ADC{Pin: machine.GPIO28}
+	ay.Configure(machine.ADCConfig{})
+	prevUp, prevDown := false, false
+
+	rotaryEncoder := encoders.NewQuadratureViaInterrupt(
+		machine.GPIO3,
+		machine.GPIO4,
+	)
+	rotaryEncoder.Configure(encoders.QuadratureConfig{
+		Precision: 4,
+	})
+	encOldValue := 0
+
+	// USB の初期化待ち
+	time.Sleep(1 * time.Second)
+
+	// 再生した音を出力する
+	play := func(e smf.Event) {
+		if output == OutputBuzzer {
+			if !buzzerOK {
+				return
+			}
+			if note, changed := mono.Handle(e); changed {
+				if note == 0 {
+					buzzer.Stop()
+				} else {
+					buzzer.SetNote(tone.Note(note))
+				}
+			}
+			return
+		}
+		if e.IsChannel() {
+			pkt := usbmidi.ChannelMessage(cable, e.Status, e.Data1, e.Data2)
+			midi.Port().Write(pkt[:])
+		}
+	}
+
+	// 鳴っている音をすべて止める
+	silence := func() {
+		mono.Reset()
+		if buzzerOK {
+			buzzer.Stop()
+		}
+		m := midi.Port()
+		for ch := uint8(1); ch <= 16; ch++ {
+			pkt := usbmidi.ControlChange(cable, ch, 123, 0) // All Notes Off
+			m.Write(pkt[:])
+		}
+	}
+
+	// プログラムチェンジなどを送り直して seek 先の状態にする
+	chase := func(e smf.Event) {
+		if output == OutputMIDI {
+			play(e)
+		}
+	}
+
+	lastRedraw := time.Time{}
+	for {
+		now := time.Now()
+
+		// 再生 / 一時停止
+		currentRotaryButton := rotaryButton.Get()
+		if prevRotaryButton && !currentRotaryButton {
+			if player.Playing() {
+				player.Pause(now)
+				silence()
+			} else {
+				if player.Done() {
+					player.Seek(0, now, chase)
+				}
+				player.Play(now)
+			}
+			lastRedraw = time.Time{}
+		}
+		prevRotaryButton = currentRotaryButton
+
+		// 出力の切り替え
+		currentJoystickButton := joystickButton.Get()
+		if prevJoystickButton && !currentJoystickButton {
+			silence()
+			output = (output + 1) % Output(len(outputNames))
+			player.Seek(player.Tick(now), now, chase)
+			lastRedraw = time.Time{}
+		}
+		prevJoystickButton = currentJoystickButton
+
+		// 曲の切り替え
+		y := ay.Get()
+		up := 0xA000 < y
+		down := y < 0x6000
+		if (up && !prevUp) || (down && !prevDown) {
+			silence()
+			if up {
+				songIndex = (songIndex + len(songs) - 1) % len(songs)
+			} else {
+				songIndex = (songIndex + 1) % len(songs)
+			}
+			player = smf.NewPlayer(songs[songIndex])
+			lastRedraw = time.Time{}
+		}
+		prevUp, prevDown = up, down
+
+		// 1 小節ずつ移動する (テンポと拍子が途中で変わっても小節の頭に移動する)
+		if newValue := rotaryEncoder.Position(); newValue != encOldValue {
+			song := player.Song()
+			bar, _ := song.BarBeat(player.Tick(now))
+			bar += newValue - encOldValue
+			tick := song.BarTick(bar)
+			if song.TickTime(tick) > song.Duration() {
+				tick = song.BarTick(bar - 1)
+			}
+			silence()
+			player.Seek(tick, now, chase)
+			encOldValue = newValue
+			lastRedraw = time.Time{}
+		}
+
+		player.Update(now, play)
+
+		if lastRedraw.IsZero() || now.Sub(lastRedraw) >= 100*time.Millisecond {
+			redraw(player, output, now)
+			lastRedraw = now
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func redraw(player *smf.Player, output Output, now time.Time) {
+	display.ClearBuffer()
+
+	song := player.Song()
+	tick := player.Tick(now)
+	bar, beat := song.BarBeat(tick)
+
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 12, song.Name, white)
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 26, outputNames[output], white)
+	if player.Playing() {
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 116, 26, "▶", white)
+	} else {
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 116, 26, "II", white)
+	}
+
+	// 小節:拍 とテンポ
+	pos := strconv.Itoa(bar+1) + ":" + strconv.Itoa(beat+1) + "  " + strconv.Itoa(song.Tempo(tick)) + "bpm"
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 40, pos, white)
+
+	// 経過時間 / 曲の長さ
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 52, clock(player.Position(now))+" / "+clock(song.Duration()), white)
+
+	// 進捗バー
+	w := int16(0)
+	if d := song.Duration(); d > 0 {
+		w = int16(int64(player.Position(now)) * 127 / int64(d))
+	}
+	if w > 127 {
+		w = 127
+	}
+	tinydraw.Rectangle(display, 0, 58, 128, 6, white)
+	if w > 0 {
+		tinydraw.FilledRectangle(display, 0, 58, w, 6, white)
+	}
+
+	display.Display()
+}
+
+// clock は m:ss 形式の文字列を返す
+func clock(d time.Duration) string {
+	s := int(d / time.Second)
+	sec := strconv.Itoa(s % 60)
+	if len(sec) < 2 {
+		sec = "0" + sec
+	}
+	return strconv.Itoa(s/60) + ":" + sec
+}
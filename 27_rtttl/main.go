@@ -0,0 +1,211 @@
+package main
+
+// RTTTL (Nokia の着メロ形式) の曲をブザーで鳴らす
+//
+// ロータリーエンコーダー       : 曲を選ぶ
+// ロータリーエンコーダーボタン : 再生 / 停止
+//
+// 曲は tunes.txt に 1 行 1 曲で書いてある
+//
+// 3V3 と EX01 に圧電ブザーを接続する
+//
+// | EX01 | EX03 | 3V3 | SDA0 | 3V3 | 3V3 |     |        GROVE            |
+// | EX02 | EX04 | GND | SCL0 | GND | GND | - - | GND | 3V3 | SDA0 | SCL0 |
+
+import (
+	_ "embed"
+	"image/color"
+	"machine"
+	"strconv"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/mml"
+	"github.com/tinygo-keeb/workshop/pitch"
+	"github.com/tinygo-keeb/workshop/rtttl"
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/encoders"
+	"tinygo.org/x/drivers/ssd1306"
+	"tinygo.org/x/drivers/tone"
+	"tinygo.org/x/tinyfont"
+	"tinygo.org/x/tinyfont/shnm"
+)
+
+//go:embed tunes.txt
+var tunesText string
+
+var (
+	white   = color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	display *ssd1306.Device
+)
+
+// 一度に表示できる曲数
+const listLines = 3
+
+func main() {
+	machine.I2C0.Configure(machine.I2CConfig{
+		Frequency: 2.8 * machine.MHz,
+		SDA:       machine.GPIO12,
+		SCL:       machine.GPIO13,
+	})
+
+	display = ssd1306.NewI2C(machine.I2C0)
+	display.Configure(ssd1306.Config{
+		Address: 0x3C,
+		Width:   128,
+		Height:  64,
+	})
+	display.SetRotation(drivers.Rotation180)
+	display.ClearDisplay()
+
+	// 曲を読み込む
+	tunes, err := rtttl.ParseAll(tunesText)
+	if err != nil {
+		showError(err)
+		return
+	}
+
+	speaker, err := tone.New(machine.PWM7, machine.GPIO14)
+	if err != nil {
+		showError(err)
+		return
+	}
+	player := mml.NewPlayer(buzzer{speaker})
+
+	rotaryButton := machine.GPIO2
+	rotaryButton.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	prevRotaryButton := rotaryButton.Get()
+
+	rotaryEncoder := encoders.NewQuadratureViaInterrupt(
+		machine.GPIO3,
+		machine.GPIO4,
+	)
+	rotaryEncoder.Configure(encoders.QuadratureConfig{
+		Precision: 4,
+	})
+	encOldValue := 0
+
+	selected := 0 // 選択中の曲
+	playing := -1 // 再生中の曲 (-1 で停止中)
+	note := ""    // 鳴っている音の名前
+	var started time.Time
+
+	lastRedraw := time.Time{}
+	for {
+		now := time.Now()
+
+		// 曲を選ぶ
+		if newValue := rotaryEncoder.Position(); newValue != encOldValue {
+			selected = wrap(selected+newValue-encOldValue, len(tunes))
+			encOldValue = newValue
+			lastRedraw = time.Time{}
+		}
+
+		// 再生 / 停止
+		// 再生中に別の曲を選んで押すとその曲に切り替える
+		currentRotaryButton := rotaryButton.Get()
+		if prevRotaryButton && !currentRotaryButton {
+			if playing == selected {
+				player.Stop()
+				playing = -1
+			} else {
+				player.Play(tunes[selected].Song, now)
+				playing = selected
+				started = now
+			}
+			note = ""
+			lastRedraw = time.Time{}
+		}
+		prevRotaryButton = currentRotaryButton
+
+		player.Update(now, func(e mml.Event) {
+			if e.IsNote() {
+				note = pitch.Note(e.Note).Name()
+			} else {
+				note = ""
+			}
+		})
+		if playing >= 0 && !player.Playing() {
+			// 最後まで再生した
+			playing = -1
+			note = ""
+			lastRedraw = time.Time{}
+		}
+
+		if lastRedraw.IsZero() || now.Sub(lastRedraw) >= 100*time.Millisecond {
+			redraw(tunes, selected, playing, note, now.Sub(started))
+			lastRedraw = now
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+// buzzer は mml の MIDI ノート番号を tone.Note にして鳴らす
+type buzzer struct {
+	tone.Speaker
+}
+
+func (b buzzer) SetNote(note uint8) {
+	b.Speaker.SetNote(tone.Note(note))
+}
+
+func redraw(tunes []*rtttl.Tune, selected, playing int, note string, elapsed time.Duration) {
+	display.ClearBuffer()
+
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 12, "RTTTL "+strconv.Itoa(selected+1)+"/"+strconv.Itoa(len(tunes)), white)
+
+	// 選択中の曲が見えるようにスクロールする
+	first := 0
+	if selected >= listLines {
+		first = selected - listLines + 1
+	}
+	for i := first; i < len(tunes) && i < first+listLines; i++ {
+		y := int16(12 * (i - first + 2))
+		if i == selected {
+			tinyfont.WriteLine(display, &shnm.Shnmk12, 0, y, ">", white)
+		}
+		if i == playing {
+			tinyfont.WriteLine(display, &shnm.Shnmk12, 116, y, "▶", white)
+		}
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 8, y, tunes[i].Name, white)
+	}
+
+	// 再生位置と鳴っている音
+	if playing >= 0 {
+		status := clock(elapsed) + " / " + clock(tunes[playing].Song.Duration)
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 62, status, white)
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 98, 62, note, white)
+	}
+
+	display.Display()
+}
+
+// showError はエラーを画面に表示する
+func showError(err error) {
+	println(err.Error())
+	display.ClearBuffer()
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 12, "エラー", white)
+	msg := err.Error()
+	for y := int16(26); len(msg) > 0 && y <= 62; y += 12 {
+		n := 21
+		if n > len(msg) {
+			n = len(msg)
+		}
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 0, y, msg[:n], white)
+		msg = msg[n:]
+	}
+	display.Display()
+}
+
+// clock は m:ss 形式の文字列を返す
+func clock(d time.Duration) string {
+	s := int(d / time.Second)
+	sec := strconv.Itoa(s % 60)
+	if len(sec) < 2 {
+		sec = "0" + sec
+	}
+	return strconv.Itoa(s/60) + ":" + sec
+}
+
+func wrap(v, n int) int {
+	return ((v % n) + n) % n
+}
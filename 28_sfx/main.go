@@ -0,0 +1,203 @@
+package main
+
+// 効果音 (sfx) をブザーで鳴らす
+//
+// キー 1 から 10             : それぞれの効果音を鳴らす (割り当てのないキーは Error)
+// ロータリーエンコーダー       : 効果音を選ぶ (選ぶたびに Blip)
+// ロータリーエンコーダーボタン : 選んだ効果音を鳴らす
+// ジョイスティックボタン       : ミュート / ミュート解除
+//
+// 3V3 と EX01 に圧電ブザーを接続する
+//
+// | EX01 | EX03 | 3V3 | SDA0 | 3V3 | 3V3 |     |        GROVE            |
+// | EX02 | EX04 | GND | SCL0 | GND | GND | - - | GND | 3V3 | SDA0 | SCL0 |
+
+import (
+	"image/color"
+	"machine"
+	"strconv"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/jukebox"
+	"github.com/tinygo-keeb/workshop/keylayout"
+	"github.com/tinygo-keeb/workshop/sfx"
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/encoders"
+	"tinygo.org/x/drivers/ssd1306"
+	"tinygo.org/x/tinyfont"
+	"tinygo.org/x/tinyfont/shnm"
+)
+
+var (
+	white   = color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	display *ssd1306.Device
+)
+
+// 一度に表示できる効果音の数
+const listLines = 3
+
+// キーマトリクス
+var (
+	colPins = []machine.Pin{machine.GPIO5, machine.GPIO6, machine.GPIO7, machine.GPIO8}
+	rowPins = []machine.Pin{machine.GPIO9, machine.GPIO10, machine.GPIO11}
+)
+
+func main() {
+	machine.I2C0.Configure(machine.I2CConfig{
+		Frequency: 2.8 * machine.MHz,
+		SDA:       machine.GPIO12,
+		SCL:       machine.GPIO13,
+	})
+
+	display = ssd1306.NewI2C(machine.I2C0)
+	display.Configure(ssd1306.Config{
+		Address: 0x3C,
+		Width:   128,
+		Height:  64,
+	})
+	display.SetRotation(drivers.Rotation180)
+	display.ClearDisplay()
+
+	for _, c := range colPins {
+		c.Configure(machine.PinConfig{Mode: machine.PinOutput})
+		c.Low()
+	}
+	for _, r := range rowPins {
+		r.Configure(machine.PinConfig{Mode: machine.PinInputPulldown})
+	}
+
+	speaker, err := jukebox.NewSpeaker(machine.PWM7, machine.GPIO14)
+	if err != nil {
+		println("failed to configure PWM")
+		return
+	}
+	// 効果音はバックグラウンドで鳴るので、鳴っている間もキーを読める
+	effects := sfx.NewPlayer(jukebox.New(speaker, nil))
+
+	rotaryButton := machine.GPIO2
+	rotaryButton.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	prevRotaryButton := rotaryButton.Get()
+
+	muteButton := machine.GPIO0
+	muteButton.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	prevMuteButton := muteButton.Get()
+
+	rotaryEncoder := encoders.NewQuadratureViaInterrupt(
+		machine.GPIO3,
+		machine.GPIO4,
+	)
+	rotaryEncoder.Configure(encoders.QuadratureConfig{
+		Precision: 4,
+	})
+	encOldValue := 0
+
+	selected := 0 // 選択中の効果音
+	last := ""    // 最後に鳴らした効果音
+	var keys [keylayout.Len]bool
+
+	play := func(e *sfx.Effect) {
+		effects.Play(e)
+		if !effects.Muted() {
+			last = e.Name
+		}
+	}
+
+	redraw(effects, selected, last)
+	for {
+		changed := false
+
+		// 効果音を選ぶ
+		if newValue := rotaryEncoder.Position(); newValue != encOldValue {
+			selected = wrap(selected+newValue-encOldValue, len(sfx.Presets))
+			encOldValue = newValue
+			play(sfx.Blip)
+			changed = true
+		}
+
+		// 選んだ効果音を鳴らす
+		currentRotaryButton := rotaryButton.Get()
+		if prevRotaryButton && !currentRotaryButton {
+			play(sfx.Presets[selected])
+			changed = true
+		}
+		prevRotaryButton = currentRotaryButton
+
+		// ミュート / ミュート解除 (解除したときは Confirm で知らせる)
+		currentMuteButton := muteButton.Get()
+		if prevMuteButton && !currentMuteButton {
+			effects.SetMuted(!effects.Muted())
+			play(sfx.Confirm)
+			changed = true
+		}
+		prevMuteButton = currentMuteButton
+
+		// キーを押したら、その番号の効果音を鳴らす
+		for i, pressed := range scanKeys() {
+			if pressed && !keys[i] {
+				k := keylayout.Keys[i]
+				if k.Switch <= len(sfx.Presets) {
+					play(sfx.Presets[k.Switch-1])
+				} else {
+					play(sfx.Error)
+				}
+				changed = true
+			}
+			keys[i] = pressed
+		}
+
+		if changed {
+			redraw(effects, selected, last)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// scanKeys はキーマトリクスを読み、押されているキーを返す
+func scanKeys() [keylayout.Len]bool {
+	var pressed [keylayout.Len]bool
+	for c, col := range colPins {
+		col.High()
+		time.Sleep(1 * time.Millisecond)
+		for r, row := range rowPins {
+			pressed[c*len(rowPins)+r] = row.Get()
+		}
+		col.Low()
+	}
+	return pressed
+}
+
+func redraw(effects *sfx.Player, selected int, last string) {
+	display.ClearBuffer()
+
+	title := "SFX " + strconv.Itoa(selected+1) + "/" + strconv.Itoa(len(sfx.Presets))
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 12, title, white)
+	if effects.Muted() {
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 80, 12, "ミュート", white)
+	}
+
+	// 選択中の効果音が見えるようにスクロールする
+	first := 0
+	if selected >= listLines {
+		first = selected - listLines + 1
+	}
+	for i := first; i < len(sfx.Presets) && i < first+listLines; i++ {
+		y := int16(12 * (i - first + 2))
+		if i == selected {
+			tinyfont.WriteLine(display, &shnm.Shnmk12, 0, y, ">", white)
+		}
+		e := sfx.Presets[i]
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 8, y, e.Name, white)
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 86, y, strconv.Itoa(int(e.Duration()/time.Millisecond))+"ms", white)
+	}
+
+	// 最後に鳴らした効果音
+	if last != "" {
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 62, "♪ "+last, white)
+	}
+
+	display.Display()
+}
+
+func wrap(v, n int) int {
+	return ((v % n) + n) % n
+}
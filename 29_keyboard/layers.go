@@ -0,0 +1,109 @@
+package main
+
+import (
+	"machine/usb/hid/keyboard"
+
+	"github.com/tinygo-keeb/workshop/keymap"
+)
+
+// キーの位置 (0 から 11 は SW1 から SW12)
+const (
+	posEncoderButton = 12 + iota // ロータリーエンコーダーボタン
+	posEncoderCW                 // ロータリーエンコーダーを右に回す
+	posEncoderCCW                // ロータリーエンコーダーを左に回す
+	posStickButton               // ジョイスティックボタン
+	posStickUp                   // ジョイスティック上
+	posStickDown                 // ジョイスティック下
+	posStickLeft                 // ジョイスティック左
+	posStickRight                // ジョイスティック右
+
+	keyCount
+)
+
+// レイヤー番号 (大きいほど上に重なる)
+const (
+	layerNumpad = iota
+	layerGame
+	layerNav
+	layerMacro
+	layerSym
+	layerFn
+)
+
+// 省略形
+var (
+	____  = keymap.Trans
+	ctrl  = keyboard.KeyModifierCtrl
+	shift = keyboard.KeyModifierShift
+)
+
+func key(code keyboard.Keycode, mods ...keyboard.Keycode) keymap.Action {
+	return keymap.Key(code, mods...)
+}
+
+// layer はキー 12 個とその他の入力 8 個からレイヤーを作る
+// キーは基板の SW 番号の順 (上の段の左から右、中段、下段) に並べる
+func layer(name string, keys [12]keymap.Action, extra [keyCount - 12]keymap.Action) keymap.Layer {
+	return keymap.Layer{Name: name, Keys: append(keys[:], extra[:]...)}
+}
+
+// ロータリーエンコーダーとジョイスティック
+// エンコーダーボタンで Nav を切り替え、ジョイスティックボタンで次の 1 キーだけ Sym にする
+var baseExtra = [keyCount - 12]keymap.Action{
+	keymap.TG(layerNav), key(keyboard.KeyTab), key(keyboard.KeyTab, shift),
+	keymap.OSL(layerSym), key(keyboard.KeyUp), key(keyboard.KeyDown), key(keyboard.KeyLeft), key(keyboard.KeyRight),
+}
+
+var layers = []keymap.Layer{
+	// テンキー (最初のデフォルトレイヤー)
+	layerNumpad: layer("Numpad", [12]keymap.Action{
+		key(keyboard.Key7), key(keyboard.Key8), key(keyboard.Key9), key(keyboard.Key0),
+		key(keyboard.Key4), key(keyboard.Key5), key(keyboard.Key6), key(keyboard.KeyEnter),
+		key(keyboard.Key1), key(keyboard.Key2), key(keyboard.Key3), keymap.MO(layerFn),
+	}, baseExtra),
+
+	// ゲーム用 (Fn で Numpad と切り替えるデフォルトレイヤー)
+	layerGame: layer("Game", [12]keymap.Action{
+		key(keyboard.KeyQ), key(keyboard.KeyW), key(keyboard.KeyE), key(keyboard.KeyR),
+		key(keyboard.KeyA), key(keyboard.KeyS), key(keyboard.KeyD), key(keyboard.KeyF),
+		key(shift), key(keyboard.KeySpace), key(ctrl), keymap.MO(layerFn),
+	}, baseExtra),
+
+	// カーソル移動と編集 (____ は下のレイヤーのキーをそのまま使う)
+	layerNav: layer("Nav", [12]keymap.Action{
+		key(keyboard.KeyHome), key(keyboard.KeyUp), key(keyboard.KeyEnd), key(keyboard.KeyPageUp),
+		key(keyboard.KeyLeft), key(keyboard.KeyDown), key(keyboard.KeyRight), key(keyboard.KeyPageDown),
+		key(keyboard.KeyX, ctrl), key(keyboard.KeyC, ctrl), key(keyboard.KeyV, ctrl), ____,
+	}, [keyCount - 12]keymap.Action{
+		____, key(keyboard.KeyRight, ctrl), key(keyboard.KeyLeft, ctrl),
+		____, ____, ____, ____, ____,
+	}),
+
+	// マクロ (Fn + ジョイスティックボタンでオン / オフ)
+	layerMacro: layer("Macro", [12]keymap.Action{
+		keymap.M(macroEmail), keymap.M(macroSignature), keymap.M(macroSymbols), keymap.M(macroGoRun),
+		keymap.M(macroFlash), keymap.M(macroCopyAll), keymap.M(macroSelectLine), keymap.M(macroTerminal),
+		keymap.M(macroHello), keymap.M(macroUnicode), keymap.M(macroLayout), ____,
+	}, [keyCount - 12]keymap.Action{
+		____, ____, ____, ____, ____, ____, ____, ____,
+	}),
+
+	// 記号
+	layerSym: layer("Sym", [12]keymap.Action{
+		key(keyboard.KeyMinus), key(keyboard.KeyEqual), key(keyboard.KeyLeftBrace), key(keyboard.KeyRightBrace),
+		key(keyboard.KeySemicolon), key(keyboard.KeyQuote), key(keyboard.KeyComma), key(keyboard.KeyPeriod),
+		key(keyboard.KeySlash), key(keyboard.Key1, shift), key(keyboard.KeyBackspace), ____,
+	}, [keyCount - 12]keymap.Action{
+		____, ____, ____, ____, ____, ____, ____, ____,
+	}),
+
+	// ファンクションキーとレイヤーの切り替え (SW12 を押している間)
+	layerFn: layer("Fn", [12]keymap.Action{
+		key(keyboard.KeyF1), key(keyboard.KeyF2), key(keyboard.KeyF3), key(keyboard.KeyF4),
+		key(keyboard.KeyF5), key(keyboard.KeyF6), key(keyboard.KeyF7), key(keyboard.KeyF8),
+		keymap.DF(layerNumpad), keymap.DF(layerGame), key(keyboard.KeyEsc), ____,
+	}, [keyCount - 12]keymap.Action{
+		____, key(keyboard.KeyF9), key(keyboard.KeyF10),
+		keymap.TG(layerMacro), ____, ____, ____, ____,
+	}),
+}
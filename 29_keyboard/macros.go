@@ -0,0 +1,85 @@
+package main
+
+import (
+	"machine/usb/hid/keyboard"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/macro"
+)
+
+// マクロ番号 (keymap.M で指定する)
+const (
+	macroEmail      = iota // メールアドレスを入力する
+	macroSignature         // 署名を入力する
+	macroSymbols           // 記号を入力する (キー配列の確認用)
+	macroGoRun             // go run . を実行する
+	macroFlash             // tinygo flash を実行する
+	macroCopyAll           // 全部選択してコピーする
+	macroSelectLine        // 行を選択する (Shift を押したまま)
+	macroTerminal          // 端末を開いて作業ディレクトリに移動する
+	macroHello             // 日本語を入力する (17_oled_japanese_font と同じ文字列)
+
+	macroLayout  // ホストのキー配列 (US / JIS) を切り替える
+	macroUnicode // 日本語の入力方法 (ホストの OS) を切り替える
+)
+
+var macros = []macro.Macro{
+	macroEmail: {Name: "Email", Steps: []macro.Step{
+		macro.Text("gopher@example.com"),
+	}},
+	macroSignature: {Name: "Signature", Steps: []macro.Step{
+		macro.Text("--\nTinyGo Keeb Workshop\nhttps://github.com/tinygo-keeb/workshop\n"),
+	}},
+	macroSymbols: {Name: "Symbols", Steps: []macro.Step{
+		macro.Text(`!"#$%&'()=~|-^\@[]{};:+*,.<>/?_` + "`"),
+	}},
+	macroGoRun: {Name: "go run", Steps: []macro.Step{
+		macro.Text("go run .\n"),
+	}},
+	macroFlash: {Name: "flash", Steps: []macro.Step{
+		macro.Text("tinygo flash --target waveshare-rp2040-zero --size short .\n"),
+	}},
+	macroCopyAll: {Name: "Copy all", Steps: []macro.Step{
+		macro.Tap(keyboard.KeyA, ctrl),
+		macro.Delay(50 * time.Millisecond),
+		macro.Tap(keyboard.KeyC, ctrl),
+	}},
+	macroSelectLine: {Name: "Select line", Steps: []macro.Step{
+		macro.Tap(keyboard.KeyHome),
+		macro.Down(shift),
+		macro.Tap(keyboard.KeyEnd),
+		macro.Up(shift),
+	}},
+	macroTerminal: {Name: "Terminal", Steps: []macro.Step{
+		macro.Tap(keyboard.KeyT, ctrl, keyboard.KeyModifierAlt),
+		macro.Delay(1 * time.Second), // 端末が開くのを待つ
+		macro.Text("cd ~/workshop\n"),
+	}},
+	macroHello: {Name: "Hello", Steps: []macro.Step{
+		// Romaji では漢字を読みから変換する
+		macro.Text("こんにちは"),
+		macro.Reading("世界", "せかい"),
+	}},
+}
+
+// macroRunner は macroLayout と macroUnicode で設定を切り替え、それ以外のマクロを実行する
+type macroRunner struct {
+	*macro.Runner
+}
+
+func (m macroRunner) Run(id int) {
+	switch id {
+	case macroLayout:
+		next := macro.Layouts[0]
+		for i, l := range macro.Layouts {
+			if l == m.Layout {
+				next = macro.Layouts[(i+1)%len(macro.Layouts)]
+			}
+		}
+		m.Layout = next
+	case macroUnicode:
+		m.Unicode = macro.Unicodes[(int(m.Unicode)+1)%len(macro.Unicodes)]
+	default:
+		m.Runner.Run(id)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+// レイヤー付きの USB キーボード
+//
+// 12 個のキー、ロータリーエンコーダー、ジョイスティックにキーを割り当てる (layers.go)
+// OLED には今使っているレイヤーの名前を表示する
+//
+// Numpad / Game : デフォルトレイヤー (Fn + SW9 / SW10 で切り替え)
+// Nav           : ロータリーエンコーダーボタンでオン / オフ
+// Macro         : Fn + ジョイスティックボタンでオン / オフ (macros.go)
+// Sym           : ジョイスティックボタンを押した後の 1 キーだけ
+// Fn            : SW12 を押している間
+//
+// マクロで文字列を入力するときは、ホストのキー配列 (US / JIS) に合わせる
+// Macro レイヤーの SW11 で切り替えて、OLED の表示で確認する
+//
+// 日本語はキーで入力できないので、ホストの OS に合わせた方法で入力する
+// Macro レイヤーの SW10 で切り替える
+//
+// Linux      : Ctrl+Shift+U と 16 進数 (IBus や GTK のアプリ)
+// macOS      : Option を押しながら 16 進数 (入力ソースに「Unicode 16 進入力」を追加する)
+// WinCompose : WinCompose をインストールして、右 Alt を Compose キーにする
+// Romaji     : IME にローマ字で入力する (かな / 英数キーで IME をオン / オフ)
+
+import (
+	"image/color"
+	"machine"
+	"machine/usb/hid/keyboard"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/keylayout"
+	"github.com/tinygo-keeb/workshop/keymap"
+	"github.com/tinygo-keeb/workshop/macro"
+	"tinygo.org/x/drivers"
+	"tinygo.org/x/drivers/encoders"
+	"tinygo.org/x/drivers/ssd1306"
+	"tinygo.org/x/tinyfont"
+	"tinygo.org/x/tinyfont/shnm"
+)
+
+var (
+	white   = color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	display *ssd1306.Device
+)
+
+// 押した / 離したあと、この時間はキーの変化を無視する (チャタリング対策)
+const debounceTime = 20 * time.Millisecond
+
+// キーマトリクス
+var (
+	colPins = []machine.Pin{machine.GPIO5, machine.GPIO6, machine.GPIO7, machine.GPIO8}
+	rowPins = []machine.Pin{machine.GPIO9, machine.GPIO10, machine.GPIO11}
+)
+
+func main() {
+	machine.I2C0.Configure(machine.I2CConfig{
+		Frequency: 2.8 * machine.MHz,
+		SDA:       machine.GPIO12,
+		SCL:       machine.GPIO13,
+	})
+
+	display = ssd1306.NewI2C(machine.I2C0)
+	display.Configure(ssd1306.Config{
+		Address: 0x3C,
+		Width:   128,
+		Height:  64,
+	})
+	display.SetRotation(drivers.Rotation180)
+	display.ClearDisplay()
+
+	for _, c := range colPins {
+		c.Configure(machine.PinConfig{Mode: machine.PinOutput})
+		c.Low()
+	}
+	for _, r := range rowPins {
+		r.Configure(machine.PinConfig{Mode: machine.PinInputPulldown})
+	}
+
+	rotaryButton := machine.GPIO2
+	rotaryButton.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	stickButton := machine.GPIO0
+	stickButton.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+
+	rotaryEncoder := encoders.NewQuadratureViaInterrupt(
+		machine.GPIO3,
+		machine.GPIO4,
+	)
+	rotaryEncoder.Configure(encoders.QuadratureConfig{
+		Precision: 4,
+	})
+	encOldValue := 0
+
+	machine.InitADC()
+	ax := machine.ADC{Pin: machine.GPIO29}
+	ax.Configure(machine.ADCConfig{})
+	ay := machine.ADC{Pin: machine.GPIO28}
+	ay.Configure(machine.ADCConfig{})
+
+	km := keymap.New(keyboard.Port(), keyCount, layers...)
+	runner := macro.NewRunner(keyboard.Port(), macros...)
+	km.SetMacros(macroRunner{runner})
+
+	// 押されているかどうかと、最後に変わった時刻 (キーの位置ごと)
+	var held [keyCount]bool
+	var changed [keyCount]time.Time
+	set := func(pos int, pressed bool) {
+		if pressed == held[pos] {
+			return
+		}
+		now := time.Now()
+		if now.Sub(changed[pos]) < debounceTime {
+			return
+		}
+		held[pos] = pressed
+		changed[pos] = now
+		if pressed {
+			km.Press(pos)
+		} else {
+			km.Release(pos)
+		}
+	}
+
+	shown := ""
+	for {
+		// キーマトリクス (走査順から SW 番号の順に並べ替える)
+		for i, pressed := range scanKeys() {
+			set(keylayout.Keys[i].Switch-1, pressed)
+		}
+
+		set(posEncoderButton, !rotaryButton.Get())
+		set(posStickButton, !stickButton.Get())
+
+		x, y := ax.Get(), ay.Get()
+		set(posStickUp, 0xA000 < y)
+		set(posStickDown, y < 0x6000)
+		set(posStickLeft, x < 0x6000)
+		set(posStickRight, 0xA000 < x)
+
+		// ロータリーエンコーダーは 1 クリックごとにキーを 1 回押す
+		if newValue := rotaryEncoder.Position(); newValue != encOldValue {
+			for ; newValue < encOldValue; encOldValue-- {
+				km.Tap(posEncoderCW)
+			}
+			for ; newValue > encOldValue; encOldValue++ {
+				km.Tap(posEncoderCCW)
+			}
+		}
+
+		// マクロのキーを少しずつ送る
+		runner.Update(time.Now())
+
+		// レイヤーかキー配列が変わったら表示し直す
+		if s := status(km, runner); s != shown {
+			redraw(km, runner)
+			shown = s
+		}
+	}
+}
+
+// scanKeys はキーマトリクスを読み、押されているキーを返す
+func scanKeys() [keylayout.Len]bool {
+	var pressed [keylayout.Len]bool
+	for c, col := range colPins {
+		col.High()
+		time.Sleep(1 * time.Millisecond)
+		for r, row := range rowPins {
+			pressed[c*len(rowPins)+r] = row.Get()
+		}
+		col.Low()
+	}
+	return pressed
+}
+
+// status は表示する内容をまとめた文字列を返す
+func status(km *keymap.Keymap, runner *macro.Runner) string {
+	s := km.Name(km.Top()) + "/" + km.Name(km.Default()) + "/" + runner.Layout.Name + "/" + runner.Unicode.String()
+	if km.Toggled(layerNav) {
+		s += "/TG"
+	}
+	if l := km.OneShot(); l >= 0 {
+		s += "/" + km.Name(l)
+	}
+	return s
+}
+
+func redraw(km *keymap.Keymap, runner *macro.Runner) {
+	display.ClearBuffer()
+
+	// 今使っているレイヤー
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 12, "Layer", white)
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 40, 12, km.Name(km.Top()), white)
+
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 28, "Default", white)
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 52, 28, km.Name(km.Default()), white)
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 104, 28, runner.Layout.Name, white)
+
+	if km.Toggled(layerNav) {
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 44, "TG "+km.Name(layerNav), white)
+	}
+	if l := km.OneShot(); l >= 0 {
+		tinyfont.WriteLine(display, &shnm.Shnmk12, 64, 44, "OSL "+km.Name(l), white)
+	}
+
+	// 日本語の入力方法
+	tinyfont.WriteLine(display, &shnm.Shnmk12, 0, 60, "日本語 "+runner.Unicode.String(), white)
+
+	display.Display()
+}
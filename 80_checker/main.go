@@ -5,6 +5,7 @@ import (
 	"machine"
 	"time"
 
+	"github.com/tinygo-keeb/workshop/keylayout"
 	pio "github.com/tinygo-org/pio/rp2-pio"
 	"github.com/tinygo-org/pio/rp2-pio/piolib"
 	"tinygo.org/x/drivers"
@@ -335,30 +336,9 @@ func Triangle(b bool, d drivers.Displayer, x0 int16, y0 int16, x1 int16, y1 int1
 }
 
 func rkIndex(idx int) int {
+	n := len(keylayout.Ring)
 	for idx < 0 {
-		idx += 10
+		idx += n
 	}
-	switch idx % 10 {
-	case 0:
-		idx = 0
-	case 1:
-		idx = 1
-	case 2:
-		idx = 2
-	case 3:
-		idx = 5
-	case 4:
-		idx = 8
-	case 5:
-		idx = 11
-	case 6:
-		idx = 10
-	case 7:
-		idx = 9
-	case 8:
-		idx = 6
-	case 9:
-		idx = 3
-	}
-	return idx
+	return keylayout.Ring[idx%n]
 }
@@ -4,6 +4,7 @@ import (
 	"machine"
 	"time"
 
+	"github.com/tinygo-keeb/workshop/ledcolor"
 	pio "github.com/tinygo-org/pio/rp2-pio"
 	"github.com/tinygo-org/pio/rp2-pio/piolib"
 )
@@ -18,19 +19,24 @@ func NewWS2812B(pin machine.Pin) *piolib.WS2812B {
 func main() {
 	// 16 random colors
 	randCol := 0
-	randColors := [16]uint32{
-		0xFF00FF00, 0xFF0000FF, 0xFFFF0000, 0xFFFFFF00,
-		0xFFFF00FF, 0xFF00FFFF, 0xFF800000, 0xFF008000,
-		0xFF000080, 0xFF808000, 0xFF800080, 0xFF008080,
-		0xFFC00000, 0xFF00C000, 0xFF0000C0, 0xFFC000C0,
+	randColors := [16]ledcolor.RGB{
+		ledcolor.Green, ledcolor.Blue, ledcolor.Red, ledcolor.Yellow,
+		ledcolor.Magenta, ledcolor.Cyan, {R: 0x80}, {G: 0x80},
+		{B: 0x80}, {R: 0x80, G: 0x80}, {R: 0x80, B: 0x80}, {G: 0x80, B: 0x80},
+		{R: 0xC0}, {G: 0xC0}, {B: 0xC0}, {R: 0xC0, B: 0xC0},
 	}
 
-	colors := []uint32{
-		0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF,
-		0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF,
-		0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFF,
+	colors := []ledcolor.RGB{
+		ledcolor.White, ledcolor.White, ledcolor.White, ledcolor.White,
+		ledcolor.White, ledcolor.White, ledcolor.White, ledcolor.White,
+		ledcolor.White, ledcolor.White, ledcolor.White, ledcolor.White,
 	}
 
+	// GRB packing and a current budget so that all 12 LEDs do not draw too
+	// much from USB. Gamma is off to keep the fade as it was.
+	strip := ledcolor.NewStrip(len(colors))
+	strip.Gamma = false
+
 	ws := NewWS2812B(machine.GPIO1)
 
 	colPins := []machine.Pin{
@@ -66,13 +72,10 @@ func main() {
 			colors[key] = randColors[randCol%16]
 		case <-decay.C:
 			for i := range colors {
-				g := ((colors[i] >> 24) & 0xFF) >> 1
-				r := ((colors[i] >> 16) & 0xFF) >> 1
-				b := ((colors[i] >> 8) & 0xFF) >> 1
-				colors[i] = (g << 24) | (r << 16) | (b << 8) | 0
+				colors[i] = colors[i].Lerp(ledcolor.Black, 128)
 			}
 		case <-update.C:
-			ws.WriteRaw(colors)
+			ws.WriteRaw(strip.Render(colors))
 		default:
 			// COL1
 			colPins[0].High()
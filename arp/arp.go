@@ -0,0 +1,252 @@
+// Package arp is an arpeggiator driven by MIDI clock ticks (24 per quarter
+// note). Feed it the held keys with NoteOn and NoteOff and call Tick for
+// every clock tick; it reports the notes to start and stop.
+package arp
+
+// Mode is the order in which the held notes are played.
+type Mode int
+
+const (
+	Up       Mode = iota // lowest to highest
+	Down                 // highest to lowest
+	UpDown               // up then down, without repeating the ends
+	Random               // random held note
+	AsPlayed             // in the order the keys were pressed
+)
+
+var modeNames = []string{"Up", "Down", "UpDown", "Random", "Played"}
+
+func (m Mode) String() string {
+	if m < 0 || int(m) >= len(modeNames) {
+		return "?"
+	}
+	return modeNames[m]
+}
+
+// Rate is the length of one arpeggio step.
+type Rate int
+
+const (
+	Eighth           Rate = iota // 1/8
+	Sixteenth                    // 1/16
+	EighthTriplet                // 1/8 triplet
+	SixteenthTriplet             // 1/16 triplet
+)
+
+var (
+	rateNames = []string{"1/8", "1/16", "1/8T", "1/16T"}
+	rateTicks = []int{12, 6, 8, 4}
+)
+
+func (r Rate) String() string {
+	if r < 0 || int(r) >= len(rateNames) {
+		return "?"
+	}
+	return rateNames[r]
+}
+
+// Ticks returns the length of a step in clock ticks.
+func (r Rate) Ticks() int {
+	if r < 0 || int(r) >= len(rateTicks) {
+		return rateTicks[Sixteenth]
+	}
+	return rateTicks[r]
+}
+
+// Arp is an arpeggiator. The zero value plays 1/8 notes upwards over one
+// octave with a 50% gate.
+type Arp struct {
+	Mode    Mode
+	Rate    Rate
+	Octaves int  // octave range, 1 to 4
+	Gate    int  // note length in percent of a step, 1 to 100; 0 means 50
+	Latch   bool // keep playing after the keys are released
+
+	held    []uint8 // keys physically held, in press order
+	notes   []uint8 // note set, in press order
+	step    int     // index of the next step in the sequence
+	playing uint8   // sounding note
+	sounds  bool
+	offAt   int // tick at which the sounding note stops
+	seed    uint32
+}
+
+// NoteOn adds a held key.
+func (a *Arp) NoteOn(note uint8) {
+	if a.Latch && len(a.held) == 0 {
+		// first key after releasing everything starts a new latched set
+		a.notes = a.notes[:0]
+		a.step = 0
+	}
+	a.held = appendUnique(a.held, note)
+	a.notes = appendUnique(a.notes, note)
+}
+
+// NoteOff releases a held key.
+func (a *Arp) NoteOff(note uint8) {
+	a.held = remove(a.held, note)
+	if !a.Latch {
+		a.notes = remove(a.notes, note)
+	}
+}
+
+// SetLatch turns latch on or off. Turning it off drops the notes whose keys
+// are no longer held.
+func (a *Arp) SetLatch(latch bool) {
+	a.Latch = latch
+	if !latch {
+		a.notes = append(a.notes[:0], a.held...)
+	}
+}
+
+// Notes returns the note set in press order.
+func (a *Arp) Notes() []uint8 {
+	return a.notes
+}
+
+// Sounding returns the note that is playing.
+func (a *Arp) Sounding() (note uint8, ok bool) {
+	return a.playing, a.sounds
+}
+
+// Tick advances the arpeggiator to clock tick and calls emit for the notes
+// to stop (on false) and start (on true). Ticks must be passed in order.
+func (a *Arp) Tick(tick int, emit func(note uint8, on bool)) {
+	if a.sounds && tick >= a.offAt {
+		a.sounds = false
+		emit(a.playing, false)
+	}
+
+	rate := a.Rate.Ticks()
+	if tick%rate != 0 {
+		return
+	}
+	seq := a.sequence()
+	if len(seq) == 0 {
+		a.step = 0
+		return
+	}
+	if a.sounds {
+		a.sounds = false
+		emit(a.playing, false)
+	}
+
+	var note uint8
+	if a.Mode == Random {
+		note = seq[a.random()%uint32(len(seq))]
+	} else {
+		note = seq[a.step%len(seq)]
+	}
+	a.step = (a.step + 1) % len(seq)
+
+	gate := a.Gate
+	if gate <= 0 {
+		gate = 50
+	} else if gate > 100 {
+		gate = 100
+	}
+	length := rate * gate / 100
+	if length < 1 {
+		length = 1
+	}
+	if gate == 100 {
+		// legato: stop just before the next note starts
+		length = rate
+	}
+
+	a.playing = note
+	a.sounds = true
+	a.offAt = tick + length
+	emit(note, true)
+}
+
+// Stop stops the sounding note and forgets the note set.
+func (a *Arp) Stop(emit func(note uint8, on bool)) {
+	if a.sounds {
+		a.sounds = false
+		emit(a.playing, false)
+	}
+	a.held = a.held[:0]
+	a.notes = a.notes[:0]
+	a.step = 0
+}
+
+// sequence returns the notes of one cycle of the arpeggio.
+func (a *Arp) sequence() []uint8 {
+	if len(a.notes) == 0 {
+		return nil
+	}
+	octaves := a.Octaves
+	if octaves < 1 {
+		octaves = 1
+	} else if octaves > 4 {
+		octaves = 4
+	}
+
+	base := append([]uint8(nil), a.notes...)
+	if a.Mode != AsPlayed {
+		sortNotes(base)
+	}
+	seq := make([]uint8, 0, len(base)*octaves*2)
+	for o := 0; o < octaves; o++ {
+		for _, n := range base {
+			if v := int(n) + 12*o; v <= 127 {
+				seq = append(seq, uint8(v))
+			}
+		}
+	}
+
+	switch a.Mode {
+	case Down:
+		reverse(seq)
+	case UpDown:
+		for i := len(seq) - 2; i > 0; i-- {
+			seq = append(seq, seq[i])
+		}
+	}
+	return seq
+}
+
+// random is a xorshift generator so that the package does not depend on
+// math/rand.
+func (a *Arp) random() uint32 {
+	if a.seed == 0 {
+		a.seed = 2463534242
+	}
+	a.seed ^= a.seed << 13
+	a.seed ^= a.seed >> 17
+	a.seed ^= a.seed << 5
+	return a.seed
+}
+
+func appendUnique(s []uint8, n uint8) []uint8 {
+	for _, m := range s {
+		if m == n {
+			return s
+		}
+	}
+	return append(s, n)
+}
+
+func remove(s []uint8, n uint8) []uint8 {
+	for i, m := range s {
+		if m == n {
+			return append(s[:i], s[i+1:]...)
+		}
+	}
+	return s
+}
+
+func sortNotes(s []uint8) {
+	for i := 1; i < len(s); i++ {
+		for j := i; j > 0 && s[j] < s[j-1]; j-- {
+			s[j], s[j-1] = s[j-1], s[j]
+		}
+	}
+}
+
+func reverse(s []uint8) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
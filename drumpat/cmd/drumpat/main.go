@@ -0,0 +1,381 @@
+// Command drumpat checks drum pattern files and converts them to and from
+// the DrumPattern literals used by 21_midi2.
+//
+//	drumpat check patterns.drum ...
+//	drumpat gen [-o patterns_gen.go] [-pkg main] [-var drumPatterns] patterns.drum ...
+//	drumpat import [-o patterns.drum] main.go ...
+//
+// gen is meant to be run from go:generate so that the patterns are compiled
+// into the firmware. import reads DrumPattern composite literals from Go
+// source and prints them in the text format.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tinygo-keeb/workshop/drumpat"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "  drumpat check FILE...")
+	fmt.Fprintln(os.Stderr, "  drumpat gen [-o FILE] [-pkg NAME] [-var NAME] FILE...")
+	fmt.Fprintln(os.Stderr, "  drumpat import [-o FILE] FILE.go...")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "check":
+		err = check(os.Args[2:])
+	case "gen":
+		err = gen(os.Args[2:])
+	case "import":
+		err = importGo(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "drumpat:", err)
+		os.Exit(1)
+	}
+}
+
+// readPatterns parses and validates pattern files.
+func readPatterns(files []string) ([]drumpat.Pattern, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no input files")
+	}
+	var all []drumpat.Pattern
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		patterns, err := drumpat.Parse(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, p := range patterns {
+			if err := p.Validate(); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			for _, q := range all {
+				if q.Name == p.Name {
+					return nil, fmt.Errorf("%s: duplicate pattern %s", file, p.Name)
+				}
+			}
+			all = append(all, p)
+		}
+	}
+	return all, nil
+}
+
+func check(args []string) error {
+	patterns, err := readPatterns(args)
+	if err != nil {
+		return err
+	}
+	for _, p := range patterns {
+		fmt.Printf("%-16s %3d bpm  swing %2d  %2d steps  %d voices\n", p.Name, p.Tempo, p.Swing, len(p.Steps), len(p.Voices()))
+	}
+	return nil
+}
+
+func gen(args []string) error {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	out := fs.String("o", "", "output file (default stdout)")
+	pkg := fs.String("pkg", "main", "package name")
+	name := fs.String("var", "drumPatterns", "variable name")
+	fs.Parse(args)
+
+	patterns, err := readPatterns(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	var sources []string
+	for _, f := range fs.Args() {
+		sources = append(sources, filepath.Base(f))
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by drumpat from %s; DO NOT EDIT.\n\n", strings.Join(sources, ", "))
+	fmt.Fprintf(&b, "package %s\n\n", *pkg)
+	fmt.Fprintf(&b, "var %s = []DrumPattern{\n", *name)
+	for _, p := range patterns {
+		fmt.Fprintf(&b, "{\n")
+		fmt.Fprintf(&b, "Name: %q,\n", p.Name)
+		fmt.Fprintf(&b, "Steps: [][]uint8{\n")
+		for i, step := range p.Steps {
+			names := make([]string, len(step))
+			for j, n := range step {
+				v, _ := drumpat.VoiceByNote(n)
+				names[j] = v.Name
+			}
+			fmt.Fprintf(&b, "{%s}, // %d\n", strings.Join(names, ", "), i+1)
+		}
+		fmt.Fprintf(&b, "},\n")
+		fmt.Fprintf(&b, "StepLen: 60000 / %d / 4,\n", p.Tempo)
+		fmt.Fprintf(&b, "Swing: %d,\n", p.Swing)
+		fmt.Fprintf(&b, "},\n")
+	}
+	fmt.Fprintf(&b, "}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(*out, src, 0o644)
+}
+
+func importGo(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	out := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("no input files")
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range fs.Args() {
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	imp := &importer{fset: fset, consts: map[string]ast.Expr{}}
+	for _, f := range files {
+		imp.collectConsts(f)
+	}
+	for _, f := range files {
+		if err := imp.collectPatterns(f); err != nil {
+			return err
+		}
+	}
+	if len(imp.patterns) == 0 {
+		return errors.New("no DrumPattern literals found")
+	}
+
+	var b strings.Builder
+	b.WriteString("# Imported from " + strings.Join(fs.Args(), ", ") + " by drumpat.\n\n")
+	b.WriteString(drumpat.Format(imp.patterns))
+	if *out == "" {
+		_, err := os.Stdout.WriteString(b.String())
+		return err
+	}
+	return os.WriteFile(*out, []byte(b.String()), 0o644)
+}
+
+type importer struct {
+	fset     *token.FileSet
+	consts   map[string]ast.Expr
+	patterns []drumpat.Pattern
+}
+
+// collectConsts remembers the constants declared with a value so that names
+// such as BassDrum and bpm can be evaluated.
+func (imp *importer) collectConsts(f *ast.File) {
+	for _, decl := range f.Decls {
+		g, ok := decl.(*ast.GenDecl)
+		if !ok || g.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range g.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if i < len(vs.Values) {
+					imp.consts[name.Name] = vs.Values[i]
+				}
+			}
+		}
+	}
+}
+
+// collectPatterns finds DrumPattern{...} literals, including the elided ones
+// in []DrumPattern{...}, in source order.
+func (imp *importer) collectPatterns(f *ast.File) error {
+	var err error
+	ast.Inspect(f, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok || err != nil {
+			return err == nil
+		}
+		if isIdent(lit.Type, "DrumPattern") {
+			err = imp.addPattern(lit)
+			return false
+		}
+		if at, ok := lit.Type.(*ast.ArrayType); ok && isIdent(at.Elt, "DrumPattern") {
+			for _, e := range lit.Elts {
+				if el, ok := e.(*ast.CompositeLit); ok && el.Type == nil {
+					if err = imp.addPattern(el); err != nil {
+						return false
+					}
+				}
+			}
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+func isIdent(e ast.Expr, name string) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+func (imp *importer) addPattern(lit *ast.CompositeLit) error {
+	p := drumpat.Pattern{Tempo: drumpat.DefaultTempo, Swing: drumpat.StraightSwing}
+	for _, e := range lit.Elts {
+		kv, ok := e.(*ast.KeyValueExpr)
+		if !ok {
+			return imp.errorf(e, "DrumPattern literal must use field names")
+		}
+		key, _ := kv.Key.(*ast.Ident)
+		if key == nil {
+			return imp.errorf(kv, "bad field")
+		}
+		switch key.Name {
+		case "Name":
+			s, ok := kv.Value.(*ast.BasicLit)
+			if !ok || s.Kind != token.STRING {
+				return imp.errorf(kv.Value, "Name must be a string literal")
+			}
+			p.Name, _ = strconv.Unquote(s.Value)
+		case "Steps":
+			steps, err := imp.steps(kv.Value)
+			if err != nil {
+				return err
+			}
+			p.Steps = steps
+		case "StepLen":
+			// StepLen is the length of a sixteenth note in milliseconds,
+			// usually written as 60000 / tempo / 4. Evaluate it exactly so
+			// the tempo survives the integer division.
+			v, err := imp.eval(kv.Value, true)
+			if err != nil {
+				return err
+			}
+			ms, _ := constant.Float64Val(v)
+			if ms <= 0 {
+				return imp.errorf(kv.Value, "StepLen must be positive")
+			}
+			p.Tempo = int(math.Round(60000 / (ms * 4)))
+		case "Swing":
+			v, err := imp.eval(kv.Value, false)
+			if err != nil {
+				return err
+			}
+			swing, _ := constant.Int64Val(v)
+			if swing != 0 {
+				p.Swing = int(swing)
+			}
+		}
+	}
+	if err := p.Validate(); err != nil {
+		return imp.errorf(lit, "%v", err)
+	}
+	imp.patterns = append(imp.patterns, p)
+	return nil
+}
+
+func (imp *importer) steps(e ast.Expr) ([][]uint8, error) {
+	lit, ok := e.(*ast.CompositeLit)
+	if !ok {
+		return nil, imp.errorf(e, "Steps must be a [][]uint8 literal")
+	}
+	steps := make([][]uint8, 0, len(lit.Elts))
+	for _, s := range lit.Elts {
+		step, ok := s.(*ast.CompositeLit)
+		if !ok {
+			return nil, imp.errorf(s, "step must be a []uint8 literal")
+		}
+		notes := []uint8{}
+		for _, n := range step.Elts {
+			v, err := imp.eval(n, false)
+			if err != nil {
+				return nil, err
+			}
+			note, ok := constant.Int64Val(v)
+			if !ok || note < 0 || note > 127 {
+				return nil, imp.errorf(n, "bad note")
+			}
+			notes = append(notes, uint8(note))
+		}
+		steps = append(steps, notes)
+	}
+	return steps, nil
+}
+
+// eval evaluates a constant integer expression. With exact, division is done
+// on rationals instead of truncating integers.
+func (imp *importer) eval(e ast.Expr, exact bool) (constant.Value, error) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.INT {
+			return nil, imp.errorf(e, "expected an integer")
+		}
+		return constant.MakeFromLiteral(e.Value, e.Kind, 0), nil
+	case *ast.ParenExpr:
+		return imp.eval(e.X, exact)
+	case *ast.Ident:
+		if def, ok := imp.consts[e.Name]; ok {
+			return imp.eval(def, exact)
+		}
+		if v, ok := drumpat.VoiceByName(e.Name); ok {
+			return constant.MakeInt64(int64(v.Note)), nil
+		}
+		return nil, imp.errorf(e, "unknown constant %s", e.Name)
+	case *ast.BinaryExpr:
+		x, err := imp.eval(e.X, exact)
+		if err != nil {
+			return nil, err
+		}
+		y, err := imp.eval(e.Y, exact)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case token.ADD, token.SUB, token.MUL:
+			return constant.BinaryOp(x, e.Op, y), nil
+		case token.QUO:
+			if constant.Sign(y) == 0 {
+				return nil, imp.errorf(e, "division by zero")
+			}
+			if exact {
+				return constant.BinaryOp(constant.ToFloat(x), token.QUO, constant.ToFloat(y)), nil
+			}
+			return constant.BinaryOp(x, token.QUO_ASSIGN, y), nil
+		}
+	}
+	return nil, imp.errorf(e, "unsupported expression")
+}
+
+func (imp *importer) errorf(n ast.Node, format string, args ...any) error {
+	return fmt.Errorf("%s: %s", imp.fset.Position(n.Pos()), fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,364 @@
+// Package drumpat reads and writes drum patterns in a compact tracker-like
+// text format, one line per voice:
+//
+//	pattern 8Beat
+//	tempo   100
+//	swing   50
+//	length  16
+//
+//	BD x...x...x...x...
+//	SD ..x...x...x...x.
+//	CH xxx.xxx.xxx.xxx.
+//
+// The cmd/drumpat tool validates pattern files and converts them to and from
+// the DrumPattern literals used by 21_midi2.
+package drumpat
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Voice is a General MIDI drum sound.
+type Voice struct {
+	Abbrev string // two letter name used in pattern files
+	Name   string // Go constant name in 21_midi2
+	Note   uint8  // GM drum note number
+}
+
+// Voices lists the known drum sounds in note order.
+var Voices = []Voice{
+	{"BD", "BassDrum", 36},
+	{"RS", "SideStick", 37},
+	{"SD", "SnareDrum", 38},
+	{"CP", "HandClap", 39},
+	{"ES", "ElectricSnare", 40},
+	{"LF", "LowFloorTom", 41},
+	{"CH", "ClosedHiHat", 42},
+	{"HF", "HighFloorTom", 43},
+	{"PH", "PedalHiHat", 44},
+	{"LT", "LowTom", 45},
+	{"OH", "OpenHiHat", 46},
+	{"LM", "LowMidTom", 47},
+	{"HM", "HighMidTom", 48},
+	{"CC", "CrashCymbal1", 49},
+	{"HT", "HighTom", 50},
+	{"RC", "RideCymbal1", 51},
+	{"CN", "ChineseCymbal", 52},
+	{"RB", "RideBell", 53},
+	{"TB", "Tambourine", 54},
+	{"SC", "SplashCymbal", 55},
+	{"CB", "Cowbell", 56},
+	{"C2", "CrashCymbal2", 57},
+	{"VS", "Vibraslap", 58},
+	{"R2", "RideCymbal2", 59},
+	{"MA", "Maracas", 70},
+	{"CL", "Claves", 75},
+}
+
+// VoiceByAbbrev looks up a voice by its two letter name.
+func VoiceByAbbrev(abbrev string) (Voice, bool) {
+	for _, v := range Voices {
+		if v.Abbrev == abbrev {
+			return v, true
+		}
+	}
+	return Voice{}, false
+}
+
+// VoiceByName looks up a voice by its Go constant name.
+func VoiceByName(name string) (Voice, bool) {
+	for _, v := range Voices {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Voice{}, false
+}
+
+// VoiceByNote looks up a voice by its note number.
+func VoiceByNote(note uint8) (Voice, bool) {
+	for _, v := range Voices {
+		if v.Note == note {
+			return v, true
+		}
+	}
+	return Voice{}, false
+}
+
+const (
+	// DefaultTempo is used when a pattern has no tempo line.
+	DefaultTempo = 120
+	// StraightSwing is the swing of evenly spaced sixteenth notes.
+	StraightSwing = 50
+	// MaxSwing delays every second sixteenth note to a triplet-like feel.
+	MaxSwing = 75
+)
+
+// Pattern is a drum pattern of sixteenth note steps.
+type Pattern struct {
+	Name  string
+	Tempo int       // beats per minute
+	Swing int       // percentage of a pair of steps taken by the first one, 50 to 75
+	Steps [][]uint8 // notes played on each step
+}
+
+// Parse reads the patterns in src. A file may hold several patterns, each
+// starting with a pattern line.
+//
+//	# lines starting with # are comments
+//	pattern DnB 1          # name, may contain spaces
+//	tempo 174              # beats per minute, default 120
+//	swing 50               # 50 (straight) to 75, default 50
+//	length 16              # number of steps, default the length of the rows
+//
+//	# voice  steps (x or X plays, . or - rests, | and spaces are ignored)
+//	BD       x..x|....|..x.|....
+//	SD       ....|x...|....|x...
+//
+// The notes of a step are in the order of the voice lines.
+func Parse(src string) ([]Pattern, error) {
+	var (
+		patterns []Pattern
+		p        *parser
+	)
+	finish := func() error {
+		if p == nil {
+			return nil
+		}
+		pat, err := p.pattern()
+		if err != nil {
+			return errors.New("line " + strconv.Itoa(p.line) + ": " + err.Error())
+		}
+		patterns = append(patterns, pat)
+		return nil
+	}
+
+	for n, line := range strings.Split(src, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if f[0] == "pattern" {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			p = &parser{line: n + 1, name: strings.Join(f[1:], " ")}
+			if p.name == "" {
+				return nil, errors.New("line " + strconv.Itoa(n+1) + ": pattern needs a name")
+			}
+			continue
+		}
+		if p == nil {
+			return nil, errors.New("line " + strconv.Itoa(n+1) + ": expected pattern line")
+		}
+		if err := p.parseLine(f); err != nil {
+			return nil, errors.New("line " + strconv.Itoa(n+1) + ": " + err.Error())
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("no patterns")
+	}
+	return patterns, nil
+}
+
+// MustParse is like Parse but panics on error. It is meant for embedded
+// files that are known to be valid.
+func MustParse(src string) []Pattern {
+	p, err := Parse(src)
+	if err != nil {
+		panic("drumpat: " + err.Error())
+	}
+	return p
+}
+
+type parser struct {
+	line   int // line of the pattern line, for errors
+	name   string
+	tempo  int
+	swing  int
+	length int
+	rows   []row
+}
+
+type row struct {
+	note  uint8
+	steps string
+}
+
+func (p *parser) parseLine(f []string) error {
+	switch f[0] {
+	case "tempo", "swing", "length":
+		if len(f) != 2 {
+			return errors.New(f[0] + " needs one value")
+		}
+		v, err := strconv.Atoi(f[1])
+		if err != nil {
+			return errors.New("bad " + f[0] + " " + f[1])
+		}
+		switch f[0] {
+		case "tempo":
+			if v < 20 || v > 300 {
+				return errors.New("tempo must be 20 to 300")
+			}
+			p.tempo = v
+		case "swing":
+			if v < StraightSwing || v > MaxSwing {
+				return errors.New("swing must be 50 to 75")
+			}
+			p.swing = v
+		case "length":
+			if v < 1 || v > 64 {
+				return errors.New("length must be 1 to 64")
+			}
+			p.length = v
+		}
+		return nil
+	}
+
+	v, ok := VoiceByAbbrev(f[0])
+	if !ok {
+		return errors.New("unknown voice " + f[0])
+	}
+	for _, r := range p.rows {
+		if r.note == v.Note {
+			return errors.New("duplicate voice " + f[0])
+		}
+	}
+	steps := strings.Map(func(r rune) rune {
+		if r == '|' {
+			return -1
+		}
+		return r
+	}, strings.Join(f[1:], ""))
+	for _, c := range steps {
+		switch c {
+		case 'x', 'X', '.', '-':
+		default:
+			return errors.New("bad step " + strconv.QuoteRune(c) + " in " + f[0])
+		}
+	}
+	if len(steps) == 0 {
+		return errors.New("voice " + f[0] + " has no steps")
+	}
+	p.rows = append(p.rows, row{note: v.Note, steps: steps})
+	return nil
+}
+
+func (p *parser) pattern() (Pattern, error) {
+	pat := Pattern{Name: p.name, Tempo: p.tempo, Swing: p.swing}
+	if pat.Tempo == 0 {
+		pat.Tempo = DefaultTempo
+	}
+	if pat.Swing == 0 {
+		pat.Swing = StraightSwing
+	}
+
+	length := p.length
+	for _, r := range p.rows {
+		if length == 0 {
+			length = len(r.steps)
+		}
+		if len(r.steps) != length {
+			return Pattern{}, errors.New(p.name + ": voice rows must have " + strconv.Itoa(length) + " steps")
+		}
+	}
+	if length == 0 {
+		return Pattern{}, errors.New(p.name + ": no steps")
+	}
+
+	pat.Steps = make([][]uint8, length)
+	for i := range pat.Steps {
+		pat.Steps[i] = []uint8{}
+		for _, r := range p.rows {
+			if c := r.steps[i]; c == 'x' || c == 'X' {
+				pat.Steps[i] = append(pat.Steps[i], r.note)
+			}
+		}
+	}
+	return pat, nil
+}
+
+// Validate reports the first problem that would stop the pattern from being
+// written or played.
+func (p Pattern) Validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("pattern has no name")
+	case p.Tempo < 20 || p.Tempo > 300:
+		return errors.New(p.Name + ": tempo must be 20 to 300")
+	case p.Swing < StraightSwing || p.Swing > MaxSwing:
+		return errors.New(p.Name + ": swing must be 50 to 75")
+	case len(p.Steps) == 0 || len(p.Steps) > 64:
+		return errors.New(p.Name + ": length must be 1 to 64")
+	}
+	for i, step := range p.Steps {
+		for _, n := range step {
+			if _, ok := VoiceByNote(n); !ok {
+				return errors.New(p.Name + ": step " + strconv.Itoa(i+1) + ": unknown note " + strconv.Itoa(int(n)))
+			}
+		}
+	}
+	return nil
+}
+
+// Voices returns the notes used by the pattern in order of first use.
+func (p Pattern) Voices() []uint8 {
+	var notes []uint8
+	for _, step := range p.Steps {
+		for _, n := range step {
+			found := false
+			for _, m := range notes {
+				found = found || m == n
+			}
+			if !found {
+				notes = append(notes, n)
+			}
+		}
+	}
+	return notes
+}
+
+// String formats the pattern so that Parse reads it back. Rows are split
+// into groups of four steps.
+func (p Pattern) String() string {
+	var b strings.Builder
+	b.WriteString("pattern " + p.Name + "\n")
+	b.WriteString("tempo   " + strconv.Itoa(p.Tempo) + "\n")
+	b.WriteString("swing   " + strconv.Itoa(p.Swing) + "\n")
+	b.WriteString("length  " + strconv.Itoa(len(p.Steps)) + "\n\n")
+	for _, n := range p.Voices() {
+		v, _ := VoiceByNote(n)
+		b.WriteString(v.Abbrev + " ")
+		for i, step := range p.Steps {
+			if i > 0 && i%4 == 0 {
+				b.WriteByte('|')
+			}
+			c := byte('.')
+			for _, m := range step {
+				if m == n {
+					c = 'x'
+				}
+			}
+			b.WriteByte(c)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Format formats several patterns separated by blank lines.
+func Format(patterns []Pattern) string {
+	s := make([]string, len(patterns))
+	for i, p := range patterns {
+		s[i] = p.String()
+	}
+	return strings.Join(s, "\n")
+}
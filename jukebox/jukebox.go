@@ -0,0 +1,403 @@
+// Package jukebox plays songs and sound effects on a buzzer in the
+// background.
+//
+// A Player runs its own goroutine and is controlled by commands sent over a
+// channel, so the main loop only sends Play, Pause, Resume, Stop, Skip and
+// SetVolume and keeps reading keys and drawing the display. Items wait in a
+// queue ordered by Priority: a sound effect interrupts a song, which
+// continues where its note was cut off when the effect has finished.
+//
+// Progress is reported to a callback that runs on the player goroutine. It
+// should return quickly; forward the events to the main loop, for example
+// over a buffered channel, to draw them.
+package jukebox
+
+import (
+	"time"
+
+	"github.com/tinygo-keeb/workshop/mml"
+)
+
+// MaxVolume is the loudest volume, as in the V command of mml.
+const MaxVolume = 15
+
+// Priority decides which item plays when several are queued.
+type Priority int
+
+const (
+	Music  Priority = iota // songs, played one after another
+	Effect                 // sound effects, interrupt music
+	Alert                  // alerts, interrupt everything else
+)
+
+// Output is the buzzer that a Player plays on, such as Speaker. Songs are
+// played with SetNote and the Tones of sound effects with SetPeriod.
+type Output interface {
+	mml.VolumeSpeaker
+	SetPeriod(period uint64)
+}
+
+// Item is a song or sound effect to play.
+type Item struct {
+	Name     string
+	Song     *mml.Song
+	Tones    []Tone // played instead of Song if set
+	Priority Priority
+}
+
+// Kind is what an Event reports.
+type Kind int
+
+const (
+	Started     Kind = iota // the item started
+	Note                    // a note started
+	Rest                    // a rest started
+	Lyric                   // a lyric marker was reached
+	Finished                // the item played to its end
+	Skipped                 // the item was skipped
+	Interrupted             // the item was interrupted by one of higher priority
+	Resumed                 // an interrupted item continues
+	Paused                  // playback was paused
+	Unpaused                // playback was resumed after a pause
+	Stopped                 // playback was stopped and the queue cleared
+)
+
+var kindNames = []string{
+	"Started", "Note", "Rest", "Lyric", "Finished", "Skipped",
+	"Interrupted", "Resumed", "Paused", "Unpaused", "Stopped",
+}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "?"
+	}
+	return kindNames[k]
+}
+
+// Event reports the progress of the player.
+type Event struct {
+	Kind  Kind
+	Item  *Item     // the item concerned; nil for Stopped
+	Index int       // index of the mml event or Tone for Note, Rest and Lyric
+	Event mml.Event // the mml event for Note, Rest and Lyric of a Song
+}
+
+type op int
+
+const (
+	opPlay op = iota
+	opPause
+	opResume
+	opStop
+	opSkip
+	opVolume
+)
+
+type command struct {
+	op     op
+	item   *Item
+	volume uint8
+}
+
+// entry is an item in the queue with the event to start from and how much
+// of that event was already played.
+type entry struct {
+	item    *Item
+	start   int
+	elapsed time.Duration
+}
+
+// Player plays items on a buzzer in the background.
+type Player struct {
+	cmds    chan command
+	onEvent func(Event)
+
+	// state of the player goroutine
+	out    *output
+	mml    *mml.Player
+	tones  *tonePlayer
+	cur    *entry
+	index  int // index of the sounding event of cur
+	queue  []entry
+	paused bool
+}
+
+// New starts a player on speaker. onEvent, which may be nil, is called on
+// the player goroutine for every Event.
+func New(speaker Output, onEvent func(Event)) *Player {
+	out := &output{speaker: speaker, master: MaxVolume, volume: MaxVolume}
+	p := &Player{
+		cmds:    make(chan command, 8),
+		onEvent: onEvent,
+		out:     out,
+		mml:     mml.NewPlayer(out),
+		tones:   &tonePlayer{out: out, cur: -1},
+	}
+	go p.run()
+	return p
+}
+
+// Play adds item to the queue. If it has a higher priority than the item
+// playing, it starts at once and the other item waits. While paused, items
+// are only queued.
+func (p *Player) Play(item *Item) {
+	p.cmds <- command{op: opPlay, item: item}
+}
+
+// Pause pauses playback. The note that was cut off is played again on
+// Resume.
+func (p *Player) Pause() {
+	p.cmds <- command{op: opPause}
+}
+
+// Resume continues after Pause.
+func (p *Player) Resume() {
+	p.cmds <- command{op: opResume}
+}
+
+// Stop stops playback and clears the queue.
+func (p *Player) Stop() {
+	p.cmds <- command{op: opStop}
+}
+
+// Skip ends the item playing and starts the next one in the queue.
+func (p *Player) Skip() {
+	p.cmds <- command{op: opSkip}
+}
+
+// SetVolume sets the master volume from 0 (mute) to MaxVolume.
+func (p *Player) SetVolume(volume uint8) {
+	p.cmds <- command{op: opVolume, volume: volume}
+}
+
+func (p *Player) run() {
+	for {
+		if p.cur == nil || p.paused {
+			// nothing to do until the next command
+			p.handle(<-p.cmds)
+			continue
+		}
+		select {
+		case c := <-p.cmds:
+			p.handle(c)
+			continue
+		default:
+		}
+		p.update(time.Now())
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func (p *Player) emit(e Event) {
+	if p.onEvent != nil {
+		p.onEvent(e)
+	}
+}
+
+func (p *Player) handle(c command) {
+	now := time.Now()
+	switch c.op {
+	case opPlay:
+		if c.item == nil || c.item.Song == nil && c.item.Tones == nil {
+			return
+		}
+		e := entry{item: c.item}
+		if p.cur != nil && !p.paused && c.item.Priority > p.cur.item.Priority {
+			// the interrupted item continues with what is left of the
+			// note that was cut off
+			i, elapsed := p.position(now)
+			p.stop()
+			p.emit(Event{Kind: Interrupted, Item: p.cur.item})
+			p.push(entry{item: p.cur.item, start: i, elapsed: elapsed}, true)
+			p.cur = nil
+			p.start(e, now)
+			return
+		}
+		p.push(e, false)
+		if p.cur == nil && !p.paused {
+			p.next(now)
+		}
+	case opPause:
+		if p.cur != nil && !p.paused {
+			p.stop()
+			p.paused = true
+			p.emit(Event{Kind: Paused, Item: p.cur.item})
+		}
+	case opResume:
+		if !p.paused {
+			return
+		}
+		p.paused = false
+		if p.cur == nil {
+			p.next(now)
+			return
+		}
+		p.emit(Event{Kind: Unpaused, Item: p.cur.item})
+		p.play(p.cur.item, p.index, 0, now)
+	case opStop:
+		p.stop()
+		p.cur = nil
+		p.queue = p.queue[:0]
+		p.paused = false
+		p.emit(Event{Kind: Stopped})
+	case opSkip:
+		if p.cur == nil {
+			return
+		}
+		p.stop()
+		p.emit(Event{Kind: Skipped, Item: p.cur.item})
+		p.cur = nil
+		if !p.paused {
+			p.next(now)
+		}
+	case opVolume:
+		p.out.setMaster(c.volume)
+	}
+}
+
+// push adds e to the queue behind the items of the same or higher
+// priority, or in front of the items of the same priority if first is set.
+func (p *Player) push(e entry, first bool) {
+	i := 0
+	for i < len(p.queue) {
+		q := p.queue[i].item.Priority
+		if q < e.item.Priority || first && q == e.item.Priority {
+			break
+		}
+		i++
+	}
+	p.queue = append(p.queue, entry{})
+	copy(p.queue[i+1:], p.queue[i:])
+	p.queue[i] = e
+}
+
+// next starts the first item of the queue.
+func (p *Player) next(now time.Time) {
+	if len(p.queue) == 0 {
+		return
+	}
+	e := p.queue[0]
+	copy(p.queue, p.queue[1:])
+	p.queue = p.queue[:len(p.queue)-1]
+	p.start(e, now)
+}
+
+func (p *Player) start(e entry, now time.Time) {
+	p.cur = &e
+	p.index = e.start
+	if e.start > 0 || e.elapsed > 0 {
+		p.emit(Event{Kind: Resumed, Item: e.item})
+	} else {
+		p.emit(Event{Kind: Started, Item: e.item})
+	}
+	p.play(e.item, e.start, e.elapsed, now)
+}
+
+// play starts item elapsed into its i-th event or tone.
+func (p *Player) play(item *Item, i int, elapsed time.Duration, now time.Time) {
+	if item.Tones != nil {
+		p.tones.playFrom(item.Tones, i, elapsed, now)
+		return
+	}
+	p.mml.PlayFrom(item.Song, i, elapsed, now)
+}
+
+// position returns the event or tone of the item playing and how long ago it
+// started.
+func (p *Player) position(now time.Time) (i int, elapsed time.Duration) {
+	if p.cur.item.Tones != nil {
+		return p.tones.position(now)
+	}
+	return p.mml.Position(now)
+}
+
+func (p *Player) stop() {
+	p.mml.Stop()
+	p.tones.stop()
+}
+
+func (p *Player) update(now time.Time) {
+	item := p.cur.item
+	if item.Tones != nil {
+		p.tones.update(now, func(i int) {
+			p.index = i
+			ev := Event{Kind: Note, Item: item, Index: i}
+			if t := item.Tones[i]; t.Period == 0 || t.Volume == 0 {
+				ev.Kind = Rest
+			}
+			p.emit(ev)
+		})
+		if !p.tones.playing {
+			p.finish(now)
+		}
+		return
+	}
+	p.mml.Update(now, func(e mml.Event) {
+		p.index = p.mml.Next() - 1
+		ev := Event{Kind: Note, Item: item, Index: p.index, Event: e}
+		switch {
+		case e.Lyric != "":
+			ev.Kind = Lyric
+		case e.Rest:
+			ev.Kind = Rest
+		}
+		p.emit(ev)
+	})
+	if !p.mml.Playing() {
+		p.finish(now)
+	}
+}
+
+// finish ends the item that played to its end and starts the next one.
+func (p *Player) finish(now time.Time) {
+	p.emit(Event{Kind: Finished, Item: p.cur.item})
+	p.cur = nil
+	p.next(now)
+}
+
+// output applies the master volume to the volume of every note.
+type output struct {
+	speaker Output
+	master  uint8 // master volume
+	volume  uint8 // volume of the note
+}
+
+func (o *output) SetNote(note uint8) {
+	if o.master == 0 {
+		o.speaker.Stop()
+		return
+	}
+	o.speaker.SetNote(note)
+}
+
+func (o *output) SetPeriod(period uint64) {
+	if o.master == 0 {
+		o.speaker.Stop()
+		return
+	}
+	o.speaker.SetPeriod(period)
+}
+
+func (o *output) Stop() {
+	o.speaker.Stop()
+}
+
+func (o *output) SetVolume(volume uint8) {
+	o.volume = volume
+	o.apply()
+}
+
+func (o *output) setMaster(volume uint8) {
+	if volume > MaxVolume {
+		volume = MaxVolume
+	}
+	if volume == 0 {
+		o.speaker.Stop()
+	}
+	o.master = volume
+	o.apply()
+}
+
+func (o *output) apply() {
+	o.speaker.SetVolume(uint8(int(o.master) * int(o.volume) / MaxVolume))
+}
@@ -0,0 +1,83 @@
+//go:build tinygo
+
+package jukebox
+
+import (
+	"machine"
+
+	"tinygo.org/x/drivers/tone"
+)
+
+// MaxLevel is the loudest level of SetLevel.
+const MaxLevel = 255
+
+// Speaker is a buzzer on a PWM pin like tone.Speaker whose loudness can be
+// set. A piezo buzzer is loudest with a 50% duty cycle; lower volumes use
+// shorter pulses. It is also a synth.Output.
+type Speaker struct {
+	pwm      tone.PWM
+	ch       uint8
+	level    uint8
+	sounding bool
+}
+
+// NewSpeaker configures pwm for pin and returns a Speaker at full volume.
+func NewSpeaker(pwm tone.PWM, pin machine.Pin) (*Speaker, error) {
+	err := pwm.Configure(machine.PWMConfig{
+		Period: uint64(1e9) / 55 / 2,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ch, err := pwm.Channel(pin)
+	if err != nil {
+		return nil, err
+	}
+	return &Speaker{pwm: pwm, ch: ch, level: MaxLevel}, nil
+}
+
+// SetNote starts playing the MIDI note number note.
+func (s *Speaker) SetNote(note uint8) {
+	s.SetPeriod(tone.Note(note).Period())
+}
+
+// SetPeriod starts playing a square wave with the period in nanoseconds.
+func (s *Speaker) SetPeriod(period uint64) {
+	s.pwm.Set(s.ch, 0)
+	s.pwm.SetPeriod(period)
+	s.sounding = true
+	s.pwm.Set(s.ch, s.duty())
+}
+
+// Stop silences the speaker.
+func (s *Speaker) Stop() {
+	s.pwm.Set(s.ch, 0)
+	s.sounding = false
+}
+
+// SetVolume sets the volume from 0 (silent) to MaxVolume. It also changes a
+// sounding note.
+func (s *Speaker) SetVolume(volume uint8) {
+	if volume > MaxVolume {
+		volume = MaxVolume
+	}
+	s.SetLevel(volume * (MaxLevel / MaxVolume))
+}
+
+// SetLevel sets the loudness in finer steps than SetVolume, from 0 (silent)
+// to MaxLevel, for envelopes such as those of synth. It also changes a
+// sounding note.
+func (s *Speaker) SetLevel(level uint8) {
+	s.level = level
+	if s.sounding {
+		s.pwm.Set(s.ch, s.duty())
+	}
+}
+
+// duty returns the PWM value for the level. The loudness of a buzzer rises
+// quickly with the pulse width, so the width grows with the square of the
+// level.
+func (s *Speaker) duty() uint32 {
+	v := uint64(s.level)
+	return uint32(uint64(s.pwm.Top()) * v * v / (2 * MaxLevel * MaxLevel))
+}
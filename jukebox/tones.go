@@ -0,0 +1,71 @@
+package jukebox
+
+import "time"
+
+// Tone is a step of a sound effect: a square wave whose period need not be
+// a note of the scale, for slides and noise.
+type Tone struct {
+	Period uint64 // period in nanoseconds, 0 for silence
+	Volume uint8  // 0 to MaxVolume
+	Length time.Duration
+}
+
+// tonePlayer plays the Tones of an item the way mml.Player plays a song.
+type tonePlayer struct {
+	out     *output
+	tones   []Tone
+	next    int       // index of the next tone
+	at      time.Time // time of the next tone
+	cur     int       // index of the last tone started, or -1
+	started time.Time // time at which the last tone started
+	playing bool
+}
+
+// playFrom starts tones elapsed into the i-th tone at now.
+func (t *tonePlayer) playFrom(tones []Tone, i int, elapsed time.Duration, now time.Time) {
+	t.stop()
+	t.tones = tones
+	t.next = i
+	t.at = now.Add(-elapsed)
+	t.cur = -1
+	t.playing = true
+}
+
+// position returns the index of the tone playing at now and how long ago it
+// started.
+func (t *tonePlayer) position(now time.Time) (i int, elapsed time.Duration) {
+	if t.cur < 0 || t.cur >= len(t.tones) || !now.Before(t.at) {
+		return t.next, 0
+	}
+	return t.cur, now.Sub(t.started)
+}
+
+func (t *tonePlayer) stop() {
+	if t.playing {
+		t.out.Stop()
+		t.playing = false
+	}
+}
+
+// update starts the tones that are due and passes the index of each to
+// handle.
+func (t *tonePlayer) update(now time.Time, handle func(i int)) {
+	for t.playing && !now.Before(t.at) {
+		if t.next >= len(t.tones) {
+			t.stop()
+			return
+		}
+		tone := t.tones[t.next]
+		t.cur = t.next
+		t.started = t.at
+		t.next++
+		if tone.Period == 0 || tone.Volume == 0 {
+			t.out.Stop()
+		} else {
+			t.out.SetVolume(tone.Volume)
+			t.out.SetPeriod(tone.Period)
+		}
+		handle(t.cur)
+		t.at = t.at.Add(tone.Length)
+	}
+}
@@ -0,0 +1,123 @@
+// Package keylayout describes where the 12 keys of zero-kb02 are.
+//
+// The matrix is scanned column by column (SW1, SW5, SW9, SW2, ...), the LEDs
+// are chained in the same order and the PCB silkscreen numbers the switches
+// row by row:
+//
+//	matrix / LED index     switch number
+//	 0  3  6  9            SW1  SW2  SW3  SW4
+//	 1  4  7 10            SW5  SW6  SW7  SW8
+//	 2  5  8 11            SW9  SW10 SW11 SW12
+//
+// X / Y are the centre of each key in key pitches (19.05mm) from the centre
+// of the top left key, with Y growing downwards like the OLED.
+package keylayout
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	Cols = 4
+	Rows = 3
+	Len  = Cols * Rows
+)
+
+// Key is the position of one key switch.
+type Key struct {
+	Index  int     // matrix scan index, as used by getKeys() in the examples
+	LED    int     // index in the WS2812B chain
+	Switch int     // SW number printed on the PCB (1-12)
+	Col    int     // 0-3
+	Row    int     // 0-2
+	X, Y   float32 // centre of the key in key pitches
+}
+
+// Keys is indexed by matrix scan index.
+var Keys = [Len]Key{
+	{Index: 0, LED: 0, Switch: 1, Col: 0, Row: 0, X: 0, Y: 0},
+	{Index: 1, LED: 1, Switch: 5, Col: 0, Row: 1, X: 0, Y: 1},
+	{Index: 2, LED: 2, Switch: 9, Col: 0, Row: 2, X: 0, Y: 2},
+	{Index: 3, LED: 3, Switch: 2, Col: 1, Row: 0, X: 1, Y: 0},
+	{Index: 4, LED: 4, Switch: 6, Col: 1, Row: 1, X: 1, Y: 1},
+	{Index: 5, LED: 5, Switch: 10, Col: 1, Row: 2, X: 1, Y: 2},
+	{Index: 6, LED: 6, Switch: 3, Col: 2, Row: 0, X: 2, Y: 0},
+	{Index: 7, LED: 7, Switch: 7, Col: 2, Row: 1, X: 2, Y: 1},
+	{Index: 8, LED: 8, Switch: 11, Col: 2, Row: 2, X: 2, Y: 2},
+	{Index: 9, LED: 9, Switch: 4, Col: 3, Row: 0, X: 3, Y: 0},
+	{Index: 10, LED: 10, Switch: 8, Col: 3, Row: 1, X: 3, Y: 1},
+	{Index: 11, LED: 11, Switch: 12, Col: 3, Row: 2, X: 3, Y: 2},
+}
+
+// CenterX and CenterY are the centre of the key block.
+const (
+	CenterX = float32(Cols-1) / 2
+	CenterY = float32(Rows-1) / 2
+)
+
+// Ring lists the matrix indexes of the outer keys going round the block,
+// starting at SW1 and going down the left column first.
+var Ring []int
+
+func init() {
+	a0 := Keys[0].Angle(CenterX, CenterY)
+	for _, k := range Keys {
+		if k.Col == 0 || k.Col == Cols-1 || k.Row == 0 || k.Row == Rows-1 {
+			Ring = append(Ring, k.Index)
+		}
+	}
+	// the left column goes down, which is the direction of decreasing angle
+	// with Y pointing downwards
+	rel := func(i int) float64 {
+		d := float64(a0 - Keys[i].Angle(CenterX, CenterY))
+		for d < 0 {
+			d += 2 * math.Pi
+		}
+		return d
+	}
+	sort.Slice(Ring, func(i, j int) bool {
+		return rel(Ring[i]) < rel(Ring[j])
+	})
+}
+
+// At returns the key at col / row.
+func At(col, row int) (Key, bool) {
+	if col < 0 || col >= Cols || row < 0 || row >= Rows {
+		return Key{}, false
+	}
+	return Keys[col*Rows+row], true
+}
+
+// BySwitch returns the key with the SW number sw (1-12).
+func BySwitch(sw int) (Key, bool) {
+	if sw < 1 || sw > Len {
+		return Key{}, false
+	}
+	sw--
+	return At(sw%Cols, sw/Cols)
+}
+
+// Distance returns the distance in key pitches from k to x / y.
+func (k Key) Distance(x, y float32) float32 {
+	dx := float64(k.X - x)
+	dy := float64(k.Y - y)
+	return float32(math.Sqrt(dx*dx + dy*dy))
+}
+
+// Angle returns the direction of k seen from x / y in radians (-Pi to Pi).
+// 0 points to the right and Pi/2 points down.
+func (k Key) Angle(x, y float32) float32 {
+	return float32(math.Atan2(float64(k.Y-y), float64(k.X-x)))
+}
+
+// Nearest returns the key closest to x / y.
+func Nearest(x, y float32) Key {
+	best := Keys[0]
+	for _, k := range Keys[1:] {
+		if k.Distance(x, y) < best.Distance(x, y) {
+			best = k
+		}
+	}
+	return best
+}
@@ -0,0 +1,269 @@
+// Package keymap turns key presses into USB HID keyboard reports through a
+// stack of layers, like the firmware of programmable keyboards.
+//
+// A Layer assigns an Action to every key position. The default layer is
+// always at the bottom of the stack; other layers are switched on while a
+// key is held (MO), until they are toggled off (TG), for the next key press
+// only (OSL), or become the new default (DF). A key is looked up from the
+// highest active layer down, and Trans lets a layer show the key of the
+// layer below. An M action runs a macro, such as those of package macro.
+//
+// The action of a key is fixed when it is pressed, so releasing it always
+// undoes what pressing it did even if the layers have changed since.
+package keymap
+
+import "machine/usb/hid/keyboard"
+
+// MaxLayers is the largest number of layers in a Keymap.
+const MaxLayers = 16
+
+type kind uint8
+
+const (
+	kindNone kind = iota
+	kindTrans
+	kindKey
+	kindMomentary
+	kindToggle
+	kindOneShot
+	kindDefault
+	kindMacro
+)
+
+// Action is what a key does.
+type Action struct {
+	kind  kind
+	code  keyboard.Keycode
+	mods  uint8 // modifier bits, as in the low byte of keyboard.KeyModifierCtrl and so on
+	layer uint8
+	macro uint8
+}
+
+var (
+	// No does nothing and hides the keys of lower layers.
+	No = Action{kind: kindNone}
+	// Trans uses the key of the next active layer below.
+	Trans = Action{kind: kindTrans}
+)
+
+// Key sends code, with modifiers such as keyboard.KeyModifierCtrl held
+// while it is pressed. Modifier keycodes can also be sent on their own.
+func Key(code keyboard.Keycode, mods ...keyboard.Keycode) Action {
+	a := Action{kind: kindKey, code: code}
+	for _, m := range mods {
+		a.mods |= uint8(m)
+	}
+	return a
+}
+
+// MO switches layer on while the key is held.
+func MO(layer int) Action {
+	return Action{kind: kindMomentary, layer: uint8(layer)}
+}
+
+// TG switches layer on or off each time the key is pressed.
+func TG(layer int) Action {
+	return Action{kind: kindToggle, layer: uint8(layer)}
+}
+
+// OSL switches layer on for the next key press only.
+func OSL(layer int) Action {
+	return Action{kind: kindOneShot, layer: uint8(layer)}
+}
+
+// DF makes layer the default layer.
+func DF(layer int) Action {
+	return Action{kind: kindDefault, layer: uint8(layer)}
+}
+
+// M runs macro id of the Macros given to SetMacros.
+func M(id int) Action {
+	return Action{kind: kindMacro, macro: uint8(id)}
+}
+
+// Macros runs the macros of M actions, such as a *macro.Runner.
+type Macros interface {
+	Run(id int)
+}
+
+// Layer is a named set of actions, one for every key position.
+type Layer struct {
+	Name string
+	Keys []Action
+}
+
+// Output sends key presses, such as keyboard.Port().
+type Output interface {
+	Down(c keyboard.Keycode) error
+	Up(c keyboard.Keycode) error
+}
+
+// Keymap tracks the layer state and sends the keys.
+type Keymap struct {
+	layers  []Layer
+	out     Output
+	def     int              // default layer
+	toggled uint32           // layers switched on by TG
+	held    [MaxLayers]uint8 // number of MO keys held per layer
+	oneShot int              // layer switched on by OSL, or -1
+	pressed []Action         // action of each key while it is held
+	macros  Macros
+}
+
+// New returns a Keymap for keys key positions with layer 0 as the default
+// layer. Positions that a layer has no action for are transparent.
+func New(out Output, keys int, layers ...Layer) *Keymap {
+	if len(layers) > MaxLayers {
+		layers = layers[:MaxLayers]
+	}
+	return &Keymap{
+		layers:  layers,
+		out:     out,
+		oneShot: -1,
+		pressed: make([]Action, keys),
+	}
+}
+
+// active reports whether layer l is switched on.
+func (k *Keymap) active(l int) bool {
+	return l == k.def || k.toggled&(1<<l) != 0 || k.held[l] > 0 || l == k.oneShot
+}
+
+// lookup returns the action of key pos on the highest active layer that
+// does not make it transparent.
+func (k *Keymap) lookup(pos int) Action {
+	for l := len(k.layers) - 1; l >= 0; l-- {
+		if !k.active(l) || pos >= len(k.layers[l].Keys) {
+			continue
+		}
+		if a := k.layers[l].Keys[pos]; a.kind != kindTrans {
+			return a
+		}
+	}
+	return No
+}
+
+// SetMacros sets what runs the macros of M actions.
+func (k *Keymap) SetMacros(m Macros) {
+	k.macros = m
+}
+
+// Press handles key pos going down.
+func (k *Keymap) Press(pos int) {
+	if pos < 0 || pos >= len(k.pressed) {
+		return
+	}
+	a := k.lookup(pos)
+	if a.kind > kindKey && a.kind < kindMacro && int(a.layer) >= len(k.layers) {
+		// a layer that does not exist
+		a = No
+	}
+	k.pressed[pos] = a
+
+	// a one-shot layer ends with the next key press
+	if a.kind != kindOneShot && k.oneShot >= 0 && a.kind != kindNone {
+		k.oneShot = -1
+	}
+
+	switch a.kind {
+	case kindKey:
+		k.sendMods(a.mods, true)
+		k.out.Down(a.code)
+	case kindMomentary:
+		k.held[a.layer]++
+	case kindToggle:
+		k.toggled ^= 1 << a.layer
+	case kindOneShot:
+		if k.oneShot == int(a.layer) {
+			// pressed twice, cancel
+			k.oneShot = -1
+		} else {
+			k.oneShot = int(a.layer)
+		}
+	case kindDefault:
+		k.def = int(a.layer)
+	case kindMacro:
+		if k.macros != nil {
+			k.macros.Run(int(a.macro))
+		}
+	}
+}
+
+// Release handles key pos going up.
+func (k *Keymap) Release(pos int) {
+	if pos < 0 || pos >= len(k.pressed) {
+		return
+	}
+	a := k.pressed[pos]
+	k.pressed[pos] = No
+	switch a.kind {
+	case kindKey:
+		k.out.Up(a.code)
+		k.sendMods(a.mods, false)
+	case kindMomentary:
+		if k.held[a.layer] > 0 {
+			k.held[a.layer]--
+		}
+	}
+}
+
+// Tap presses and releases key pos, for inputs such as a rotary encoder
+// that have no held state.
+func (k *Keymap) Tap(pos int) {
+	k.Press(pos)
+	k.Release(pos)
+}
+
+// ReleaseAll releases every key that is held.
+func (k *Keymap) ReleaseAll() {
+	for pos := range k.pressed {
+		k.Release(pos)
+	}
+}
+
+func (k *Keymap) sendMods(mods uint8, down bool) {
+	for bit := uint8(1); bit != 0; bit <<= 1 {
+		if mods&bit == 0 {
+			continue
+		}
+		code := keyboard.KeyModifierCtrl&0xFF00 | keyboard.Keycode(bit)
+		if down {
+			k.out.Down(code)
+		} else {
+			k.out.Up(code)
+		}
+	}
+}
+
+// Top returns the highest active layer, whose name is usually shown.
+func (k *Keymap) Top() int {
+	for l := len(k.layers) - 1; l > 0; l-- {
+		if k.active(l) {
+			return l
+		}
+	}
+	return 0
+}
+
+// Name returns the name of layer l.
+func (k *Keymap) Name(l int) string {
+	if l < 0 || l >= len(k.layers) {
+		return ""
+	}
+	return k.layers[l].Name
+}
+
+// Default returns the default layer.
+func (k *Keymap) Default() int {
+	return k.def
+}
+
+// Toggled reports whether layer l has been switched on by TG.
+func (k *Keymap) Toggled(l int) bool {
+	return k.toggled&(1<<l) != 0
+}
+
+// OneShot returns the layer waiting for the next key press after OSL, or -1.
+func (k *Keymap) OneShot() int {
+	return k.oneShot
+}
@@ -0,0 +1,111 @@
+package ledanim
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/ledcolor"
+)
+
+// Parse reads a timeline from text.
+//
+//	# lines starting with # are comments
+//	name startup
+//	mode pingpong          # once, loop or pingpong
+//
+//	# time   easing    colours (RRGGBB, one for all LEDs or one per LED)
+//	0ms      ease-in   000000
+//	300ms    linear    FF0000 000000 000000 000000 FF0000 000000 ...
+//	1s       step      0000FF
+//
+// Easing is one of linear, ease-in, ease-out, ease-in-out or step and
+// applies to the transition towards the next keyframe.
+func Parse(src string) (*Timeline, error) {
+	t := &Timeline{}
+	for n, line := range strings.Split(src, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if err := t.parseLine(f); err != nil {
+			return nil, errors.New("line " + strconv.Itoa(n+1) + ": " + err.Error())
+		}
+	}
+	if len(t.Keyframes) == 0 {
+		return nil, errors.New("no keyframes")
+	}
+	return t, nil
+}
+
+// MustParse is like Parse but panics on error. It is meant for embedded
+// files that are known to be valid.
+func MustParse(src string) *Timeline {
+	t, err := Parse(src)
+	if err != nil {
+		panic("ledanim: " + err.Error())
+	}
+	return t
+}
+
+func (t *Timeline) parseLine(f []string) error {
+	switch f[0] {
+	case "name":
+		t.Name = strings.Join(f[1:], " ")
+		return nil
+	case "mode":
+		if len(f) != 2 {
+			return errors.New("mode needs one value")
+		}
+		switch f[1] {
+		case "once":
+			t.Mode = Once
+		case "loop":
+			t.Mode = Loop
+		case "pingpong":
+			t.Mode = PingPong
+		default:
+			return errors.New("unknown mode " + f[1])
+		}
+		return nil
+	}
+
+	if len(f) < 3 {
+		return errors.New("keyframe needs time, easing and colours")
+	}
+	at, err := time.ParseDuration(f[0])
+	if err != nil {
+		return err
+	}
+	if n := len(t.Keyframes); n > 0 && at < t.Keyframes[n-1].At {
+		return errors.New("keyframes must be in time order")
+	}
+	k := Keyframe{At: at}
+	switch f[1] {
+	case "linear":
+		k.Easing = Linear
+	case "ease-in":
+		k.Easing = EaseIn
+	case "ease-out":
+		k.Easing = EaseOut
+	case "ease-in-out":
+		k.Easing = EaseInOut
+	case "step":
+		k.Easing = Step
+	default:
+		return errors.New("unknown easing " + f[1])
+	}
+	for _, s := range f[2:] {
+		v, err := strconv.ParseUint(s, 16, 32)
+		if err != nil || len(s) != 6 {
+			return errors.New("bad colour " + s)
+		}
+		k.Colors = append(k.Colors, ledcolor.RGB{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v)})
+	}
+	t.Keyframes = append(t.Keyframes, k)
+	return nil
+}
@@ -0,0 +1,180 @@
+// Package ledanim plays keyframe animations on the key LEDs.
+//
+// A Timeline is a list of keyframes, each holding the colour of every LED at
+// a point in time. Frames between two keyframes are interpolated with the
+// Easing of the earlier keyframe. Timelines can be written as text files and
+// embedded with go:embed, see Parse for the format.
+package ledanim
+
+import (
+	"time"
+
+	"github.com/tinygo-keeb/workshop/ledcolor"
+)
+
+// Easing is the interpolation used from one keyframe to the next.
+type Easing uint8
+
+const (
+	Linear Easing = iota
+	EaseIn
+	EaseOut
+	EaseInOut
+	Step // hold the colour until the next keyframe
+)
+
+// Mode decides what happens after the last keyframe.
+type Mode uint8
+
+const (
+	Once     Mode = iota // stop at the last keyframe
+	Loop                 // start again from the first keyframe
+	PingPong             // play backwards, then forwards again
+)
+
+// Keyframe is the colour of the LEDs at time At.
+type Keyframe struct {
+	At     time.Duration
+	Colors []ledcolor.RGB // one colour per LED, or a single colour for all
+	Easing Easing
+}
+
+func (k Keyframe) color(i int) ledcolor.RGB {
+	switch len(k.Colors) {
+	case 0:
+		return ledcolor.Black
+	case 1:
+		return k.Colors[0]
+	}
+	if i < len(k.Colors) {
+		return k.Colors[i]
+	}
+	return ledcolor.Black
+}
+
+// Timeline is a sequence of keyframes sorted by At.
+type Timeline struct {
+	Name      string
+	Mode      Mode
+	Keyframes []Keyframe
+}
+
+// Duration returns the time of the last keyframe.
+func (t *Timeline) Duration() time.Duration {
+	if len(t.Keyframes) == 0 {
+		return 0
+	}
+	return t.Keyframes[len(t.Keyframes)-1].At
+}
+
+// Frame writes the colours at elapsed into dst and reports whether a Once
+// timeline has finished.
+func (t *Timeline) Frame(elapsed time.Duration, dst []ledcolor.RGB) bool {
+	if len(t.Keyframes) == 0 {
+		for i := range dst {
+			dst[i] = ledcolor.Black
+		}
+		return true
+	}
+
+	d := t.Duration()
+	done := false
+	if d <= 0 {
+		elapsed = 0
+		done = t.Mode == Once
+	} else {
+		switch t.Mode {
+		case Once:
+			if elapsed >= d {
+				elapsed = d
+				done = true
+			}
+		case Loop:
+			elapsed %= d
+		case PingPong:
+			elapsed %= 2 * d
+			if elapsed > d {
+				elapsed = 2*d - elapsed
+			}
+		}
+	}
+
+	// find the keyframe pair around elapsed
+	k := 0
+	for k+1 < len(t.Keyframes) && t.Keyframes[k+1].At <= elapsed {
+		k++
+	}
+	from := t.Keyframes[k]
+	if k+1 == len(t.Keyframes) || from.Easing == Step {
+		for i := range dst {
+			dst[i] = from.color(i)
+		}
+		return done
+	}
+	to := t.Keyframes[k+1]
+
+	span := to.At - from.At
+	pos := uint8(0)
+	if span > 0 {
+		pos = uint8((elapsed - from.At) * 255 / span)
+	}
+	pos = from.Easing.apply(pos)
+	for i := range dst {
+		dst[i] = from.color(i).Lerp(to.color(i), pos)
+	}
+	return done
+}
+
+// apply maps a linear position (0-255) with the easing curve.
+func (e Easing) apply(t uint8) uint8 {
+	x := uint16(t)
+	switch e {
+	case EaseIn:
+		return uint8(x * x / 255)
+	case EaseOut:
+		r := 255 - x
+		return uint8(255 - r*r/255)
+	case EaseInOut:
+		if x < 128 {
+			return uint8(2 * x * x / 255)
+		}
+		r := 255 - x
+		return uint8(255 - 2*r*r/255)
+	}
+	return t
+}
+
+// Player keeps the start time of the running timeline.
+type Player struct {
+	timeline *Timeline
+	start    time.Time
+	done     bool
+}
+
+// Play starts t from the beginning.
+func (p *Player) Play(t *Timeline) {
+	p.timeline = t
+	p.start = time.Now()
+	p.done = false
+}
+
+// Timeline returns the running timeline, or nil.
+func (p *Player) Timeline() *Timeline {
+	return p.timeline
+}
+
+// Done reports whether the timeline has finished. Loop and PingPong
+// timelines never finish.
+func (p *Player) Done() bool {
+	return p.timeline == nil || p.done
+}
+
+// Frame writes the current colours into dst. It returns false when nothing
+// is playing.
+func (p *Player) Frame(dst []ledcolor.RGB) bool {
+	if p.timeline == nil {
+		return false
+	}
+	p.done = p.timeline.Frame(time.Since(p.start), dst)
+	return true
+}
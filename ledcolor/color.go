@@ -0,0 +1,118 @@
+// Package ledcolor provides colour helpers for the SK6812MINI-E (WS2812B
+// compatible) LEDs on zero-kb02.
+//
+// piolib.WS2812B.WriteRaw expects one uint32 per LED laid out as
+//
+//	uint32(g)<<24 | uint32(r)<<16 | uint32(b)<<8
+//
+// The lowest 8 bits are ignored by the LED. RGB.GRB and FromGRB convert
+// between that layout and an ordinary RGB value.
+package ledcolor
+
+// RGB is a 24 bit colour.
+type RGB struct {
+	R, G, B uint8
+}
+
+// HSV is a colour in hue / saturation / value form.
+// H is in degrees (0-359), S and V are 0-255.
+type HSV struct {
+	H    uint16
+	S, V uint8
+}
+
+// Common colours at full brightness.
+var (
+	Black   = RGB{0x00, 0x00, 0x00}
+	White   = RGB{0xFF, 0xFF, 0xFF}
+	Red     = RGB{0xFF, 0x00, 0x00}
+	Green   = RGB{0x00, 0xFF, 0x00}
+	Blue    = RGB{0x00, 0x00, 0xFF}
+	Yellow  = RGB{0xFF, 0xFF, 0x00}
+	Cyan    = RGB{0x00, 0xFF, 0xFF}
+	Magenta = RGB{0xFF, 0x00, 0xFF}
+	Orange  = RGB{0xFF, 0x80, 0x00}
+	Purple  = RGB{0x80, 0x00, 0x80}
+	Pink    = RGB{0xFF, 0x69, 0xB4}
+)
+
+// GRB packs c into the raw format used by piolib.WS2812B.WriteRaw.
+func (c RGB) GRB() uint32 {
+	return uint32(c.G)<<24 | uint32(c.R)<<16 | uint32(c.B)<<8
+}
+
+// FromGRB unpacks a raw WriteRaw value.
+func FromGRB(raw uint32) RGB {
+	return RGB{
+		R: uint8(raw >> 16),
+		G: uint8(raw >> 24),
+		B: uint8(raw >> 8),
+	}
+}
+
+// Scale returns c with every channel multiplied by level/255.
+func (c RGB) Scale(level uint8) RGB {
+	return RGB{
+		R: scale8(c.R, level),
+		G: scale8(c.G, level),
+		B: scale8(c.B, level),
+	}
+}
+
+// Lerp blends c towards to. t is 0 (c) to 255 (to).
+func (c RGB) Lerp(to RGB, t uint8) RGB {
+	return RGB{
+		R: lerp8(c.R, to.R, t),
+		G: lerp8(c.G, to.G, t),
+		B: lerp8(c.B, to.B, t),
+	}
+}
+
+// RGB converts h to RGB.
+func (h HSV) RGB() RGB {
+	if h.S == 0 {
+		return RGB{h.V, h.V, h.V}
+	}
+
+	hue := uint32(h.H % 360)
+	region := hue / 60
+	// position inside the region, 0-255
+	rem := (hue - region*60) * 255 / 60
+
+	v := uint32(h.V)
+	s := uint32(h.S)
+	p := uint8(v * (255 - s) / 255)
+	q := uint8(v * (255 - s*rem/255) / 255)
+	t := uint8(v * (255 - s*(255-rem)/255) / 255)
+
+	switch region {
+	case 0:
+		return RGB{h.V, t, p}
+	case 1:
+		return RGB{q, h.V, p}
+	case 2:
+		return RGB{p, h.V, t}
+	case 3:
+		return RGB{p, q, h.V}
+	case 4:
+		return RGB{t, p, h.V}
+	default:
+		return RGB{h.V, p, q}
+	}
+}
+
+// GRB is a shorthand for h.RGB().GRB().
+func (h HSV) GRB() uint32 {
+	return h.RGB().GRB()
+}
+
+func scale8(v, level uint8) uint8 {
+	return uint8((uint16(v)*uint16(level) + 255) >> 8)
+}
+
+func lerp8(a, b, t uint8) uint8 {
+	if b >= a {
+		return a + scale8(b-a, t)
+	}
+	return a - scale8(a-b, t)
+}
@@ -0,0 +1,117 @@
+package ledcolor
+
+// Budget estimates the current drawn by a frame and scales frames down so
+// that they stay under MaxMilliamps. All 12 LEDs at 0xFFFFFF draw roughly
+// 12 * 3 * 12mA = 432mA, which is too much next to the RP2040 and OLED on a
+// single USB port.
+type Budget struct {
+	MaxMilliamps     int // 0 disables limiting
+	ChannelMilliamps int // current of a single channel at 255
+	IdleMilliamps    int // current of a single LED that is switched off
+}
+
+// DefaultBudget keeps the LEDs under 200mA.
+var DefaultBudget = Budget{
+	MaxMilliamps:     200,
+	ChannelMilliamps: 12,
+	IdleMilliamps:    1,
+}
+
+// Milliamps returns the estimated current of raw GRB values.
+func (b Budget) Milliamps(raw []uint32) int {
+	return b.idle(len(raw)) + b.active(raw)/255
+}
+
+// Limit scales raw in place so that it stays under MaxMilliamps and returns
+// the brightness level (255 = unchanged) that was applied.
+func (b Budget) Limit(raw []uint32) uint8 {
+	if b.MaxMilliamps <= 0 || b.ChannelMilliamps <= 0 {
+		return 255
+	}
+	avail := (b.MaxMilliamps - b.idle(len(raw))) * 255
+	active := b.active(raw)
+	if active <= avail {
+		return 255
+	}
+	if avail <= 0 {
+		avail = 0
+	}
+	level := uint8(avail * 255 / active)
+	for i := range raw {
+		raw[i] = FromGRB(raw[i]).Scale(level).GRB()
+	}
+	return level
+}
+
+func (b Budget) idle(n int) int {
+	return n * b.IdleMilliamps
+}
+
+// active returns the channel current multiplied by 255.
+func (b Budget) active(raw []uint32) int {
+	sum := 0
+	for _, v := range raw {
+		c := FromGRB(v)
+		sum += int(c.R) + int(c.G) + int(c.B)
+	}
+	return sum * b.ChannelMilliamps
+}
+
+// Strip turns RGB frames into raw values for piolib.WS2812B.WriteRaw while
+// applying gamma correction, a global brightness and a current budget.
+//
+//	strip := ledcolor.NewStrip(12)
+//	strip.Brightness = 0x40
+//	ws.WriteRaw(strip.Render(frame))
+type Strip struct {
+	Brightness uint8 // global brightness, 255 = full
+	Gamma      bool  // apply Gamma8 before brightness
+	Budget     Budget
+
+	raw []uint32
+}
+
+// NewStrip returns a Strip for n LEDs with gamma correction enabled and
+// DefaultBudget.
+func NewStrip(n int) *Strip {
+	return &Strip{
+		Brightness: 255,
+		Gamma:      true,
+		Budget:     DefaultBudget,
+		raw:        make([]uint32, n),
+	}
+}
+
+// Render converts frame and returns the raw values. The returned slice is
+// reused by the next call.
+func (s *Strip) Render(frame []RGB) []uint32 {
+	for i := range s.raw {
+		c := Black
+		if i < len(frame) {
+			c = frame[i]
+		}
+		if s.Gamma {
+			c = c.Gamma()
+		}
+		s.raw[i] = c.Scale(s.Brightness).GRB()
+	}
+	s.Budget.Limit(s.raw)
+	return s.raw
+}
+
+// RenderRaw is like Render for frames that are already packed as GRB, such
+// as the colour tables of the existing examples.
+func (s *Strip) RenderRaw(frame []uint32) []uint32 {
+	for i := range s.raw {
+		c := Black
+		if i < len(frame) {
+			c = FromGRB(frame[i])
+		}
+		if s.Gamma {
+			c = c.Gamma()
+		}
+		s.raw[i] = c.Scale(s.Brightness).GRB()
+	}
+	s.Budget.Limit(s.raw)
+	return s.raw
+}
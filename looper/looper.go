@@ -0,0 +1,449 @@
+// Package looper records MIDI channel messages against clock ticks and plays
+// them back in a loop.
+//
+// The first recording sets the loop length, rounded to whole bars. Every
+// later recording is an overdub layer on top of the loop; the last layer can
+// be undone. Note starts can be quantised to a grid while playing. The
+// recorded ticks are kept as played, so changing Quantize takes effect on
+// the next pass and can be turned off again.
+//
+// Call Tick for every clock tick, usually MIDI clock at 24 ticks per quarter
+// note, with a tick counter that only goes up.
+package looper
+
+import "sort"
+
+// Default sizes used when the fields of Looper are zero.
+const (
+	DefaultBarTicks  = 96 // one 4/4 bar at 24 ticks per quarter note
+	DefaultMaxEvents = 2048
+)
+
+// Event is a recorded channel message.
+type Event struct {
+	Tick   int // position in the loop
+	Status uint8
+	Data1  uint8
+	Data2  uint8
+}
+
+// Channel returns the 1-origin channel of e.
+func (e Event) Channel() uint8 {
+	return e.Status&0x0F + 1
+}
+
+func (e Event) isNoteOn() bool {
+	return e.Status&0xF0 == 0x90 && e.Data2 > 0
+}
+
+func (e Event) isNoteOff() bool {
+	return e.Status&0xF0 == 0x80 || e.Status&0xF0 == 0x90 && e.Data2 == 0
+}
+
+// isController reports whether e is a continuous message, pitch bend or a
+// control change, of which only the last value within a tick matters.
+func (e Event) isController() bool {
+	return e.Status&0xF0 == 0xE0 || e.Status&0xF0 == 0xB0
+}
+
+// sameTarget reports whether e and f change the same thing.
+func (e Event) sameTarget(f Event) bool {
+	if e.Status != f.Status {
+		return false
+	}
+	return e.Status&0xF0 != 0xB0 || e.Data1 == f.Data1
+}
+
+// State is what the looper is doing.
+type State int
+
+const (
+	Empty       State = iota // nothing recorded
+	Recording                // recording the first layer, which sets the length
+	Playing                  // playing the loop
+	Overdubbing              // playing the loop and recording a new layer
+	Stopped                  // holding a loop without playing it
+)
+
+var stateNames = []string{"Empty", "Rec", "Play", "Dub", "Stop"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "?"
+	}
+	return stateNames[s]
+}
+
+// Looper is a MIDI phrase looper. The zero value is an empty looper with
+// 4/4 bars and no quantisation.
+type Looper struct {
+	BarTicks  int // ticks per bar; 0 means DefaultBarTicks
+	Quantize  int // grid for note starts in ticks; 0 plays as recorded
+	MaxEvents int // limit of recorded events; 0 means DefaultMaxEvents
+
+	state  State
+	origin int // tick of loop position 0
+	length int // loop length in ticks
+	layers [][]Event
+	rec    []Event // layer being recorded
+	count  int     // events in layers
+
+	play      []Event // all layers merged, quantised and sorted
+	playQ     int     // Quantize used for play
+	playDirty bool
+
+	sounding [16][4]uint32 // notes started by playback, per channel
+}
+
+// State returns what the looper is doing.
+func (l *Looper) State() State {
+	return l.state
+}
+
+// Layers returns the number of recorded layers, not counting the one being
+// recorded.
+func (l *Looper) Layers() int {
+	return len(l.layers)
+}
+
+// Length returns the loop length in ticks, or 0 before the first recording
+// has finished.
+func (l *Looper) Length() int {
+	return l.length
+}
+
+// Events returns the number of recorded events.
+func (l *Looper) Events() int {
+	return l.count + len(l.rec)
+}
+
+// Position returns the position of tick in the loop.
+func (l *Looper) Position(tick int) int {
+	if l.length == 0 {
+		return 0
+	}
+	return mod(tick-l.origin, l.length)
+}
+
+func (l *Looper) barTicks() int {
+	if l.BarTicks <= 0 {
+		return DefaultBarTicks
+	}
+	return l.BarTicks
+}
+
+func (l *Looper) maxEvents() int {
+	if l.MaxEvents <= 0 {
+		return DefaultMaxEvents
+	}
+	return l.MaxEvents
+}
+
+// Record starts recording. On an empty looper it starts the first layer
+// with loop position 0 at tick; callers usually round tick to a beat so that
+// notes played slightly early still fall into the loop. While playing it
+// starts an overdub layer. A stopped loop is restarted from its beginning at
+// tick and overdubbed.
+func (l *Looper) Record(tick int) {
+	switch l.state {
+	case Empty:
+		l.origin = tick
+		l.rec = l.rec[:0]
+		l.state = Recording
+	case Stopped:
+		l.origin = tick
+		fallthrough
+	case Playing:
+		l.rec = l.rec[:0]
+		l.state = Overdubbing
+	}
+}
+
+// Play finishes the layer being recorded and plays the loop. A stopped loop
+// is restarted from its beginning at tick.
+func (l *Looper) Play(tick int) {
+	switch l.state {
+	case Recording, Overdubbing:
+		l.finish(tick)
+		l.state = Playing
+	case Stopped:
+		l.origin = tick
+		l.state = Playing
+	}
+}
+
+// Stop finishes the layer being recorded, stops the loop and ends the notes
+// it started.
+func (l *Looper) Stop(tick int, emit func(Event)) {
+	switch l.state {
+	case Recording, Overdubbing:
+		l.finish(tick)
+	case Empty:
+		return
+	}
+	l.state = Stopped
+	l.release(emit)
+}
+
+// Undo drops the layer being recorded or, if none, the last recorded layer.
+// Undoing the first layer empties the looper.
+func (l *Looper) Undo(emit func(Event)) {
+	switch l.state {
+	case Recording:
+		l.rec = l.rec[:0]
+		l.state = Empty
+		return
+	case Overdubbing:
+		l.rec = l.rec[:0]
+		l.state = Playing
+		return
+	}
+	if len(l.layers) == 0 {
+		return
+	}
+	l.release(emit)
+	last := len(l.layers) - 1
+	l.count -= len(l.layers[last])
+	l.layers[last] = nil
+	l.layers = l.layers[:last]
+	l.playDirty = true
+	if len(l.layers) == 0 {
+		l.state = Empty
+		l.length = 0
+	}
+}
+
+// Clear ends the notes started by the loop and forgets everything.
+func (l *Looper) Clear(emit func(Event)) {
+	l.release(emit)
+	l.state = Empty
+	l.length = 0
+	l.layers = nil
+	l.rec = l.rec[:0]
+	l.count = 0
+	l.play = nil
+	l.playDirty = false
+}
+
+// Input records a message played at tick. It reports false if the message
+// was not recorded because the looper is not recording, the message is not
+// a channel message, it ends a note that was not recorded or the event limit
+// has been reached.
+func (l *Looper) Input(tick int, status, data1, data2 uint8) bool {
+	if l.state != Recording && l.state != Overdubbing {
+		return false
+	}
+	if status < 0x80 || status >= 0xF0 {
+		return false
+	}
+	e := Event{Tick: tick - l.origin, Status: status, Data1: data1, Data2: data2}
+	if l.state == Overdubbing {
+		e.Tick = mod(e.Tick, l.length)
+	}
+
+	// a continuous controller only needs its last value in a tick
+	if e.isController() {
+		for i := len(l.rec) - 1; i >= 0 && l.rec[i].Tick == e.Tick; i-- {
+			if l.rec[i].sameTarget(e) {
+				l.rec[i] = e
+				return true
+			}
+		}
+	}
+	// an overdub can end a note that was held before it started
+	if e.isNoteOff() && l.openNote(e) < 0 {
+		return false
+	}
+	if !e.isNoteOff() && l.Events() >= l.maxEvents() {
+		return false
+	}
+	l.rec = append(l.rec, e)
+	return true
+}
+
+// openNote returns the index of the recorded note-on that off ends, or -1.
+func (l *Looper) openNote(off Event) int {
+	for i := len(l.rec) - 1; i >= 0; i-- {
+		e := l.rec[i]
+		if e.Status&0x0F != off.Status&0x0F || e.Data1 != off.Data1 {
+			continue
+		}
+		if e.isNoteOn() {
+			return i
+		}
+		if e.isNoteOff() {
+			return -1
+		}
+	}
+	return -1
+}
+
+// finish ends the recorded layer at tick and adds it to the loop.
+func (l *Looper) finish(tick int) {
+	end := tick - l.origin
+	if l.state == Recording {
+		// round to the nearest bar
+		bar := l.barTicks()
+		l.length = (end + bar/2) / bar * bar
+		if l.length < bar {
+			l.length = bar
+		}
+	} else {
+		end = mod(end, l.length)
+	}
+
+	// end the notes that are still held, and notes that ended in the same
+	// tick so that they are not lost on playback
+	for i := 0; i < len(l.rec); i++ {
+		e := l.rec[i]
+		if !e.isNoteOn() {
+			continue
+		}
+		off := findNoteOff(l.rec, i)
+		if off < 0 {
+			l.rec = append(l.rec, Event{Tick: end, Status: 0x80 | e.Status&0x0F, Data1: e.Data1})
+			off = len(l.rec) - 1
+		}
+		if l.rec[off].Tick == e.Tick {
+			l.rec[off].Tick++
+		}
+	}
+
+	layer := make([]Event, len(l.rec))
+	for i, e := range l.rec {
+		e.Tick = mod(e.Tick, l.length)
+		layer[i] = e
+	}
+	l.layers = append(l.layers, layer)
+	l.count += len(layer)
+	l.rec = l.rec[:0]
+	l.playDirty = true
+}
+
+// findNoteOff returns the index of the note-off that ends the note-on at
+// index on, or -1.
+func findNoteOff(events []Event, on int) int {
+	e := events[on]
+	for i := on + 1; i < len(events); i++ {
+		f := events[i]
+		if f.Status&0x0F != e.Status&0x0F || f.Data1 != e.Data1 {
+			continue
+		}
+		if f.isNoteOff() {
+			return i
+		}
+		if f.isNoteOn() {
+			return -1
+		}
+	}
+	return -1
+}
+
+// build merges the layers into the play list, moving every note to the
+// quantise grid together with its note-off.
+func (l *Looper) build() {
+	l.play = l.play[:0]
+	q := l.Quantize
+	for _, layer := range l.layers {
+		start := len(l.play)
+		l.play = append(l.play, layer...)
+		if q <= 0 {
+			continue
+		}
+		events := l.play[start:]
+		for i, e := range events {
+			if !e.isNoteOn() {
+				continue
+			}
+			shift := (e.Tick+q/2)/q*q - e.Tick
+			events[i].Tick = mod(e.Tick+shift, l.length)
+			if off := findNoteOff(layer, i); off >= 0 {
+				events[off].Tick = mod(layer[off].Tick+shift, l.length)
+			}
+		}
+	}
+	// note-offs first so that a repeated note is not cut by its previous
+	// note-off
+	sort.SliceStable(l.play, func(i, j int) bool {
+		a, b := l.play[i], l.play[j]
+		if a.Tick != b.Tick {
+			return a.Tick < b.Tick
+		}
+		return a.isNoteOff() && !b.isNoteOff()
+	})
+	l.playQ = q
+	l.playDirty = false
+}
+
+// Tick plays the events at tick. Call it once for every tick in order.
+func (l *Looper) Tick(tick int, emit func(Event)) {
+	if l.state != Playing && l.state != Overdubbing {
+		return
+	}
+	if l.playDirty || l.playQ != l.Quantize {
+		l.build()
+	}
+	pos := l.Position(tick)
+	i := sort.Search(len(l.play), func(i int) bool {
+		return l.play[i].Tick >= pos
+	})
+	for ; i < len(l.play) && l.play[i].Tick == pos; i++ {
+		e := l.play[i]
+		ch, bit := e.Status&0x0F, uint32(1)<<(e.Data1&31)
+		w := &l.sounding[ch][e.Data1>>5]
+		switch {
+		case e.isNoteOn():
+			if *w&bit != 0 {
+				// stop the same note of another layer first
+				emit(Event{Tick: pos, Status: 0x80 | ch, Data1: e.Data1})
+			}
+			*w |= bit
+		case e.isNoteOff():
+			if *w&bit == 0 {
+				continue
+			}
+			*w &^= bit
+		}
+		emit(e)
+	}
+}
+
+// release ends the notes started by playback and resets the pitch bend and
+// modulation of the channels the loop used.
+func (l *Looper) release(emit func(Event)) {
+	for ch := range l.sounding {
+		for w, bits := range l.sounding[ch] {
+			for b := 0; bits != 0; b++ {
+				if bits&1 != 0 {
+					emit(Event{Status: 0x80 | uint8(ch), Data1: uint8(w*32 + b)})
+				}
+				bits >>= 1
+			}
+		}
+		l.sounding[ch] = [4]uint32{}
+	}
+
+	var bend, wheel uint16
+	for _, layer := range l.layers {
+		for _, e := range layer {
+			switch {
+			case e.Status&0xF0 == 0xE0:
+				bend |= 1 << (e.Status & 0x0F)
+			case e.Status&0xF0 == 0xB0 && e.Data1 == 1:
+				wheel |= 1 << (e.Status & 0x0F)
+			}
+		}
+	}
+	for ch := uint8(0); ch < 16; ch++ {
+		if bend&(1<<ch) != 0 {
+			emit(Event{Status: 0xE0 | ch, Data1: 0x00, Data2: 0x40})
+		}
+		if wheel&(1<<ch) != 0 {
+			emit(Event{Status: 0xB0 | ch, Data1: 1, Data2: 0})
+		}
+	}
+}
+
+func mod(v, n int) int {
+	return ((v % n) + n) % n
+}
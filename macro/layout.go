@@ -0,0 +1,110 @@
+package macro
+
+import "machine/usb/hid/keyboard"
+
+// Keys of Japanese keyboards that US keyboards lack.
+const (
+	KeyRo  keyboard.Keycode = 0x87 | 0xF000 // International1, "\" and "_" left of right shift
+	KeyYen keyboard.Keycode = 0x89 | 0xF000 // International3, "¥" and "|" left of backspace
+)
+
+// Layout tells which key types each character, as set in the keyboard
+// settings of the host. The keyboard itself only sends key positions, so
+// text typed with the wrong layout comes out with the wrong symbols.
+type Layout struct {
+	Name string
+	keys map[rune]stroke
+}
+
+type stroke struct {
+	code  keyboard.Keycode
+	shift bool
+}
+
+// Lookup returns the key that types r and whether shift must be held, or
+// ok false if r cannot be typed with the layout.
+func (l *Layout) Lookup(r rune) (code keyboard.Keycode, shift, ok bool) {
+	s, ok := l.keys[r]
+	return s.code, s.shift, ok
+}
+
+// keyChars lists a key with the character it types and, if any, the
+// character it types with shift.
+type keyChars struct {
+	code  keyboard.Keycode
+	chars string
+}
+
+func newLayout(name string, table []keyChars) *Layout {
+	l := &Layout{Name: name, keys: map[rune]stroke{}}
+	for i := keyboard.Keycode(0); i < 26; i++ {
+		l.keys['a'+rune(i)] = stroke{code: keyboard.KeyA + i}
+		l.keys['A'+rune(i)] = stroke{code: keyboard.KeyA + i, shift: true}
+	}
+	l.keys[' '] = stroke{code: keyboard.KeySpace}
+	l.keys['\n'] = stroke{code: keyboard.KeyEnter}
+	l.keys['\t'] = stroke{code: keyboard.KeyTab}
+	for _, k := range table {
+		for i, r := range []rune(k.chars) {
+			l.keys[r] = stroke{code: k.code, shift: i == 1}
+		}
+	}
+	return l
+}
+
+// US is the layout of US keyboards.
+var US = newLayout("US", []keyChars{
+	{keyboard.Key1, "1!"},
+	{keyboard.Key2, "2@"},
+	{keyboard.Key3, "3#"},
+	{keyboard.Key4, "4$"},
+	{keyboard.Key5, "5%"},
+	{keyboard.Key6, "6^"},
+	{keyboard.Key7, "7&"},
+	{keyboard.Key8, "8*"},
+	{keyboard.Key9, "9("},
+	{keyboard.Key0, "0)"},
+	{keyboard.KeyMinus, "-_"},
+	{keyboard.KeyEqual, "=+"},
+	{keyboard.KeyLeftBrace, "[{"},
+	{keyboard.KeyRightBrace, "]}"},
+	{keyboard.KeyBackslash, `\|`},
+	{keyboard.KeySemicolon, ";:"},
+	{keyboard.KeyQuote, `'"`},
+	{keyboard.KeyTilde, "`~"},
+	{keyboard.KeyComma, ",<"},
+	{keyboard.KeyPeriod, ".>"},
+	{keyboard.KeySlash, "/?"},
+})
+
+// JIS is the layout of Japanese keyboards, as set up on Windows and Linux.
+// The keys keep their US names: KeyLeftBrace types "@", KeyQuote types ":"
+// and so on.
+var JIS = newLayout("JIS", []keyChars{
+	{keyboard.Key1, "1!"},
+	{keyboard.Key2, `2"`},
+	{keyboard.Key3, "3#"},
+	{keyboard.Key4, "4$"},
+	{keyboard.Key5, "5%"},
+	{keyboard.Key6, "6&"},
+	{keyboard.Key7, "7'"},
+	{keyboard.Key8, "8("},
+	{keyboard.Key9, "9)"},
+	{keyboard.Key0, "0"},
+	{keyboard.KeyMinus, "-="},
+	{keyboard.KeyEqual, "^~"},
+	{keyboard.KeyLeftBrace, "@`"},
+	{keyboard.KeyRightBrace, "[{"},
+	{keyboard.KeyNonUsNum, "]}"},
+	{keyboard.KeySemicolon, ";+"},
+	{keyboard.KeyQuote, ":*"},
+	{keyboard.KeyComma, ",<"},
+	{keyboard.KeyPeriod, ".>"},
+	{keyboard.KeySlash, "/?"},
+	{KeyRo, `\_`},
+	{KeyYen, "¥|"},
+})
+
+// Layouts lists the layouts in the order a layout switch cycles through
+// them.
+var Layouts = []*Layout{US, JIS}
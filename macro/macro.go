@@ -0,0 +1,307 @@
+// Package macro types text and runs sequences of key presses on a USB HID
+// keyboard.
+//
+// A Macro is a list of steps: text to type, keys to tap with modifiers,
+// keys to hold down and let go, and pauses. Text is typed with the keys of
+// a Layout, so symbols such as "@" come out right whether the host expects
+// a US or a Japanese (JIS) keyboard.
+//
+// A Runner sends one key event at a time from Update, which the main loop
+// calls along with scanning the keys, so a long macro does not stop the
+// keyboard. It implements keymap.Macros for the M action of keymap.
+//
+// Other characters, such as Japanese, have no key. They are typed with one
+// of the Unicode input methods of the host: a hex code on Linux, macOS and
+// Windows with WinCompose, or romaji through the Japanese IME.
+package macro
+
+import (
+	"machine/usb/hid/keyboard"
+	"time"
+)
+
+// DefaultInterval is the time between two key events. Some hosts miss key
+// presses that come faster.
+const DefaultInterval = 5 * time.Millisecond
+
+type stepKind uint8
+
+const (
+	stepText stepKind = iota
+	stepReading
+	stepTap
+	stepDown
+	stepUp
+	stepDelay
+)
+
+// Step is one step of a macro.
+type Step struct {
+	kind    stepKind
+	text    string
+	reading string
+	code    keyboard.Keycode
+	mods    []keyboard.Keycode
+	delay   time.Duration
+}
+
+// Text types s. Shift is pressed and released as each character needs.
+// Characters that the layout cannot type, such as Japanese, are typed with
+// the Unicode method of the Runner, or skipped if it has none. Romaji only
+// types kana; kanji are skipped unless they are given with Reading.
+func Text(s string) Step {
+	return Step{kind: stepText, text: s}
+}
+
+// Reading types text, which is usually kanji, the same as Text. With the
+// Romaji method it types reading, in kana, and converts it with the IME
+// instead, which picks the first candidate and may get it wrong.
+func Reading(text, reading string) Step {
+	return Step{kind: stepReading, text: text, reading: reading}
+}
+
+// Tap presses and releases code with modifiers such as
+// keyboard.KeyModifierCtrl held.
+func Tap(code keyboard.Keycode, mods ...keyboard.Keycode) Step {
+	return Step{kind: stepTap, code: code, mods: mods}
+}
+
+// Down presses code and holds it for the following steps, for example a
+// modifier. Keys still held are released when the macro ends.
+func Down(code keyboard.Keycode) Step {
+	return Step{kind: stepDown, code: code}
+}
+
+// Up releases code pressed by Down.
+func Up(code keyboard.Keycode) Step {
+	return Step{kind: stepUp, code: code}
+}
+
+// Delay waits for d, for example while the host opens a window.
+func Delay(d time.Duration) Step {
+	return Step{kind: stepDelay, delay: d}
+}
+
+// Macro is a named list of steps.
+type Macro struct {
+	Name  string
+	Steps []Step
+}
+
+// Output sends key presses, such as keyboard.Port().
+type Output interface {
+	Down(c keyboard.Keycode) error
+	Up(c keyboard.Keycode) error
+}
+
+// event is a key going down or up after waiting for wait. An event with
+// code 0 only waits.
+type event struct {
+	code keyboard.Keycode
+	down bool
+	wait time.Duration
+}
+
+// Runner runs macros in the background of the main loop.
+type Runner struct {
+	Layout   *Layout       // layout of the host, used for Text
+	Unicode  Unicode       // how the host takes other characters
+	Interval time.Duration // time between key events
+
+	macros []Macro
+	out    Output
+	queue  []event
+	held   []keyboard.Keycode
+	next   time.Time // earliest time of the next event
+	idle   bool      // the queue was empty when Play was called
+}
+
+// NewRunner returns a Runner that types on out with the US layout and no
+// Unicode method. The macros are numbered from 0 for Run.
+func NewRunner(out Output, macros ...Macro) *Runner {
+	return &Runner{
+		Layout:   US,
+		Interval: DefaultInterval,
+		macros:   macros,
+		out:      out,
+	}
+}
+
+// Macro returns macro id, or nil if there is none.
+func (r *Runner) Macro(id int) *Macro {
+	if id < 0 || id >= len(r.macros) {
+		return nil
+	}
+	return &r.macros[id]
+}
+
+// Run starts macro id after the macros that are already running.
+func (r *Runner) Run(id int) {
+	if m := r.Macro(id); m != nil {
+		r.Play(m)
+	}
+}
+
+// Play starts m after the macros that are already running. Text is turned
+// into keys with the layout and Unicode method at the time Play is called.
+func (r *Runner) Play(m *Macro) {
+	var sc script
+	var held []keyboard.Keycode
+	for _, s := range m.Steps {
+		switch s.kind {
+		case stepText:
+			r.typeText(&sc, s.text)
+		case stepReading:
+			r.typeReading(&sc, s.text, s.reading)
+		case stepTap:
+			sc.tap(s.code, s.mods...)
+		case stepDown:
+			sc.add(s.code, true)
+			held = append(held, s.code)
+		case stepUp:
+			sc.add(s.code, false)
+			held = remove(held, s.code)
+		case stepDelay:
+			sc.wait += s.delay
+		}
+	}
+	for i := len(held) - 1; i >= 0; i-- {
+		sc.add(held[i], false)
+	}
+	if sc.wait > 0 {
+		sc.add(0, false)
+	}
+	if len(r.queue) == 0 {
+		r.idle = true
+	}
+	r.queue = append(r.queue, sc.events...)
+}
+
+// typeText adds the keys that type text. Characters that the layout has no
+// key for are typed with the Unicode method; with Romaji, kana always goes
+// through the IME.
+func (r *Runner) typeText(sc *script, text string) {
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if r.Unicode == Romaji {
+			if n, katakana := kanaRun(runes[i:]); n > 0 {
+				r.typeKana(sc, runes[i:i+n], katakana, false)
+				i += n
+				continue
+			}
+		}
+		c := runes[i]
+		i++
+		if code, shift, ok := r.Layout.Lookup(c); ok {
+			sc.shift(shift)
+			sc.add(code, true)
+			sc.add(code, false)
+			continue
+		}
+		sc.shift(false)
+		r.typeUnicode(sc, c)
+	}
+	sc.shift(false)
+}
+
+// typeASCII adds the keys that type s with the layout only.
+func (r *Runner) typeASCII(sc *script, s string) {
+	for _, c := range s {
+		if code, shift, ok := r.Layout.Lookup(c); ok {
+			sc.shift(shift)
+			sc.add(code, true)
+			sc.add(code, false)
+		}
+	}
+	sc.shift(false)
+}
+
+// script collects the events of a macro.
+type script struct {
+	events  []event
+	wait    time.Duration // wait before the next event
+	shifted bool          // shift is held for the characters typed
+}
+
+func (sc *script) add(code keyboard.Keycode, down bool) {
+	sc.events = append(sc.events, event{code: code, down: down, wait: sc.wait})
+	sc.wait = 0
+}
+
+// tap presses and releases code with mods held.
+func (sc *script) tap(code keyboard.Keycode, mods ...keyboard.Keycode) {
+	for _, mod := range mods {
+		sc.add(mod, true)
+	}
+	sc.add(code, true)
+	sc.add(code, false)
+	for i := len(mods) - 1; i >= 0; i-- {
+		sc.add(mods[i], false)
+	}
+}
+
+// shift presses or releases shift if it is not already so.
+func (sc *script) shift(on bool) {
+	if on != sc.shifted {
+		sc.add(keyboard.KeyModifierShift, on)
+		sc.shifted = on
+	}
+}
+
+// Busy reports whether a macro is running.
+func (r *Runner) Busy() bool {
+	return len(r.queue) > 0
+}
+
+// Stop cancels the macros and releases the keys they hold.
+func (r *Runner) Stop() {
+	r.queue = nil
+	for i := len(r.held) - 1; i >= 0; i-- {
+		r.out.Up(r.held[i])
+	}
+	r.held = r.held[:0]
+}
+
+// Update sends the key events that are due at now. Call it often from the
+// main loop.
+func (r *Runner) Update(now time.Time) {
+	if r.idle {
+		// a Delay at the start of a macro counts from when it was played,
+		// not from the last key of the macro before
+		r.idle = false
+		if r.next.Before(now) {
+			r.next = now
+		}
+	}
+	for len(r.queue) > 0 {
+		e := r.queue[0]
+		if now.Before(r.next.Add(e.wait)) {
+			return
+		}
+		r.queue = r.queue[1:]
+		r.send(e)
+		r.next = now.Add(r.Interval)
+	}
+}
+
+func (r *Runner) send(e event) {
+	switch {
+	case e.code == 0:
+	case e.down:
+		r.out.Down(e.code)
+		r.held = append(r.held, e.code)
+	default:
+		r.out.Up(e.code)
+		r.held = remove(r.held, e.code)
+	}
+}
+
+// remove removes the last occurrence of code from codes.
+func remove(codes []keyboard.Keycode, code keyboard.Keycode) []keyboard.Keycode {
+	for i := len(codes) - 1; i >= 0; i-- {
+		if codes[i] == code {
+			return append(codes[:i], codes[i+1:]...)
+		}
+	}
+	return codes
+}
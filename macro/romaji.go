@@ -0,0 +1,136 @@
+package macro
+
+import (
+	"machine/usb/hid/keyboard"
+	"strings"
+)
+
+// Keys that switch the Japanese IME on and off: かな and 英数 on Mac
+// keyboards, also understood by Windows 10 and later. Other hosts may have
+// to map them in the IME settings.
+const (
+	KeyKana keyboard.Keycode = 0x90 | 0xF000 // LANG1
+	KeyEisu keyboard.Keycode = 0x91 | 0xF000 // LANG2
+)
+
+// kanaTable lists hiragana with their romaji. Katakana is typed as
+// hiragana and then converted with F7, except ヷ to ヺ, which have no
+// hiragana and come out as ヴァ to ヴォ.
+const kanaTable = `
+あa いi うu えe おo かka きki くku けke こko
+さsa しshi すsu せse そso たta ちchi つtsu てte とto
+なna にni ぬnu ねne のno はha ひhi ふfu へhe ほho
+まma みmi むmu めme もmo やya ゆyu よyo
+らra りri るru れre ろro わwa ゐwi ゑwe をwo んnn
+がga ぎgi ぐgu げge ごgo ざza じji ずzu ぜze ぞzo
+だda ぢdi づdu でde どdo ばba びbi ぶbu べbe ぼbo
+ぱpa ぴpi ぷpu ぺpe ぽpo ゔvu
+ヷva ヸvi ヹve ヺvo
+ぁxa ぃxi ぅxu ぇxe ぉxo ゃxya ゅxyu ょxyo っxtu ゎxwa ゕxka ゖxke
+ー- 、, 。. 「[ 」] ・/ ！! ？?
+`
+
+var romajiTable = map[rune]string{}
+
+func init() {
+	for _, f := range strings.Fields(kanaTable) {
+		k := []rune(f)
+		romajiTable[k[0]] = string(k[1:])
+	}
+}
+
+type kanaKind uint8
+
+const (
+	notKana kanaKind = iota
+	hiragana
+	katakana
+	eitherKana // long vowel mark and punctuation
+)
+
+func kindOf(c rune) kanaKind {
+	switch {
+	case 'ぁ' <= c && c <= 'ゖ':
+		return hiragana
+	case 'ァ' <= c && c <= 'ヺ':
+		return katakana
+	}
+	if _, ok := romajiTable[c]; ok {
+		return eitherKana
+	}
+	return notKana
+}
+
+// kanaRun returns the length of the kana at the start of runes that are
+// all hiragana or all katakana, with the marks that go with both.
+func kanaRun(runes []rune) (n int, isKatakana bool) {
+	kind := notKana
+	for ; n < len(runes); n++ {
+		k := kindOf(runes[n])
+		if k == notKana || k != eitherKana && kind != notKana && k != kind {
+			break
+		}
+		if k != eitherKana {
+			kind = k
+		}
+	}
+	return n, kind == katakana
+}
+
+// romaji returns the romaji that an IME turns into kana.
+func romaji(kana []rune) string {
+	hira := make([]rune, len(kana))
+	for i, c := range kana {
+		if 'ァ' <= c && c <= 'ヶ' {
+			c -= 'ァ' - 'ぁ'
+		}
+		hira[i] = c
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(hira); i++ {
+		s := romajiTable[hira[i]]
+		// きゃ is kya, しゃ sha, じゃ ja
+		if i+1 < len(hira) && len(s) > 1 && s[len(s)-1] == 'i' {
+			if y, ok := smallY[hira[i+1]]; ok {
+				s = s[:len(s)-1]
+				if s != "sh" && s != "ch" && s != "j" {
+					s += "y"
+				}
+				s += y
+				i++
+			}
+		}
+		// っ doubles the next consonant: かった is katta
+		if hira[i] == 'っ' && i+1 < len(hira) {
+			if next := romajiTable[hira[i+1]]; next != "" && isConsonant(next[0]) {
+				s = next[:1]
+			}
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+var smallY = map[rune]string{'ゃ': "a", 'ゅ': "u", 'ょ': "o"}
+
+func isConsonant(c byte) bool {
+	return 'a' <= c && c <= 'z' && !strings.ContainsRune("aiueon", rune(c))
+}
+
+// typeKana adds the keys that type kana through the IME: switch it on, type
+// the romaji, convert to katakana with F7 or to kanji with Space, commit
+// with Enter and switch the IME off again.
+func (r *Runner) typeKana(sc *script, kana []rune, isKatakana, convert bool) {
+	sc.shift(false)
+	sc.tap(KeyKana)
+	r.typeASCII(sc, romaji(kana))
+	if isKatakana {
+		sc.tap(keyboard.KeyF7)
+	}
+	if convert {
+		sc.tap(keyboard.KeySpace)
+	}
+	sc.tap(keyboard.KeyEnter)
+	sc.tap(KeyEisu)
+}
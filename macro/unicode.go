@@ -0,0 +1,73 @@
+package macro
+
+import (
+	"machine/usb/hid/keyboard"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Unicode is a way to type characters that have no key on the host.
+type Unicode int
+
+const (
+	NoUnicode  Unicode = iota // skip them
+	Linux                     // Ctrl+Shift+U, the hex code and Space, in GTK and IBus
+	MacOS                     // the hex code with Option held, with the Unicode Hex Input source
+	WinCompose                // Right Alt as the compose key, u, the hex code and Enter
+	Romaji                    // kana as romaji through the Japanese IME, kanji only with Reading
+)
+
+// Unicodes lists the methods in the order a switch cycles through them.
+var Unicodes = []Unicode{NoUnicode, Linux, MacOS, WinCompose, Romaji}
+
+var unicodeNames = [...]string{"None", "Linux", "macOS", "WinCompose", "Romaji"}
+
+func (u Unicode) String() string {
+	if u < 0 || int(u) >= len(unicodeNames) {
+		return "Unicode(" + strconv.Itoa(int(u)) + ")"
+	}
+	return unicodeNames[u]
+}
+
+// typeUnicode adds the keys that type c with the hex code methods.
+func (r *Runner) typeUnicode(sc *script, c rune) {
+	hex := strconv.FormatInt(int64(c), 16)
+	switch r.Unicode {
+	case Linux:
+		sc.tap(keyboard.KeyU, keyboard.KeyModifierCtrl, keyboard.KeyModifierShift)
+		r.typeASCII(sc, hex)
+		sc.tap(keyboard.KeySpace)
+	case MacOS:
+		// 4 digits for each UTF-16 code unit, so that characters outside
+		// the BMP are typed as a surrogate pair
+		units := []rune{c}
+		if c > 0xFFFF {
+			hi, lo := utf16.EncodeRune(c)
+			units = []rune{hi, lo}
+		}
+		sc.add(keyboard.KeyModifierAlt, true)
+		for _, u := range units {
+			h := strconv.FormatInt(int64(u), 16)
+			for len(h) < 4 {
+				h = "0" + h
+			}
+			r.typeASCII(sc, h)
+		}
+		sc.add(keyboard.KeyModifierAlt, false)
+	case WinCompose:
+		sc.tap(keyboard.KeyModifierRightAlt)
+		r.typeASCII(sc, "u"+hex)
+		sc.tap(keyboard.KeyEnter)
+	}
+}
+
+// typeReading adds the keys that type text, or reading converted by the IME
+// with Romaji.
+func (r *Runner) typeReading(sc *script, text, reading string) {
+	if r.Unicode != Romaji || reading == "" {
+		r.typeText(sc, text)
+		return
+	}
+	sc.shift(false)
+	r.typeKana(sc, []rune(reading), false, true)
+}
@@ -0,0 +1,312 @@
+// Package midiclock generates and follows MIDI Timing Clock (24 pulses per
+// quarter note).
+//
+// Master produces clock ticks at a tempo. Follower tracks incoming ticks,
+// Start / Stop / Continue and Song Position Pointer and smooths the jitter
+// of USB delivery so that steps can be played at an even pace.
+package midiclock
+
+import "time"
+
+const (
+	// PPQN is the number of Timing Clock messages per quarter note.
+	PPQN = 24
+	// TicksPerStep is the number of ticks in a sixteenth note, which is also
+	// the unit of Song Position Pointer.
+	TicksPerStep = PPQN / 4
+)
+
+// TickInterval returns the time between two ticks at bpm.
+func TickInterval(bpm int) time.Duration {
+	if bpm <= 0 {
+		bpm = 1
+	}
+	return time.Minute / time.Duration(bpm*PPQN)
+}
+
+// BPM returns the tempo of a tick interval.
+func BPM(interval time.Duration) int {
+	if interval <= 0 {
+		return 0
+	}
+	return int((time.Minute + interval*PPQN/2) / (interval * PPQN))
+}
+
+// SwingTicks returns how many ticks every second sixteenth note is delayed
+// for swing, the percentage of a pair of steps taken by the first one. 50 is
+// straight and 75 the maximum.
+func SwingTicks(swing int) int {
+	if swing <= 50 {
+		return 0
+	}
+	if swing > 75 {
+		swing = 75
+	}
+	return ((swing-50)*2*TicksPerStep + 50) / 100
+}
+
+// StepAt reports whether a sixteenth note step starts at tick and which one,
+// with every second step delayed by swing.
+func StepAt(tick, swing int) (step int, ok bool) {
+	if tick < 0 {
+		return 0, false
+	}
+	delay := SwingTicks(swing)
+	switch tick % (2 * TicksPerStep) {
+	case 0:
+		return tick / TicksPerStep, true
+	case TicksPerStep + delay:
+		return (tick - delay) / TicksPerStep, true
+	}
+	return 0, false
+}
+
+// Master generates ticks. Tick n is due at start + n * interval, so late
+// polling does not accumulate drift.
+type Master struct {
+	interval time.Duration
+	base     time.Time // time of tick baseTick
+	baseTick int
+	next     int // next tick to report
+	running  bool
+}
+
+// SetBPM changes the tempo. While running, the ticks already reported keep
+// their time and the following ticks use the new interval.
+func (m *Master) SetBPM(bpm int) {
+	interval := TickInterval(bpm)
+	if m.running && m.interval > 0 {
+		m.base = m.tickTime(m.next - 1)
+		m.baseTick = m.next - 1
+	}
+	m.interval = interval
+}
+
+// BPM returns the current tempo.
+func (m *Master) BPM() int {
+	return BPM(m.interval)
+}
+
+// Start starts counting from tick 0 at now.
+func (m *Master) Start(now time.Time) {
+	m.StartAt(0, now)
+}
+
+// StartAt starts counting from tick at now. It is used for Continue.
+func (m *Master) StartAt(tick int, now time.Time) {
+	if m.interval == 0 {
+		m.interval = TickInterval(120)
+	}
+	m.base = now
+	m.baseTick = tick
+	m.next = tick
+	m.running = true
+}
+
+// Stop stops the clock. Position keeps the next tick for Continue.
+func (m *Master) Stop() {
+	m.running = false
+}
+
+// Rewind moves the position back to tick 0.
+func (m *Master) Rewind() {
+	m.next = 0
+}
+
+// Running reports whether the clock is running.
+func (m *Master) Running() bool {
+	return m.running
+}
+
+// Position returns the next tick to be reported.
+func (m *Master) Position() int {
+	return m.next
+}
+
+// Next reports the next due tick. Call it until ok is false.
+func (m *Master) Next(now time.Time) (tick int, ok bool) {
+	if !m.running || now.Before(m.tickTime(m.next)) {
+		return 0, false
+	}
+	tick = m.next
+	m.next++
+	return tick, true
+}
+
+// TickTime returns the time at which tick is due.
+func (m *Master) TickTime(tick int) time.Time {
+	return m.tickTime(tick)
+}
+
+func (m *Master) tickTime(tick int) time.Time {
+	return m.base.Add(time.Duration(tick-m.baseTick) * m.interval)
+}
+
+// Follower follows an external clock.
+type Follower struct {
+	// Smoothing controls how fast the estimated tempo and phase follow the
+	// incoming ticks. Larger is smoother but slower. 0 means 8.
+	Smoothing int
+
+	interval time.Duration // smoothed tick interval
+	phase    time.Time     // smoothed time of tick last
+	arrival  time.Time     // raw arrival time of the last tick
+	last     int           // last received tick
+	next     int           // position of the next received tick
+	running  bool
+	received int // ticks received since Start / Continue
+}
+
+// Start handles MIDI Start: the next tick is tick 0.
+func (f *Follower) Start() {
+	f.next = 0
+	f.last = -1
+	f.running = true
+	f.received = 0
+}
+
+// Continue handles MIDI Continue: counting resumes from the current song
+// position.
+func (f *Follower) Continue() {
+	f.last = f.next - 1
+	f.running = true
+	f.received = 0
+}
+
+// Stop handles MIDI Stop.
+func (f *Follower) Stop() {
+	f.running = false
+}
+
+// SongPosition handles Song Position Pointer. beats is in sixteenth notes.
+func (f *Follower) SongPosition(beats uint16) {
+	f.next = int(beats) * TicksPerStep
+	f.last = f.next - 1
+}
+
+// Running reports whether the external clock is running.
+func (f *Follower) Running() bool {
+	return f.running
+}
+
+// Clock handles a received Timing Clock message.
+func (f *Follower) Clock(now time.Time) {
+	k := time.Duration(f.Smoothing)
+	if k <= 0 {
+		k = 8
+	}
+
+	if !f.arrival.IsZero() {
+		d := now.Sub(f.arrival)
+		switch {
+		case f.interval == 0:
+			f.interval = d
+		case d < f.interval*4:
+			// ignore gaps such as a paused transport
+			f.interval += (d - f.interval) / k
+		}
+	}
+	f.arrival = now
+
+	if f.received < 2 || f.interval == 0 {
+		f.phase = now
+	} else {
+		// move the phase only part of the way to the arrival time
+		pk := k / 2
+		if pk < 1 {
+			pk = 1
+		}
+		predicted := f.phase.Add(f.interval)
+		f.phase = predicted.Add(now.Sub(predicted) / pk)
+	}
+
+	if f.running {
+		f.last = f.next
+		f.next++
+		f.received++
+	}
+}
+
+// Interval returns the smoothed tick interval.
+func (f *Follower) Interval() time.Duration {
+	return f.interval
+}
+
+// BPM returns the smoothed tempo.
+func (f *Follower) BPM() int {
+	return BPM(f.interval)
+}
+
+// Position returns the current tick using the smoothed phase. It may run
+// one tick ahead of the received ticks so that a slightly late tick does not
+// delay the beat, and returns -1 before the first tick.
+func (f *Follower) Position(now time.Time) int {
+	if !f.running || f.last < 0 {
+		return f.last
+	}
+	if f.interval <= 0 || f.received < 2 {
+		return f.last
+	}
+	ahead := int(now.Sub(f.phase) / f.interval)
+	if ahead > 1 {
+		ahead = 1
+	}
+	if ahead < 0 {
+		ahead = 0
+	}
+	return f.last + ahead
+}
+
+// Tap estimates a tempo from taps such as a key pressed on every beat. It
+// averages the intervals of the last taps and starts over after a pause.
+type Tap struct {
+	// N is the number of intervals averaged, up to 8. 0 means 4.
+	N int
+	// Timeout is the pause after which taps start over. 0 means 2 seconds.
+	Timeout time.Duration
+
+	taps  [9]time.Time // ring of the last taps
+	next  int
+	count int // taps in the ring
+}
+
+// Tap records a tap at now and returns the tempo once there are at least
+// two taps.
+func (t *Tap) Tap(now time.Time) (bpm int, ok bool) {
+	n := t.N
+	if n <= 0 {
+		n = 4
+	} else if n > len(t.taps)-1 {
+		n = len(t.taps) - 1
+	}
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	if t.count > 0 {
+		last := t.taps[(t.next+len(t.taps)-1)%len(t.taps)]
+		if now.Sub(last) > timeout {
+			t.count = 0
+		}
+	}
+	t.taps[t.next] = now
+	t.next = (t.next + 1) % len(t.taps)
+	if t.count < len(t.taps) {
+		t.count++
+	}
+	if t.count < 2 {
+		return 0, false
+	}
+
+	intervals := t.count - 1
+	if intervals > n {
+		intervals = n
+	}
+	first := t.taps[(t.next+len(t.taps)-1-intervals)%len(t.taps)]
+	avg := now.Sub(first) / time.Duration(intervals)
+	if avg <= 0 {
+		return 0, false
+	}
+	return int((time.Minute + avg/2) / avg), true
+}
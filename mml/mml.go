@@ -0,0 +1,351 @@
+// Package mml parses Music Macro Language melodies and plays them on a
+// buzzer.
+//
+// A melody is a string of commands:
+//
+//	C D E F G A B  note, followed by + or # (sharp) or - (flat), an optional
+//	               length and dots: C4. is a dotted quarter C
+//	R (or P)       rest, with an optional length and dots
+//	O n            octave (0 to 9, default 4); O4 C is middle C (MIDI 60)
+//	> <            one octave up / down
+//	L n            default length (default 4), may be dotted: L8.
+//	T n            tempo in quarter notes per minute (default 120)
+//	Q n            gate, the part of a note that sounds in eighths (1 to 8,
+//	               default 8)
+//	V n            volume (0 to 15, default 15)
+//	&              tie: C4&C8 is one note, C4&8 too; C4&D4 slurs into the
+//	               next note without a gap
+//	"text"         lyric marker, passed to the player's handler
+//	; text         comment up to the end of the line
+//
+// Lengths are note values: 1 is a whole note, 4 a quarter and 8 an eighth.
+// Spaces, line breaks and bar lines (|) are ignored and commands are not
+// case sensitive.
+package mml
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ReleaseGap is the silence inserted at the end of Q8 notes that are not
+// tied, so that repeated notes can be told apart on a buzzer.
+const ReleaseGap = 10 * time.Millisecond
+
+// Defaults of the commands.
+const (
+	DefaultTempo  = 120
+	DefaultOctave = 4
+	DefaultLength = 4
+	DefaultGate   = 8
+	DefaultVolume = 15
+)
+
+// wholeTicks is the internal resolution of a whole note. It is divisible by
+// the usual note values including triplets.
+const wholeTicks = 1920
+
+// Event is a note, a rest or a lyric marker.
+type Event struct {
+	Note   uint8         // MIDI note number, for notes
+	Rest   bool          // the event is a rest
+	Lyric  string        // the event is a lyric marker, which takes no time
+	Length time.Duration // time until the next event
+	Gate   time.Duration // time the note sounds
+	Volume uint8         // 0 to 15
+}
+
+// IsNote reports whether e is a note.
+func (e Event) IsNote() bool {
+	return !e.Rest && e.Lyric == ""
+}
+
+// Song is a parsed melody.
+type Song struct {
+	Events   []Event
+	Duration time.Duration
+}
+
+// Notes returns the number of notes in s.
+func (s *Song) Notes() int {
+	n := 0
+	for _, e := range s.Events {
+		if e.IsNote() {
+			n++
+		}
+	}
+	return n
+}
+
+// Parse parses an MML melody.
+func Parse(src string) (*Song, error) {
+	p := parser{
+		src:    src,
+		tempo:  DefaultTempo,
+		octave: DefaultOctave,
+		length: wholeTicks / DefaultLength,
+		gate:   DefaultGate,
+		volume: DefaultVolume,
+		tied:   -1,
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	s := &Song{Events: p.events}
+	for _, e := range s.Events {
+		s.Duration += e.Length
+	}
+	return s, nil
+}
+
+// MustParse is like Parse but panics on errors. It is meant for melodies
+// embedded in the program.
+func MustParse(src string) *Song {
+	s, err := Parse(src)
+	if err != nil {
+		panic("mml: " + err.Error())
+	}
+	return s
+}
+
+type parser struct {
+	src    string
+	pos    int
+	tempo  int
+	octave int
+	length int // default length in ticks
+	gate   int
+	volume int
+	events []Event
+	tied   int // index of the note that the next note is tied to, or -1
+}
+
+func (p *parser) parse() error {
+	for p.pos < len(p.src) {
+		c := upper(p.src[p.pos])
+		start := p.pos
+		p.pos++
+		var err error
+		switch c {
+		case ' ', '\t', '\r', '\n', '|':
+		case ';':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case '"':
+			err = p.lyric()
+		case 'C', 'D', 'E', 'F', 'G', 'A', 'B':
+			err = p.note(c)
+		case 'R', 'P':
+			err = p.rest()
+		case 'O':
+			p.octave, err = p.value(0, 9)
+		case '>':
+			if p.octave++; p.octave > 9 {
+				err = errors.New("octave above 9")
+			}
+		case '<':
+			if p.octave--; p.octave < 0 {
+				err = errors.New("octave below 0")
+			}
+		case 'L':
+			p.length, err = p.noteLength(0)
+		case 'T':
+			p.tempo, err = p.value(20, 400)
+		case 'Q':
+			p.gate, err = p.value(1, 8)
+		case 'V':
+			p.volume, err = p.value(0, 15)
+		case '&':
+			err = p.tie()
+		default:
+			err = errors.New("unknown command " + strconv.QuoteRune(rune(p.src[start])))
+		}
+		if err != nil {
+			return p.errorAt(start, err)
+		}
+	}
+	if p.tied >= 0 {
+		return p.errorAt(len(p.src), errors.New("tie at the end"))
+	}
+	return nil
+}
+
+// errorAt adds the line and column of pos to err.
+func (p *parser) errorAt(pos int, err error) error {
+	line, col := 1, 1
+	for i := 0; i < pos && i < len(p.src); i++ {
+		if p.src[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return errors.New("line " + strconv.Itoa(line) + " col " + strconv.Itoa(col) + ": " + err.Error())
+}
+
+// number reads a decimal number and reports whether there was one.
+func (p *parser) number() (int, bool) {
+	n, ok := 0, false
+	for p.pos < len(p.src) && '0' <= p.src[p.pos] && p.src[p.pos] <= '9' {
+		n = n*10 + int(p.src[p.pos]-'0')
+		if n > 100000 {
+			n = 100000
+		}
+		p.pos++
+		ok = true
+	}
+	return n, ok
+}
+
+// value reads the number of a command.
+func (p *parser) value(min, max int) (int, error) {
+	n, ok := p.number()
+	if !ok {
+		return 0, errors.New("missing number")
+	}
+	if n < min || n > max {
+		return 0, errors.New("value must be " + strconv.Itoa(min) + " to " + strconv.Itoa(max))
+	}
+	return n, nil
+}
+
+// noteLength reads an optional note value and dots and returns the length
+// in ticks. Without a note value def is used; def 0 means a value is needed.
+func (p *parser) noteLength(def int) (int, error) {
+	ticks := def
+	if n, ok := p.number(); ok {
+		if n < 1 || n > wholeTicks {
+			return 0, errors.New("bad length " + strconv.Itoa(n))
+		}
+		ticks = wholeTicks / n
+	} else if def == 0 {
+		return 0, errors.New("missing length")
+	}
+	for add := ticks / 2; p.pos < len(p.src) && p.src[p.pos] == '.'; add /= 2 {
+		ticks += add
+		p.pos++
+	}
+	return ticks, nil
+}
+
+// duration returns the time of ticks at the current tempo.
+func (p *parser) duration(ticks int) time.Duration {
+	return time.Duration(ticks) * 4 * time.Minute / time.Duration(wholeTicks*p.tempo)
+}
+
+var pitches = map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+func (p *parser) note(c byte) error {
+	n := (p.octave+1)*12 + pitches[c]
+	if p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '+', '#':
+			n++
+			p.pos++
+		case '-':
+			n--
+			p.pos++
+		}
+	}
+	if n < 0 || n > 127 {
+		return errors.New("note out of range")
+	}
+	ticks, err := p.noteLength(p.length)
+	if err != nil {
+		return err
+	}
+
+	if p.tied >= 0 && p.events[p.tied].Note == uint8(n) {
+		p.extend(ticks)
+		return nil
+	}
+	if p.tied >= 0 {
+		// a slur keeps the previous note sounding up to this one
+		prev := &p.events[p.tied]
+		prev.Gate = prev.Length
+		p.tied = -1
+	}
+	p.add(Event{Note: uint8(n), Volume: uint8(p.volume)}, ticks)
+	return nil
+}
+
+func (p *parser) rest() error {
+	if p.tied >= 0 {
+		return errors.New("tie to a rest")
+	}
+	ticks, err := p.noteLength(p.length)
+	if err != nil {
+		return err
+	}
+	p.add(Event{Rest: true}, ticks)
+	return nil
+}
+
+func (p *parser) lyric() error {
+	end := p.pos
+	for end < len(p.src) && p.src[end] != '"' {
+		end++
+	}
+	if end == len(p.src) {
+		return errors.New("unterminated lyric")
+	}
+	p.events = append(p.events, Event{Lyric: p.src[p.pos:end]})
+	p.pos = end + 1
+	return nil
+}
+
+// tie handles &. A length right after it extends the last note; otherwise
+// the next note is tied to it if it has the same pitch, or slurred to.
+func (p *parser) tie() error {
+	last := len(p.events) - 1
+	if last < 0 || !p.events[last].IsNote() {
+		return errors.New("tie without a note")
+	}
+	p.tied = last
+	if p.pos < len(p.src) && '0' <= p.src[p.pos] && p.src[p.pos] <= '9' {
+		ticks, err := p.noteLength(0)
+		if err != nil {
+			return err
+		}
+		p.extend(ticks)
+	}
+	return nil
+}
+
+// extend makes the tied note longer by ticks at the current tempo.
+func (p *parser) extend(ticks int) {
+	e := &p.events[p.tied]
+	e.Length += p.duration(ticks)
+	e.Gate = p.gateOf(e.Length)
+	p.tied = -1
+}
+
+// add appends an event of ticks length.
+func (p *parser) add(e Event, ticks int) {
+	e.Length = p.duration(ticks)
+	if e.IsNote() {
+		e.Gate = p.gateOf(e.Length)
+	}
+	p.events = append(p.events, e)
+}
+
+// gateOf returns how long a note of length sounds with the current Q.
+func (p *parser) gateOf(length time.Duration) time.Duration {
+	if p.gate < 8 {
+		return length * time.Duration(p.gate) / 8
+	}
+	if length > 2*ReleaseGap {
+		return length - ReleaseGap
+	}
+	return length
+}
+
+func upper(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
@@ -0,0 +1,139 @@
+package mml
+
+import "time"
+
+// Speaker is the buzzer that Player plays on. Notes are MIDI note numbers,
+// the numbering of tone.Note, so a tone.Speaker only has to convert them.
+type Speaker interface {
+	SetNote(note uint8)
+	Stop()
+}
+
+// VolumeSpeaker is a Speaker whose loudness can be set. Player sets the
+// volume of every note (0 to 15, see the V command) before starting it.
+type VolumeSpeaker interface {
+	Speaker
+	SetVolume(volume uint8)
+}
+
+// Player plays a Song on a Speaker without blocking. Call Update from the
+// main loop.
+type Player struct {
+	speaker  Speaker
+	song     *Song
+	next     int       // index of the next event
+	at       time.Time // time of the next event
+	cur      int       // index of the last event started, or -1
+	started  time.Time // time at which the last event started
+	off      time.Time // time at which the sounding note stops
+	sounding bool
+	playing  bool
+}
+
+// NewPlayer returns a stopped player that plays on speaker.
+func NewPlayer(speaker Speaker) *Player {
+	return &Player{speaker: speaker, cur: -1}
+}
+
+// Play starts s from the beginning at now.
+func (p *Player) Play(s *Song, now time.Time) {
+	p.PlayAt(s, 0, now)
+}
+
+// PlayAt starts s from its i-th event at now. It is used to resume a song
+// that was interrupted.
+func (p *Player) PlayAt(s *Song, i int, now time.Time) {
+	p.Stop()
+	p.song = s
+	p.next = i
+	p.at = now
+	p.cur = -1
+	p.playing = true
+}
+
+// PlayFrom starts s elapsed into its i-th event at now, so that the event
+// only lasts as long as it had left. Position returns i and elapsed of an
+// event that was cut off.
+func (p *Player) PlayFrom(s *Song, i int, elapsed time.Duration, now time.Time) {
+	if elapsed <= 0 || i < 0 || i >= len(s.Events) {
+		p.PlayAt(s, i, now)
+		return
+	}
+	e := s.Events[i]
+	if elapsed >= e.Gate {
+		// only the silence after the note is left
+		p.PlayAt(s, i+1, now.Add(e.Length-elapsed))
+		return
+	}
+	p.PlayAt(s, i, now.Add(-elapsed))
+}
+
+// Position returns the index of the event playing at now and how long ago
+// it started. Before the first event and after the last, elapsed is 0.
+func (p *Player) Position(now time.Time) (i int, elapsed time.Duration) {
+	if p.cur < 0 || p.cur >= len(p.song.Events) || !now.Before(p.at) {
+		return p.next, 0
+	}
+	return p.cur, now.Sub(p.started)
+}
+
+// Stop stops playback and silences the speaker.
+func (p *Player) Stop() {
+	if p.sounding {
+		p.speaker.Stop()
+		p.sounding = false
+	}
+	p.playing = false
+}
+
+// Playing reports whether a song is being played.
+func (p *Player) Playing() bool {
+	return p.playing
+}
+
+// Next returns the index of the next event. While handling an event it is
+// one after the index of that event.
+func (p *Player) Next() int {
+	return p.next
+}
+
+// Update starts and stops the notes that are due and passes every event that
+// starts, including lyric markers, to handle, which may be nil.
+func (p *Player) Update(now time.Time, handle func(e Event)) {
+	if !p.playing {
+		return
+	}
+	// a slurred note keeps sounding into the next one
+	if p.sounding && !now.Before(p.off) && p.off.Before(p.at) {
+		p.speaker.Stop()
+		p.sounding = false
+	}
+	for p.playing && !now.Before(p.at) {
+		if p.next >= len(p.song.Events) {
+			p.Stop()
+			return
+		}
+		e := p.song.Events[p.next]
+		p.cur = p.next
+		p.started = p.at
+		p.next++
+		switch {
+		case e.Rest:
+			if p.sounding {
+				p.speaker.Stop()
+				p.sounding = false
+			}
+		case e.IsNote():
+			if vs, ok := p.speaker.(VolumeSpeaker); ok {
+				vs.SetVolume(e.Volume)
+			}
+			p.speaker.SetNote(e.Note)
+			p.sounding = true
+			p.off = p.at.Add(e.Gate)
+		}
+		if handle != nil {
+			handle(e)
+		}
+		p.at = p.at.Add(e.Length)
+	}
+}
@@ -0,0 +1,128 @@
+// Command pcmgen synthesizes the drum samples embedded in package pcm.
+//
+//	pcmgen [-o DIR]
+//
+// Each sample is written as raw signed 8-bit PCM at pcm.SampleRate. The
+// noise comes from a fixed seed, so the output is the same on every run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// rate is pcm.SampleRate. Package pcm needs the RP2040, so it is not
+// imported here.
+const rate = 15625
+
+// noise is a linear congruential generator returning -1 to 1.
+type noise uint32
+
+func (n *noise) next() float64 {
+	*n = *n*1664525 + 1013904223
+	return float64(int32(*n)) / (1 << 31)
+}
+
+// kick is a sine wave falling from 150 Hz to 45 Hz with a click at the start.
+func kick() []float64 {
+	out := make([]float64, rate*250/1000)
+	phase := 0.0
+	for i := range out {
+		t := float64(i) / rate
+		f := 45 + 105*math.Exp(-t/0.03)
+		phase += 2 * math.Pi * f / rate
+		out[i] = math.Sin(phase) * math.Exp(-t/0.09)
+		if t < 0.002 {
+			out[i] += 0.5 * (1 - t/0.002)
+		}
+	}
+	return out
+}
+
+// snare is a short 185 Hz tone with a longer burst of noise.
+func snare() []float64 {
+	n := noise(1)
+	out := make([]float64, rate*180/1000)
+	for i := range out {
+		t := float64(i) / rate
+		body := math.Sin(2*math.Pi*185*t) * math.Exp(-t/0.04)
+		out[i] = 0.5*body + 0.8*n.next()*math.Exp(-t/0.05)
+	}
+	return out
+}
+
+// hat is high-passed noise that dies away quickly.
+func hat() []float64 {
+	n := noise(2)
+	out := make([]float64, rate*60/1000)
+	prev := 0.0
+	for i := range out {
+		t := float64(i) / rate
+		x := n.next()
+		out[i] = (x - prev) * 0.6 * math.Exp(-t/0.015)
+		prev = x
+	}
+	return out
+}
+
+// clap is three quick bursts of noise followed by a tail.
+func clap() []float64 {
+	n := noise(3)
+	out := make([]float64, rate*200/1000)
+	prev := 0.0
+	for i := range out {
+		t := float64(i) / rate
+		env := 0.0
+		for _, start := range []float64{0, 0.011, 0.022} {
+			if t >= start && t < start+0.01 {
+				env = math.Max(env, math.Exp(-(t-start)/0.003))
+			}
+		}
+		if t >= 0.022 {
+			env = math.Max(env, 0.7*math.Exp(-(t-0.022)/0.05))
+		}
+		x := n.next()
+		// a rough band-pass keeps the clap out of the lows
+		out[i] = (x - 0.5*prev) * env
+		prev = x
+	}
+	return out
+}
+
+// pcm8 converts a sound to signed 8-bit PCM with its peak at 120.
+func pcm8(sound []float64) []byte {
+	peak := 0.0
+	for _, v := range sound {
+		peak = math.Max(peak, math.Abs(v))
+	}
+	out := make([]byte, len(sound))
+	for i, v := range sound {
+		out[i] = byte(int8(math.Round(v / peak * 120)))
+	}
+	return out
+}
+
+func main() {
+	dir := flag.String("o", ".", "output directory")
+	flag.Parse()
+
+	samples := []struct {
+		name  string
+		sound []float64
+	}{
+		{"kick", kick()},
+		{"snare", snare()},
+		{"hat", hat()},
+		{"clap", clap()},
+	}
+	for _, s := range samples {
+		file := filepath.Join(*dir, s.name+".pcm")
+		if err := os.WriteFile(file, pcm8(s.sound), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, "pcmgen:", err)
+			os.Exit(1)
+		}
+	}
+}
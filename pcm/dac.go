@@ -0,0 +1,103 @@
+package pcm
+
+import (
+	"device/rp"
+	"errors"
+	"machine"
+	"runtime/interrupt"
+
+	"tinygo.org/x/drivers/tone"
+)
+
+// DefaultRate is the PWM frequency and output rate of NewDAC. It is above
+// the range of hearing and twice SampleRate, so the embedded samples need no
+// interpolation.
+const DefaultRate = 2 * SampleRate
+
+// DAC plays a Mixer on a PWM pin. The PWM runs at the output rate of the
+// mixer and every wrap of its counter raises an interrupt that sets the duty
+// cycle to the next sample.
+//
+// All PWM slices of the RP2040 share one wrap interrupt, so there can be
+// only one DAC.
+type DAC struct {
+	mixer *Mixer
+	pwm   tone.PWM
+	ch    uint8
+	mask  uint32 // interrupt bit of the slice
+	scale uint32 // duty of a full scale sample, TOP + 1
+}
+
+// the DAC served by the interrupt handler
+var active *DAC
+
+var errInUse = errors.New("pcm: DAC already in use")
+
+// NewDAC configures pwm for pin at DefaultRate and starts playing a new
+// Mixer. pwm must be the slice of pin, such as machine.PWM5 for GPIO26
+// (EX03); it must not be shared with a tone.Speaker, which changes the
+// period.
+func NewDAC(pwm tone.PWM, pin machine.Pin) (*DAC, error) {
+	if active != nil {
+		return nil, errInUse
+	}
+	err := pwm.Configure(machine.PWMConfig{
+		Period: uint64(1e9) / DefaultRate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ch, err := pwm.Channel(pin)
+	if err != nil {
+		return nil, err
+	}
+	d := &DAC{
+		mixer: NewMixer(DefaultRate),
+		pwm:   pwm,
+		ch:    ch,
+		// GPIO 2n and 2n+1 are the A and B channels of slice n mod 8
+		mask:  1 << (uint32(pin) / 2 % 8),
+		scale: pwm.Top() + 1,
+	}
+	d.pwm.Set(d.ch, d.duty(128))
+
+	active = d
+	rp.PWM.INTR.Set(d.mask)
+	rp.PWM.INTE.SetBits(d.mask)
+	intr := interrupt.New(rp.IRQ_PWM_IRQ_WRAP, handleWrap)
+	intr.Enable()
+	return d, nil
+}
+
+// handleWrap sets the duty cycle for the next sample.
+func handleWrap(interrupt.Interrupt) {
+	d := active
+	rp.PWM.INTR.Set(d.mask)
+	d.pwm.Set(d.ch, d.duty(d.mixer.Next()))
+}
+
+func (d *DAC) duty(sample uint8) uint32 {
+	return uint32(sample) * d.scale >> 8
+}
+
+// Play starts s at volume (0 to MaxVolume). See Mixer.Play.
+func (d *DAC) Play(s *Sample, volume uint8) {
+	mask := interrupt.Disable()
+	d.mixer.Play(s, volume)
+	interrupt.Restore(mask)
+}
+
+// Stop stops every sample.
+func (d *DAC) Stop() {
+	mask := interrupt.Disable()
+	d.mixer.Stop()
+	interrupt.Restore(mask)
+}
+
+// Active returns the number of samples playing.
+func (d *DAC) Active() int {
+	mask := interrupt.Disable()
+	n := d.mixer.Active()
+	interrupt.Restore(mask)
+	return n
+}
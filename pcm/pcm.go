@@ -0,0 +1,143 @@
+// Package pcm plays short 8-bit PCM samples, such as drum sounds, through a
+// PWM pin used as a DAC.
+//
+// A Mixer adds up to MaxVoices samples that play at once. DAC feeds the
+// mixed signal to the duty cycle of a PWM slice from its wrap interrupt, so
+// samples keep playing while the main loop is busy. A small speaker or a
+// piezo buzzer on the pin follows the average of the pulses; the PWM
+// frequency itself is too high to hear.
+//
+// Kick, Snare, Hat and Clap are embedded drum samples.
+package pcm
+
+import "time"
+
+// MaxVoices is the largest number of samples that play at once.
+const MaxVoices = 4
+
+// MaxVolume is the volume at which a sample plays as recorded.
+const MaxVolume = 255
+
+// Sample is a sound in signed 8-bit PCM.
+type Sample struct {
+	Name string
+	Data []byte // one signed byte per sample
+	Rate int    // samples per second
+}
+
+// Duration returns how long s plays.
+func (s *Sample) Duration() time.Duration {
+	if s.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(len(s.Data)) * time.Second / time.Duration(s.Rate)
+}
+
+type voice struct {
+	sample *Sample
+	pos    uint32 // position in the data, 16.16 fixed point
+	step   uint32 // increment of pos per output sample
+	end    uint32 // length of the data, 16.16 fixed point
+	volume int32
+}
+
+// Mixer mixes samples at a fixed output rate. Samples recorded at another
+// rate are resampled, so a sample played with a higher Rate also sounds
+// higher.
+//
+// A Mixer is not safe for concurrent use; DAC calls Next from an interrupt
+// and wraps Play and Stop so that they do not run at the same time.
+type Mixer struct {
+	rate   int
+	voices [MaxVoices]voice
+}
+
+// NewMixer returns a Mixer that outputs rate samples per second.
+func NewMixer(rate int) *Mixer {
+	return &Mixer{rate: rate}
+}
+
+// Rate returns the output rate in samples per second.
+func (m *Mixer) Rate() int {
+	return m.rate
+}
+
+// Play starts s at volume (0 to MaxVolume). A sample that is already
+// playing is restarted, as a drum hit again cuts off its own sound. If all
+// the voices are in use the one closest to its end is taken over.
+func (m *Mixer) Play(s *Sample, volume uint8) {
+	if s == nil || len(s.Data) == 0 || s.Rate <= 0 || m.rate <= 0 {
+		return
+	}
+	step := uint32(uint64(s.Rate) << 16 / uint64(m.rate))
+	if step == 0 {
+		step = 1
+	}
+	i := m.voiceFor(s)
+	m.voices[i] = voice{
+		sample: s,
+		step:   step,
+		end:    uint32(len(s.Data)) << 16,
+		volume: int32(volume),
+	}
+}
+
+// voiceFor returns the voice to play s on.
+func (m *Mixer) voiceFor(s *Sample) int {
+	best := 0
+	bestLeft := ^uint32(0)
+	for i, v := range m.voices {
+		if v.sample == s {
+			return i
+		}
+		left := uint32(0)
+		if v.sample != nil {
+			left = (v.end - v.pos) / v.step
+		}
+		if left < bestLeft {
+			best, bestLeft = i, left
+		}
+	}
+	return best
+}
+
+// Stop stops every sample.
+func (m *Mixer) Stop() {
+	for i := range m.voices {
+		m.voices[i] = voice{}
+	}
+}
+
+// Active returns the number of samples playing.
+func (m *Mixer) Active() int {
+	n := 0
+	for _, v := range m.voices {
+		if v.sample != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Next returns the next output sample as unsigned 8-bit PCM, 128 being
+// silence. The sum of the voices is clipped.
+func (m *Mixer) Next() uint8 {
+	var sum int32
+	for i := range m.voices {
+		v := &m.voices[i]
+		if v.sample == nil {
+			continue
+		}
+		sum += int32(int8(v.sample.Data[v.pos>>16])) * v.volume >> 8
+		v.pos += v.step
+		if v.pos >= v.end {
+			*v = voice{}
+		}
+	}
+	if sum > 127 {
+		sum = 127
+	} else if sum < -128 {
+		sum = -128
+	}
+	return uint8(sum + 128)
+}
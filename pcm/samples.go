@@ -0,0 +1,28 @@
+package pcm
+
+import _ "embed"
+
+// SampleRate is the rate of the embedded samples.
+const SampleRate = 15625
+
+// The embedded samples are synthesized by pcmgen.
+//
+//go:generate go run ./cmd/pcmgen -o samples
+var (
+	//go:embed samples/kick.pcm
+	kickData []byte
+	//go:embed samples/snare.pcm
+	snareData []byte
+	//go:embed samples/hat.pcm
+	hatData []byte
+	//go:embed samples/clap.pcm
+	clapData []byte
+)
+
+// Drum samples.
+var (
+	Kick  = &Sample{Name: "Kick", Data: kickData, Rate: SampleRate}
+	Snare = &Sample{Name: "Snare", Data: snareData, Rate: SampleRate}
+	Hat   = &Sample{Name: "Hat", Data: hatData, Rate: SampleRate}
+	Clap  = &Sample{Name: "Clap", Data: clapData, Rate: SampleRate}
+)
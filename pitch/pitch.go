@@ -0,0 +1,315 @@
+// Package pitch converts between MIDI note numbers, frequencies and note
+// names.
+//
+// A Note is a MIDI note number, the numbering that tone.Note and midi.Note
+// also use, so converting between them is a plain conversion:
+//
+//	speaker.SetNote(tone.Note(n))
+//	n := pitch.Note(midi.C4)
+//
+// Note 60 is C4 (middle C) and note 69 is A4, 440 Hz in the Standard tuning.
+// Names can be written with English letters (C#4), solfège (Do#4) or
+// katakana (ド#4), with sharps or flats.
+package pitch
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Note is a MIDI note number from 0 to 127.
+type Note uint8
+
+// Octave returns the octave of n. C4 (60) is in octave 4 and note 0 in
+// octave -1.
+func (n Note) Octave() int {
+	return int(n)/12 - 1
+}
+
+// Class returns the pitch class of n, 0 for C to 11 for B.
+func (n Note) Class() int {
+	return int(n) % 12
+}
+
+// Name returns the English name of n with sharps, such as "C#4".
+func (n Note) Name() string {
+	return n.NameIn(English, Sharps)
+}
+
+// Katakana returns the katakana name of n with sharps, such as "ド#4".
+func (n Note) Katakana() string {
+	return n.NameIn(Katakana, Sharps)
+}
+
+// NameIn returns the name of n with the octave in the given naming and
+// accidentals.
+func (n Note) NameIn(naming Naming, acc Accidental) string {
+	return ClassName(n.Class(), naming, acc) + strconv.Itoa(n.Octave())
+}
+
+func (n Note) String() string {
+	return n.Name()
+}
+
+// Frequency returns the frequency of n in Hz in the Standard tuning.
+func (n Note) Frequency() float64 {
+	return Standard.Frequency(n)
+}
+
+// Naming is a set of names for the seven natural notes.
+type Naming int
+
+const (
+	English  Naming = iota // C D E F G A B
+	Solfege                // Do Re Mi Fa Sol La Si
+	Katakana               // ド レ ミ ファ ソ ラ シ
+)
+
+// Accidental chooses how the black keys are written.
+type Accidental int
+
+const (
+	Sharps Accidental = iota // C#, D#, F#, G#, A#
+	Flats                    // Db, Eb, Gb, Ab, Bb
+)
+
+// names of the natural notes C to B
+var naturalNames = [...][7]string{
+	English:  {"C", "D", "E", "F", "G", "A", "B"},
+	Solfege:  {"Do", "Re", "Mi", "Fa", "Sol", "La", "Si"},
+	Katakana: {"ド", "レ", "ミ", "ファ", "ソ", "ラ", "シ"},
+}
+
+// natural notes of the pitch classes; a black key is the note below it
+// with a sharp
+var classNatural = [12]int{0, 0, 1, 1, 2, 3, 3, 4, 4, 5, 5, 6}
+
+// semitones of the natural notes from C
+var naturalClass = [7]int{0, 2, 4, 5, 7, 9, 11}
+
+// ClassName returns the name of pitch class c (0 for C to 11 for B) without
+// an octave.
+func ClassName(c int, naming Naming, acc Accidental) string {
+	c = ((c % 12) + 12) % 12
+	if naming < 0 || int(naming) >= len(naturalNames) {
+		naming = English
+	}
+	names := &naturalNames[naming]
+	i := classNatural[c]
+	if naturalClass[i] == c {
+		return names[i]
+	}
+	if acc == Flats {
+		return names[i+1] + "b"
+	}
+	return names[i] + "#"
+}
+
+// Parse parses a note name such as "C4", "F#3", "Bb5", "Sol4" or "ド#4". The
+// name may use any of the namings and "#", "♯", "b" or "♭" for the
+// accidentals. The octave is required; it is -1 to 9.
+func Parse(s string) (Note, error) {
+	rest, class, ok := parseNatural(strings.TrimSpace(s))
+	if !ok {
+		return 0, errors.New("pitch: bad note name " + strconv.Quote(s))
+	}
+	for {
+		switch {
+		case strings.HasPrefix(rest, "#"):
+			class++
+			rest = rest[1:]
+			continue
+		case strings.HasPrefix(rest, "♯"):
+			class++
+			rest = rest[len("♯"):]
+			continue
+		case strings.HasPrefix(rest, "b"):
+			class--
+			rest = rest[1:]
+			continue
+		case strings.HasPrefix(rest, "♭"):
+			class--
+			rest = rest[len("♭"):]
+			continue
+		}
+		break
+	}
+	octave, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0, errors.New("pitch: bad octave in " + strconv.Quote(s))
+	}
+	n := (octave+1)*12 + class
+	if n < 0 || n > 127 {
+		return 0, errors.New("pitch: note out of range " + strconv.Quote(s))
+	}
+	return Note(n), nil
+}
+
+// parseNatural reads the name of a natural note at the start of s. Solfège
+// names are tried first so that "Do" is not read as D.
+func parseNatural(s string) (rest string, class int, ok bool) {
+	for _, naming := range []Naming{Solfege, Katakana} {
+		for i, name := range naturalNames[naming] {
+			if len(s) >= len(name) && strings.EqualFold(s[:len(name)], name) {
+				return s[len(name):], naturalClass[i], true
+			}
+		}
+	}
+	// "So" and "Ti" are also common
+	if len(s) >= 2 {
+		switch strings.ToLower(s[:2]) {
+		case "so":
+			return s[2:], 7, true
+		case "ti":
+			return s[2:], 11, true
+		}
+	}
+	if s == "" {
+		return "", 0, false
+	}
+	for i, name := range naturalNames[English] {
+		if strings.EqualFold(s[:1], name) {
+			return s[1:], naturalClass[i], true
+		}
+	}
+	return "", 0, false
+}
+
+// System is a tuning system.
+type System int
+
+const (
+	Equal       System = iota // 12-tone equal temperament
+	Just                      // 5-limit just intonation
+	Pythagorean               // pure fifths from Eb to G#
+	Meantone                  // quarter-comma meantone, fifths from Eb to G#
+)
+
+var systemNames = []string{"Equal", "Just", "Pythag", "Meantone"}
+
+func (s System) String() string {
+	if s < 0 || int(s) >= len(systemNames) {
+		return "?"
+	}
+	return systemNames[s]
+}
+
+// Tuning maps notes to frequencies.
+//
+// The systems other than Equal are tuned from Root: its note in octave 4
+// keeps its equal tempered frequency and the other notes are pure intervals
+// from it, so A4 is not exactly at the A4 frequency unless Root is 9 (A).
+type Tuning struct {
+	A4     float64 // frequency of A4 in Hz; 0 means 440
+	System System
+	Root   int // pitch class the system is tuned from, 0 (C) to 11 (B)
+}
+
+// Standard is equal temperament with A4 at 440 Hz.
+var Standard = Tuning{A4: 440}
+
+// ratios of the just intervals from the root
+var justRatios = [12]float64{
+	1, 16.0 / 15, 9.0 / 8, 6.0 / 5, 5.0 / 4, 4.0 / 3,
+	45.0 / 32, 3.0 / 2, 8.0 / 5, 5.0 / 3, 9.0 / 5, 15.0 / 8,
+}
+
+// number of fifths from the root to each interval, on the chain from Eb (-3)
+// to G# (8)
+var fifths = [12]int{0, 7, 2, -3, 4, -1, 6, 1, 8, 3, -2, 5}
+
+func (t Tuning) a4() float64 {
+	if t.A4 <= 0 {
+		return 440
+	}
+	return t.A4
+}
+
+// equal returns the equal tempered frequency of note n, which may be out of
+// the MIDI range.
+func (t Tuning) equal(n int) float64 {
+	return t.a4() * math.Pow(2, float64(n-69)/12)
+}
+
+// ratio returns the ratio of interval i (0 to 11 semitones) from the root.
+func (t Tuning) ratio(i int) float64 {
+	var fifth float64
+	switch t.System {
+	case Just:
+		return justRatios[i]
+	case Pythagorean:
+		fifth = 1.5
+	case Meantone:
+		fifth = math.Pow(5, 0.25)
+	default:
+		return math.Pow(2, float64(i)/12)
+	}
+	r := math.Pow(fifth, float64(fifths[i]))
+	// bring the interval into one octave
+	return r / math.Pow(2, math.Floor(math.Log2(r)))
+}
+
+// Frequency returns the frequency of n in Hz.
+func (t Tuning) Frequency(n Note) float64 {
+	if t.System == Equal {
+		return t.equal(int(n))
+	}
+	root := 60 + ((t.Root%12)+12)%12
+	d := int(n) - root
+	octave := d / 12
+	i := d % 12
+	if i < 0 {
+		i += 12
+		octave--
+	}
+	return t.equal(root) * t.ratio(i) * math.Pow(2, float64(octave))
+}
+
+// Period returns the period of n in nanoseconds, as tone.Note.Period does,
+// so that a speaker can play any tuning with SetPeriod.
+func (t Tuning) Period(n Note) uint64 {
+	return uint64(1e9/t.Frequency(n) + 0.5)
+}
+
+// Nearest returns the note closest to frequency f in Hz and how far f is
+// from it in cents (hundredths of a semitone); f is above the note if cents
+// is positive. Frequencies out of the MIDI range return note 0 or 127.
+func (t Tuning) Nearest(f float64) (n Note, cents float64) {
+	if f <= 0 {
+		return 0, 0
+	}
+	guess := int(math.Floor(69 + 12*math.Log2(f/t.a4()) + 0.5))
+	best := math.Inf(1)
+	for m := guess - 1; m <= guess+1; m++ {
+		if m < 0 || m > 127 {
+			continue
+		}
+		c := Cents(t.Frequency(Note(m)), f)
+		if math.Abs(c) < math.Abs(best) {
+			n, best = Note(m), c
+		}
+	}
+	if math.IsInf(best, 1) {
+		// far out of range
+		if guess < 0 {
+			n = 0
+		} else {
+			n = 127
+		}
+		best = Cents(t.Frequency(n), f)
+	}
+	return n, best
+}
+
+// FromFrequency returns the note closest to frequency f in Hz in the
+// Standard tuning and how far f is from it in cents.
+func FromFrequency(f float64) (Note, float64) {
+	return Standard.Nearest(f)
+}
+
+// Cents returns the interval from frequency a up to frequency b in cents.
+func Cents(a, b float64) float64 {
+	return 1200 * math.Log2(b/a)
+}
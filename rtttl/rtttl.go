@@ -0,0 +1,200 @@
+// Package rtttl parses RTTTL (Ring Tone Text Transfer Language) ringtones,
+// the format of Nokia phones that most piezo melodies are shared in.
+//
+// A ringtone has a name, defaults and comma separated notes:
+//
+//	Nokia:d=4,o=5,b=225:8e6,8d6,f#,g#,8c#6,8b,d,e,8b,8a,c#,e,2a
+//
+// The defaults are the note value (d), the octave (o) and the tempo in
+// quarter notes per minute (b); missing ones are d=4, o=6 and b=63. A note
+// is [value]pitch[#][.][octave][.] where pitch is a to g (h is b) or p for a
+// pause. Octave 4 holds A 440 Hz.
+//
+// The notes are converted to an mml.Song so that they can be played with
+// mml.Player.
+package rtttl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/mml"
+)
+
+// Defaults used when a ringtone does not set them.
+const (
+	DefaultDuration = 4
+	DefaultOctave   = 6
+	DefaultBPM      = 63
+)
+
+// Tune is a parsed ringtone.
+type Tune struct {
+	Name string
+	Song *mml.Song
+}
+
+var pitches = map[byte]int{'c': 0, 'd': 2, 'e': 4, 'f': 5, 'g': 7, 'a': 9, 'b': 11, 'h': 11}
+
+// Parse parses a ringtone.
+func Parse(src string) (*Tune, error) {
+	parts := strings.Split(strings.TrimSpace(src), ":")
+	if len(parts) != 3 {
+		return nil, errors.New("want name:defaults:notes")
+	}
+	t := &Tune{Name: strings.TrimSpace(parts[0]), Song: &mml.Song{}}
+
+	duration, octave, bpm := DefaultDuration, DefaultOctave, DefaultBPM
+	for _, f := range strings.Split(parts[1], ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New(t.Name + ": bad default " + strconv.Quote(f))
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, errors.New(t.Name + ": bad default " + strconv.Quote(f))
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "d":
+			if !validDuration(v) {
+				return nil, errors.New(t.Name + ": bad default duration " + strconv.Itoa(v))
+			}
+			duration = v
+		case "o":
+			if v < 0 || v > 9 {
+				return nil, errors.New(t.Name + ": bad default octave " + strconv.Itoa(v))
+			}
+			octave = v
+		case "b":
+			if v < 1 || v > 900 {
+				return nil, errors.New(t.Name + ": bad tempo " + strconv.Itoa(v))
+			}
+			bpm = v
+		default:
+			return nil, errors.New(t.Name + ": unknown default " + strconv.Quote(f))
+		}
+	}
+
+	for i, f := range strings.Split(parts[2], ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		e, err := parseNote(f, duration, octave, bpm)
+		if err != nil {
+			return nil, errors.New(t.Name + ": note " + strconv.Itoa(i+1) + " " + strconv.Quote(f) + ": " + err.Error())
+		}
+		t.Song.Events = append(t.Song.Events, e)
+		t.Song.Duration += e.Length
+	}
+	if len(t.Song.Events) == 0 {
+		return nil, errors.New(t.Name + ": no notes")
+	}
+	return t, nil
+}
+
+// parseNote parses one note with the defaults of the ringtone.
+func parseNote(f string, duration, octave, bpm int) (mml.Event, error) {
+	i := 0
+	number := func() (int, bool) {
+		start := i
+		for i < len(f) && '0' <= f[i] && f[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return 0, false
+		}
+		n, err := strconv.Atoi(f[start:i])
+		return n, err == nil
+	}
+
+	if n, ok := number(); ok {
+		if !validDuration(n) {
+			return mml.Event{}, errors.New("bad duration")
+		}
+		duration = n
+	}
+	if i == len(f) {
+		return mml.Event{}, errors.New("missing pitch")
+	}
+	c := f[i]
+	i++
+	pitch, isNote := pitches[c]
+	if !isNote && c != 'p' {
+		return mml.Event{}, errors.New("bad pitch")
+	}
+	if i < len(f) && f[i] == '#' {
+		pitch++
+		i++
+	}
+	dotted := false
+	if i < len(f) && f[i] == '.' {
+		dotted = true
+		i++
+	}
+	if n, ok := number(); ok {
+		if n > 9 {
+			return mml.Event{}, errors.New("bad octave")
+		}
+		octave = n
+	}
+	if i < len(f) && f[i] == '.' {
+		dotted = true
+		i++
+	}
+	if i != len(f) {
+		return mml.Event{}, errors.New("unexpected " + strconv.Quote(f[i:]))
+	}
+
+	length := 4 * time.Minute / time.Duration(bpm*duration)
+	if dotted {
+		length += length / 2
+	}
+	if !isNote {
+		return mml.Event{Rest: true, Length: length}, nil
+	}
+	note := (octave+1)*12 + pitch
+	if note > 127 {
+		return mml.Event{}, errors.New("note out of range")
+	}
+	gate := length
+	if length > 2*mml.ReleaseGap {
+		gate -= mml.ReleaseGap
+	}
+	return mml.Event{Note: uint8(note), Length: length, Gate: gate, Volume: mml.DefaultVolume}, nil
+}
+
+func validDuration(d int) bool {
+	switch d {
+	case 1, 2, 4, 8, 16, 32, 64:
+		return true
+	}
+	return false
+}
+
+// ParseAll parses a collection of ringtones, one per line. Empty lines and
+// lines starting with # are skipped.
+func ParseAll(src string) ([]*Tune, error) {
+	var tunes []*Tune
+	for n, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		t, err := Parse(line)
+		if err != nil {
+			return nil, errors.New("line " + strconv.Itoa(n+1) + ": " + err.Error())
+		}
+		tunes = append(tunes, t)
+	}
+	if len(tunes) == 0 {
+		return nil, errors.New("no ringtones")
+	}
+	return tunes, nil
+}
@@ -0,0 +1,181 @@
+// Package scale maps keys to the notes of a musical scale and builds
+// diatonic chords on each degree.
+package scale
+
+// Scale is a set of intervals in semitones from the root, in ascending
+// order and starting with 0.
+type Scale struct {
+	Name      string // short enough for the OLED
+	Intervals []uint8
+}
+
+var (
+	Major           = Scale{"Major", []uint8{0, 2, 4, 5, 7, 9, 11}}
+	Minor           = Scale{"Minor", []uint8{0, 2, 3, 5, 7, 8, 10}}
+	HarmonicMinor   = Scale{"HarmMin", []uint8{0, 2, 3, 5, 7, 8, 11}}
+	MajorPentatonic = Scale{"MajPent", []uint8{0, 2, 4, 7, 9}}
+	MinorPentatonic = Scale{"MinPent", []uint8{0, 3, 5, 7, 10}}
+	Blues           = Scale{"Blues", []uint8{0, 3, 5, 6, 7, 10}}
+	Dorian          = Scale{"Dorian", []uint8{0, 2, 3, 5, 7, 9, 10}}
+	Phrygian        = Scale{"Phryg", []uint8{0, 1, 3, 5, 7, 8, 10}}
+	Lydian          = Scale{"Lydian", []uint8{0, 2, 4, 6, 7, 9, 11}}
+	Mixolydian      = Scale{"Mixo", []uint8{0, 2, 4, 5, 7, 9, 10}}
+	Chromatic       = Scale{"Chroma", []uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}}
+)
+
+// Scales lists the predefined scales.
+var Scales = []Scale{
+	Major,
+	Minor,
+	HarmonicMinor,
+	MajorPentatonic,
+	MinorPentatonic,
+	Blues,
+	Dorian,
+	Phrygian,
+	Lydian,
+	Mixolydian,
+	Chromatic,
+}
+
+// RootNames are the names of the 12 pitch classes.
+var RootNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// Note returns the MIDI note of degree counted from root. Degrees beyond the
+// scale continue in the next octaves; negative degrees go down. The result
+// is clamped to 0-127.
+func (s Scale) Note(root int, degree int) uint8 {
+	n := len(s.Intervals)
+	octave := degree / n
+	i := degree % n
+	if i < 0 {
+		i += n
+		octave--
+	}
+	v := root + 12*octave + int(s.Intervals[i])
+	if v < 0 {
+		return 0
+	}
+	if v > 127 {
+		return 127
+	}
+	return uint8(v)
+}
+
+// Contains reports whether note is in the scale built on the pitch class
+// root.
+func (s Scale) Contains(root int, note uint8) bool {
+	pc := ((int(note)-root)%12 + 12) % 12
+	for _, iv := range s.Intervals {
+		if int(iv) == pc {
+			return true
+		}
+	}
+	return false
+}
+
+// Chord returns the notes stacked in thirds on degree: size 3 is a triad
+// and 4 a seventh chord. Thirds are taken as every other scale degree, so
+// pentatonic and blues scales give their own colour of chords.
+func (s Scale) Chord(root int, degree int, size int) []uint8 {
+	notes := make([]uint8, size)
+	for i := range notes {
+		notes[i] = s.Note(root, degree+2*i)
+	}
+	return notes
+}
+
+// Layout places the notes of a scale on a number of keys.
+type Layout struct {
+	Root   int // pitch class 0-11, 0 is C
+	Octave int // octave of the lowest key, 4 is the octave of middle C (60)
+	Scale  Scale
+}
+
+// Base returns the MIDI note of the lowest key.
+func (l Layout) Base() int {
+	return 12*(l.Octave+1) + l.Root
+}
+
+// Notes returns the notes for n keys, one scale degree per key from the
+// lowest.
+func (l Layout) Notes(n int) []uint8 {
+	notes := make([]uint8, n)
+	for i := range notes {
+		notes[i] = l.Scale.Note(l.Base(), i)
+	}
+	return notes
+}
+
+// Chord returns the triad (size 3) or seventh chord (size 4) on degree.
+func (l Layout) Chord(degree, size int) []uint8 {
+	return l.Scale.Chord(l.Base(), degree, size)
+}
+
+// Transpose moves the root by semitones, carrying into the octave.
+func (l Layout) Transpose(semitones int) Layout {
+	base := l.Base() + semitones
+	if base < 0 {
+		base = 0
+	} else if base > 119 {
+		base = 119
+	}
+	l.Root = base % 12
+	l.Octave = base/12 - 1
+	return l
+}
+
+// Name returns the key and scale, such as "C# Dorian".
+func (l Layout) Name() string {
+	return RootNames[l.Root] + " " + l.Scale.Name
+}
+
+// ChordName names a chord built by Chord, such as "Am" or "G7". Chords
+// that are not a common triad or seventh are named after their root.
+func ChordName(notes []uint8) string {
+	if len(notes) == 0 {
+		return ""
+	}
+	root := RootNames[notes[0]%12]
+	iv := make([]int, len(notes)-1)
+	for i := range iv {
+		iv[i] = int(notes[i+1]) - int(notes[0])
+	}
+	switch {
+	case equal(iv, 4, 7):
+		return root
+	case equal(iv, 3, 7):
+		return root + "m"
+	case equal(iv, 3, 6):
+		return root + "dim"
+	case equal(iv, 4, 8):
+		return root + "aug"
+	case equal(iv, 4, 7, 11):
+		return root + "M7"
+	case equal(iv, 4, 7, 10):
+		return root + "7"
+	case equal(iv, 3, 7, 10):
+		return root + "m7"
+	case equal(iv, 3, 7, 11):
+		return root + "mM7"
+	case equal(iv, 3, 6, 10):
+		return root + "m7-5"
+	case equal(iv, 3, 6, 9):
+		return root + "dim7"
+	case equal(iv, 4, 8, 11):
+		return root + "augM7"
+	}
+	return root
+}
+
+func equal(a []int, b ...int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package sched
+
+import "time"
+
+type pending struct {
+	at   time.Time
+	note uint8
+}
+
+// queue is a binary min-heap of note-offs ordered by time. It avoids
+// container/heap so that pushing does not box values into interfaces.
+type queue struct {
+	items []pending
+}
+
+func (q *queue) len() int {
+	return len(q.items)
+}
+
+func (q *queue) peek() pending {
+	return q.items[0]
+}
+
+func (q *queue) push(p pending) {
+	q.items = append(q.items, p)
+	q.up(len(q.items) - 1)
+}
+
+func (q *queue) pop() pending {
+	p := q.items[0]
+	q.removeAt(0)
+	return p
+}
+
+// remove drops the pending note-off of note and reports whether there was
+// one.
+func (q *queue) remove(note uint8) bool {
+	for i, p := range q.items {
+		if p.note == note {
+			q.removeAt(i)
+			return true
+		}
+	}
+	return false
+}
+
+func (q *queue) removeAt(i int) {
+	last := len(q.items) - 1
+	q.items[i] = q.items[last]
+	q.items = q.items[:last]
+	if i < last {
+		q.down(i)
+		q.up(i)
+	}
+}
+
+func (q *queue) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !q.items[i].at.Before(q.items[parent].at) {
+			return
+		}
+		q.items[i], q.items[parent] = q.items[parent], q.items[i]
+		i = parent
+	}
+}
+
+func (q *queue) down(i int) {
+	n := len(q.items)
+	for {
+		min := i
+		if l := 2*i + 1; l < n && q.items[l].at.Before(q.items[min].at) {
+			min = l
+		}
+		if r := 2*i + 2; r < n && q.items[r].at.Before(q.items[min].at) {
+			min = r
+		}
+		if min == i {
+			return
+		}
+		q.items[i], q.items[min] = q.items[min], q.items[i]
+		i = min
+	}
+}
@@ -0,0 +1,179 @@
+// Package sched sends MIDI notes at planned times and stops them after their
+// gate time.
+//
+// Callers plan notes against absolute times, usually the time of a clock
+// tick from midiclock.Master, so that a late main loop does not accumulate
+// drift. Pending note-offs are kept in a priority queue per channel. The
+// scheduler measures how late each event was sent, which is its latency,
+// and how much that lateness varies, which is its jitter.
+//
+// All time comes from a Clock so that the scheduler can be driven by a
+// FakeClock on the host.
+package sched
+
+import "time"
+
+// Clock is the source of the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock reads time.Now.
+type SystemClock struct{}
+
+// Now returns time.Now().
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a Clock that only moves when told to.
+type FakeClock struct {
+	t time.Time
+}
+
+// NewFakeClock returns a FakeClock set to t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{t: t}
+}
+
+// Now returns the fake time.
+func (c *FakeClock) Now() time.Time {
+	return c.t
+}
+
+// Set sets the fake time.
+func (c *FakeClock) Set(t time.Time) {
+	c.t = t
+}
+
+// Advance moves the fake time forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// Output sends notes. Channels are 1-origin.
+type Output interface {
+	NoteOn(channel, note, velocity uint8)
+	NoteOff(channel, note, velocity uint8)
+}
+
+// Stats describes how late the scheduler sent its events.
+type Stats struct {
+	Events      int           // number of events measured
+	LastLatency time.Duration // lateness of the last event
+	MeanLatency time.Duration
+	MaxLatency  time.Duration
+	// Jitter is the smoothed difference between the latencies of
+	// consecutive events, as in RFC 3550.
+	Jitter time.Duration
+
+	total time.Duration
+}
+
+func (s *Stats) add(latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+	if s.Events > 0 {
+		d := latency - s.LastLatency
+		if d < 0 {
+			d = -d
+		}
+		s.Jitter += (d - s.Jitter) / 16
+	}
+	s.Events++
+	s.total += latency
+	s.MeanLatency = s.total / time.Duration(s.Events)
+	if latency > s.MaxLatency {
+		s.MaxLatency = latency
+	}
+	s.LastLatency = latency
+}
+
+// Scheduler sends planned notes to an Output.
+type Scheduler struct {
+	clock Clock
+	out   Output
+	offs  [16]queue // pending note-offs per channel
+	stats Stats
+}
+
+// New returns a scheduler that reads time from clock and sends to out.
+func New(clock Clock, out Output) *Scheduler {
+	return &Scheduler{clock: clock, out: out}
+}
+
+// Now returns the time of the scheduler's clock.
+func (s *Scheduler) Now() time.Time {
+	return s.clock.Now()
+}
+
+// Play sends a Note On that was due at due and plans its Note Off gate
+// later. If the same note is still sounding on the channel, it is stopped
+// first so that the new note is not cut short by the old note-off.
+func (s *Scheduler) Play(due time.Time, channel, note, velocity uint8, gate time.Duration) {
+	q := &s.offs[(channel-1)&0x0F]
+	if q.remove(note) {
+		s.out.NoteOff(channel, note, 0)
+	}
+	s.stats.add(s.clock.Now().Sub(due))
+	s.out.NoteOn(channel, note, velocity)
+	q.push(pending{at: due.Add(gate), note: note})
+}
+
+// Poll sends the note-offs that are due. Call it from the main loop.
+func (s *Scheduler) Poll() {
+	now := s.clock.Now()
+	for ch := range s.offs {
+		q := &s.offs[ch]
+		for q.len() > 0 && !q.peek().at.After(now) {
+			p := q.pop()
+			s.stats.add(now.Sub(p.at))
+			s.out.NoteOff(uint8(ch+1), p.note, 0)
+		}
+	}
+}
+
+// Next returns the time of the earliest pending note-off.
+func (s *Scheduler) Next() (time.Time, bool) {
+	var (
+		next time.Time
+		ok   bool
+	)
+	for ch := range s.offs {
+		q := &s.offs[ch]
+		if q.len() > 0 && (!ok || q.peek().at.Before(next)) {
+			next, ok = q.peek().at, true
+		}
+	}
+	return next, ok
+}
+
+// Pending returns the number of notes waiting for their note-off.
+func (s *Scheduler) Pending() int {
+	n := 0
+	for ch := range s.offs {
+		n += s.offs[ch].len()
+	}
+	return n
+}
+
+// Flush sends every pending note-off now.
+func (s *Scheduler) Flush() {
+	for ch := range s.offs {
+		q := &s.offs[ch]
+		for q.len() > 0 {
+			s.out.NoteOff(uint8(ch+1), q.pop().note, 0)
+		}
+	}
+}
+
+// Stats returns the latency statistics.
+func (s *Scheduler) Stats() Stats {
+	return s.stats
+}
+
+// ResetStats clears the latency statistics.
+func (s *Scheduler) ResetStats() {
+	s.stats = Stats{}
+}
@@ -0,0 +1,227 @@
+package sched
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recorder is an Output that logs what it is sent.
+type recorder struct {
+	log []string
+}
+
+func (r *recorder) NoteOn(channel, note, velocity uint8) {
+	r.log = append(r.log, fmt.Sprintf("on %d %d %d", channel, note, velocity))
+}
+
+func (r *recorder) NoteOff(channel, note, velocity uint8) {
+	r.log = append(r.log, fmt.Sprintf("off %d %d", channel, note))
+}
+
+func (r *recorder) take() []string {
+	log := r.log
+	r.log = nil
+	return log
+}
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTest() (*FakeClock, *recorder, *Scheduler) {
+	clock := NewFakeClock(start)
+	out := &recorder{}
+	return clock, out, New(clock, out)
+}
+
+func TestNoteOffOrder(t *testing.T) {
+	clock, out, s := newTest()
+
+	// planned out of order; the heap sends them by time
+	gates := []struct {
+		note uint8
+		gate time.Duration
+	}{
+		{60, 400 * time.Millisecond},
+		{62, 100 * time.Millisecond},
+		{64, 300 * time.Millisecond},
+		{65, 200 * time.Millisecond},
+		{67, 50 * time.Millisecond},
+	}
+	for _, g := range gates {
+		s.Play(start, 1, g.note, 100, g.gate)
+	}
+	out.take()
+
+	var offs []string
+	for i := 0; i < 10; i++ {
+		clock.Advance(50 * time.Millisecond)
+		s.Poll()
+		offs = append(offs, out.take()...)
+	}
+	want := []string{"off 1 67", "off 1 62", "off 1 65", "off 1 64", "off 1 60"}
+	if !reflect.DeepEqual(offs, want) {
+		t.Errorf("got %v, want %v", offs, want)
+	}
+}
+
+func TestNoteOffPerChannel(t *testing.T) {
+	clock, out, s := newTest()
+
+	s.Play(start, 1, 60, 100, 200*time.Millisecond)
+	s.Play(start, 10, 36, 100, 100*time.Millisecond)
+	s.Play(start, 16, 60, 100, 100*time.Millisecond)
+	out.take()
+	if s.Pending() != 3 {
+		t.Fatalf("Pending() = %d, want 3", s.Pending())
+	}
+	if next, ok := s.Next(); !ok || !next.Equal(start.Add(100*time.Millisecond)) {
+		t.Errorf("Next() = %v, %v", next, ok)
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	s.Poll()
+	if got, want := out.take(), []string{"off 10 36", "off 16 60"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("at 100ms: got %v, want %v", got, want)
+	}
+	clock.Advance(100 * time.Millisecond)
+	s.Poll()
+	if got, want := out.take(), []string{"off 1 60"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("at 200ms: got %v, want %v", got, want)
+	}
+	if _, ok := s.Next(); ok {
+		t.Errorf("Next() reports a note-off after all were sent")
+	}
+}
+
+func TestRetrigger(t *testing.T) {
+	clock, out, s := newTest()
+
+	s.Play(start, 1, 60, 100, 200*time.Millisecond)
+	clock.Advance(100 * time.Millisecond)
+	s.Play(clock.Now(), 1, 60, 90, 200*time.Millisecond)
+	// the old note is stopped before the new one starts
+	if got, want := out.take(), []string{"on 1 60 100", "off 1 60", "on 1 60 90"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if s.Pending() != 1 {
+		t.Errorf("Pending() = %d, want 1", s.Pending())
+	}
+
+	// the old note-off at 200ms does not cut the new note short
+	clock.Advance(100 * time.Millisecond)
+	s.Poll()
+	if got := out.take(); len(got) != 0 {
+		t.Errorf("at 200ms: got %v", got)
+	}
+	clock.Advance(100 * time.Millisecond)
+	s.Poll()
+	if got, want := out.take(), []string{"off 1 60"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("at 300ms: got %v, want %v", got, want)
+	}
+
+	// the same note on another channel is a different note
+	s.Play(clock.Now(), 1, 60, 100, time.Second)
+	s.Play(clock.Now(), 2, 60, 100, time.Second)
+	if got, want := out.take(), []string{"on 1 60 100", "on 2 60 100"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("two channels: got %v, want %v", got, want)
+	}
+}
+
+func TestPollDue(t *testing.T) {
+	clock, out, s := newTest()
+
+	s.Play(start, 1, 60, 100, 100*time.Millisecond)
+	out.take()
+
+	clock.Advance(100*time.Millisecond - time.Nanosecond)
+	s.Poll()
+	if got := out.take(); len(got) != 0 {
+		t.Errorf("before due: got %v", got)
+	}
+	clock.Advance(time.Nanosecond)
+	s.Poll()
+	if got := out.take(); len(got) != 1 {
+		t.Errorf("at due: got %v", got)
+	}
+	s.Poll()
+	if got := out.take(); len(got) != 0 {
+		t.Errorf("sent twice: %v", got)
+	}
+}
+
+func TestPollLate(t *testing.T) {
+	clock, out, s := newTest()
+
+	// a note planned for the past is measured from its due time
+	clock.Advance(30 * time.Millisecond)
+	s.Play(start, 1, 60, 100, 10*time.Millisecond)
+	s.Poll()
+	if got, want := out.take(), []string{"on 1 60 100", "off 1 60"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	st := s.Stats()
+	if st.Events != 2 || st.MaxLatency != 30*time.Millisecond || st.LastLatency != 20*time.Millisecond {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	_, out, s := newTest()
+
+	s.Play(start, 1, 60, 100, time.Second)
+	s.Play(start, 1, 64, 100, 2*time.Second)
+	s.Play(start, 10, 36, 100, time.Second)
+	out.take()
+
+	s.Flush()
+	got := out.take()
+	want := []string{"off 1 60", "off 1 64", "off 10 36"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if s.Pending() != 0 {
+		t.Errorf("Pending() = %d after Flush", s.Pending())
+	}
+	s.Poll()
+	if got := out.take(); len(got) != 0 {
+		t.Errorf("Poll after Flush: %v", got)
+	}
+}
+
+func TestStats(t *testing.T) {
+	clock, _, s := newTest()
+
+	// latencies 0, 4ms, 0, 4ms...
+	due := start
+	for i := 0; i < 32; i++ {
+		clock.Set(due.Add(time.Duration(i%2) * 4 * time.Millisecond))
+		s.Play(due, 1, 60, 100, time.Hour)
+		due = due.Add(10 * time.Millisecond)
+	}
+	st := s.Stats()
+	if st.Events != 32 {
+		t.Errorf("Events = %d, want 32", st.Events)
+	}
+	if st.MeanLatency != 2*time.Millisecond {
+		t.Errorf("MeanLatency = %v, want 2ms", st.MeanLatency)
+	}
+	if st.MaxLatency != 4*time.Millisecond {
+		t.Errorf("MaxLatency = %v, want 4ms", st.MaxLatency)
+	}
+	if st.LastLatency != 4*time.Millisecond {
+		t.Errorf("LastLatency = %v, want 4ms", st.LastLatency)
+	}
+	// the jitter approaches the 4ms difference between events
+	if st.Jitter < 3*time.Millisecond || st.Jitter > 4*time.Millisecond {
+		t.Errorf("Jitter = %v, want about 4ms", st.Jitter)
+	}
+
+	// early events count as on time
+	s.ResetStats()
+	clock.Set(due.Add(-time.Millisecond))
+	s.Play(due, 1, 62, 100, time.Hour)
+	if st := s.Stats(); st.Events != 1 || st.LastLatency != 0 || st.Jitter != 0 {
+		t.Errorf("early event: %+v", st)
+	}
+}
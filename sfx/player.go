@@ -0,0 +1,55 @@
+package sfx
+
+import "github.com/tinygo-keeb/workshop/jukebox"
+
+// Player plays effects through a jukebox.Player, interrupting the music that
+// is playing. Each effect is rendered once, the first time it is played.
+type Player struct {
+	jukebox *jukebox.Player
+	items   map[*Effect]*jukebox.Item
+	muted   bool
+}
+
+// NewPlayer returns a Player that plays on p.
+func NewPlayer(p *jukebox.Player) *Player {
+	return &Player{jukebox: p, items: map[*Effect]*jukebox.Item{}}
+}
+
+// Play plays e unless the effects are muted.
+func (p *Player) Play(e *Effect) {
+	if p.muted || e == nil {
+		return
+	}
+	p.jukebox.Play(p.Item(e))
+}
+
+// Item returns the jukebox item that plays e, to tell the events of effects
+// from those of songs.
+func (p *Player) Item(e *Effect) *jukebox.Item {
+	item, ok := p.items[e]
+	if !ok {
+		item = &jukebox.Item{Name: e.Name, Tones: e.Render(), Priority: jukebox.Effect}
+		p.items[e] = item
+	}
+	return item
+}
+
+// IsEffect reports whether item was played by p.
+func (p *Player) IsEffect(item *jukebox.Item) bool {
+	for _, it := range p.items {
+		if it == item {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMuted mutes or unmutes the effects. Music keeps playing.
+func (p *Player) SetMuted(muted bool) {
+	p.muted = muted
+}
+
+// Muted reports whether the effects are muted.
+func (p *Player) Muted() bool {
+	return p.muted
+}
@@ -0,0 +1,56 @@
+package sfx
+
+import "time"
+
+// Effects for user interfaces and games.
+var (
+	// KeyClick is a short tick for key presses.
+	KeyClick = &Effect{Name: "KeyClick", Wave: Square, Frequency: 3000, Slide: -4,
+		Sustain: 4 * time.Millisecond, Decay: 8 * time.Millisecond, Volume: 10}
+	// Blip is a light beep for moving through a menu.
+	Blip = &Effect{Name: "Blip", Wave: Square, Frequency: 1200,
+		Sustain: 20 * time.Millisecond, Decay: 20 * time.Millisecond, Volume: 12}
+	// Confirm is a rising pair of tones for choosing an item.
+	Confirm = &Effect{Name: "Confirm", Wave: Square, Frequency: 880,
+		JumpAt: 60 * time.Millisecond, Jump: 1.5,
+		Sustain: 120 * time.Millisecond, Decay: 80 * time.Millisecond, Volume: 15}
+	// Error is a low wobbling buzz for something that is not allowed.
+	Error = &Effect{Name: "Error", Wave: Square, Frequency: 200, Slide: -0.5,
+		Vibrato: 1, VibRate: 20,
+		Sustain: 200 * time.Millisecond, Decay: 100 * time.Millisecond, Volume: 15}
+	// Coin is the classic pickup sound.
+	Coin = &Effect{Name: "Coin", Wave: Square, Frequency: 988,
+		JumpAt: 60 * time.Millisecond, Jump: 4.0 / 3,
+		Sustain: 60 * time.Millisecond, Decay: 300 * time.Millisecond, Volume: 15}
+	// Explosion is a falling rumble of noise.
+	Explosion = &Effect{Name: "Explosion", Wave: Noise, Frequency: 300, Slide: -1.5,
+		Sustain: 50 * time.Millisecond, Decay: 600 * time.Millisecond, Volume: 15}
+	// Jump is a quick upward sweep.
+	Jump = &Effect{Name: "Jump", Wave: Square, Frequency: 300, Slide: 2,
+		Sustain: 100 * time.Millisecond, Decay: 100 * time.Millisecond, Volume: 13}
+	// Laser is a fast downward sweep.
+	Laser = &Effect{Name: "Laser", Wave: Square, Frequency: 1500, Slide: -3,
+		Sustain: 50 * time.Millisecond, Decay: 150 * time.Millisecond, Volume: 13}
+	// PowerUp is a rising warble.
+	PowerUp = &Effect{Name: "PowerUp", Wave: Square, Frequency: 400, Slide: 2,
+		Vibrato: 2, VibRate: 15,
+		Sustain: 300 * time.Millisecond, Decay: 150 * time.Millisecond, Volume: 14}
+	// Hit is a short burst of noise.
+	Hit = &Effect{Name: "Hit", Wave: Noise, Frequency: 800, Slide: -2,
+		Sustain: 20 * time.Millisecond, Decay: 100 * time.Millisecond, Volume: 15}
+)
+
+// Presets lists the predefined effects.
+var Presets = []*Effect{
+	KeyClick, Blip, Confirm, Error, Coin, Explosion, Jump, Laser, PowerUp, Hit,
+}
+
+// Find returns the preset named name or nil.
+func Find(name string) *Effect {
+	for _, e := range Presets {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Package sfx synthesizes sound effects for a buzzer, in the spirit of sfxr.
+//
+// An Effect is a handful of parameters: a square wave or noise, a start
+// frequency that can slide up or down, jump once or wobble with vibrato, and
+// a volume envelope. Render turns it into short jukebox.Tones of exact
+// periods, which a jukebox.Player plays like a song. Player plays effects
+// through a jukebox with a mute switch.
+package sfx
+
+import (
+	"math"
+	"time"
+
+	"github.com/tinygo-keeb/workshop/jukebox"
+)
+
+// Wave is the sound of an effect.
+type Wave int
+
+const (
+	Square Wave = iota // a plain tone
+	Noise              // a buzz of random pitches, for explosions and hits
+)
+
+// Step is the time resolution of rendered effects. Noise changes its pitch
+// every step.
+const Step = 4 * time.Millisecond
+
+// Lowest and highest frequencies that are rendered; a slide stops there.
+const (
+	MinFrequency = 40
+	MaxFrequency = 12000
+)
+
+// Effect is a parametric sound effect.
+type Effect struct {
+	Name      string
+	Wave      Wave
+	Frequency float64 // start frequency in Hz
+	Slide     float64 // change of frequency in octaves per second
+	JumpAt    time.Duration
+	Jump      float64 // frequency ratio applied at JumpAt, 0 for none
+	Vibrato   float64 // depth of the vibrato in semitones
+	VibRate   float64 // speed of the vibrato in Hz
+	Attack    time.Duration
+	Sustain   time.Duration // time at full volume
+	Decay     time.Duration // time to fade out
+	Volume    uint8         // 0 to 15, see the V command of mml
+}
+
+// Duration returns how long e sounds.
+func (e *Effect) Duration() time.Duration {
+	return e.Attack + e.Sustain + e.Decay
+}
+
+// noise is a linear congruential generator, so that an effect renders the
+// same every time.
+type noise uint32
+
+func (n *noise) next() float64 {
+	*n = *n*1664525 + 1013904223
+	return float64(*n>>8) / (1 << 24)
+}
+
+// Render returns the tones of the effect. Steps that sound the same are
+// merged.
+func (e *Effect) Render() []jukebox.Tone {
+	var tones []jukebox.Tone
+	rnd := noise(1)
+	total := e.Duration()
+	for t := time.Duration(0); t < total; t += Step {
+		tone := jukebox.Tone{Length: Step}
+		if v := e.volumeAt(t); v != 0 {
+			f := e.frequencyAt(t)
+			if e.Wave == Noise {
+				// jump around the frequency by up to an octave either way
+				f *= math.Pow(2, 2*rnd.next()-1)
+			}
+			f = math.Max(MinFrequency, math.Min(MaxFrequency, f))
+			tone.Period = uint64(1e9 / f)
+			tone.Volume = v
+		}
+		if last := len(tones) - 1; last >= 0 && same(tones[last], tone) {
+			tones[last].Length += Step
+		} else {
+			tones = append(tones, tone)
+		}
+	}
+	// the fade may end in silence
+	for n := len(tones); n > 0 && tones[n-1].Period == 0; n-- {
+		tones = tones[:n-1]
+	}
+	return tones
+}
+
+func same(a, b jukebox.Tone) bool {
+	return a.Period == b.Period && a.Volume == b.Volume
+}
+
+// frequencyAt returns the frequency t after the start, without noise.
+func (e *Effect) frequencyAt(t time.Duration) float64 {
+	s := t.Seconds()
+	f := e.Frequency * math.Pow(2, e.Slide*s)
+	if e.Jump != 0 && t >= e.JumpAt {
+		f *= e.Jump
+	}
+	if e.Vibrato != 0 && e.VibRate != 0 {
+		f *= math.Pow(2, e.Vibrato/12*math.Sin(2*math.Pi*e.VibRate*s))
+	}
+	return f
+}
+
+// volumeAt returns the volume t after the start.
+func (e *Effect) volumeAt(t time.Duration) uint8 {
+	level := 1.0
+	switch {
+	case t < e.Attack:
+		level = float64(t+Step) / float64(e.Attack+Step)
+	case t < e.Attack+e.Sustain:
+	case e.Decay > 0:
+		level = 1 - float64(t-e.Attack-e.Sustain)/float64(e.Decay)
+	}
+	return uint8(math.Round(float64(e.Volume) * level))
+}
@@ -0,0 +1,157 @@
+package smf
+
+import (
+	"sort"
+	"time"
+)
+
+// Player plays a Song without blocking. Call Update from the main loop; it
+// passes every event that is due to the handler.
+type Player struct {
+	song    *Song
+	next    int           // index of the next event
+	start   time.Time     // time at which the song position was zero
+	pos     time.Duration // position while paused
+	playing bool
+}
+
+// NewPlayer returns a paused player at the start of s.
+func NewPlayer(s *Song) *Player {
+	return &Player{song: s}
+}
+
+// Song returns the song being played.
+func (p *Player) Song() *Song {
+	return p.song
+}
+
+// Play starts or resumes playback.
+func (p *Player) Play(now time.Time) {
+	if p.playing {
+		return
+	}
+	if p.Done() {
+		p.next = 0
+		p.pos = 0
+	}
+	p.start = now.Add(-p.pos)
+	p.playing = true
+}
+
+// Pause stops playback and keeps the position. Notes that are sounding are
+// not stopped; the caller should silence its output.
+func (p *Player) Pause(now time.Time) {
+	if !p.playing {
+		return
+	}
+	p.pos = now.Sub(p.start)
+	p.playing = false
+}
+
+// Playing reports whether the player is running.
+func (p *Player) Playing() bool {
+	return p.playing
+}
+
+// Done reports whether all events have been played.
+func (p *Player) Done() bool {
+	return p.next >= len(p.song.Events)
+}
+
+// Position returns the current position in the song.
+func (p *Player) Position(now time.Time) time.Duration {
+	if !p.playing {
+		return p.pos
+	}
+	return now.Sub(p.start)
+}
+
+// Tick returns the current position in ticks.
+func (p *Player) Tick(now time.Time) uint32 {
+	return p.song.TimeTick(p.Position(now))
+}
+
+// Seek moves to tick. Channel messages other than notes before tick, such as
+// program changes and controllers, are passed to chase so that the output
+// sounds as if the song had been played from the start.
+func (p *Player) Seek(tick uint32, now time.Time, chase func(Event)) {
+	events := p.song.Events
+	p.next = sort.Search(len(events), func(i int) bool { return events[i].Tick >= tick })
+	if chase != nil {
+		for _, e := range events[:p.next] {
+			if e.IsChannel() && e.Kind() != 0x80 && e.Kind() != 0x90 && e.Kind() != 0xA0 {
+				chase(e)
+			}
+		}
+	}
+	p.pos = p.song.TickTime(tick)
+	p.start = now.Add(-p.pos)
+}
+
+// Update passes the events that are due at now to handle and stops at the
+// end of the song.
+func (p *Player) Update(now time.Time, handle func(Event)) {
+	if !p.playing {
+		return
+	}
+	pos := now.Sub(p.start)
+	for p.next < len(p.song.Events) {
+		e := p.song.Events[p.next]
+		if p.song.TickTime(e.Tick) > pos {
+			return
+		}
+		p.next++
+		handle(e)
+	}
+	p.pos = pos
+	p.playing = false
+}
+
+// Mono reduces the notes of a song to a single line for a buzzer. The
+// highest held note sounds.
+type Mono struct {
+	// Channel is the 1-origin channel to follow, 0 means every channel
+	// except the drum channel 10.
+	Channel uint8
+
+	held [4]uint32 // one bit per note
+	note uint8     // sounding note, 0 when silent
+}
+
+// Handle updates the held notes with e and reports the note to play, or 0 for
+// silence, when it changes.
+func (m *Mono) Handle(e Event) (note uint8, changed bool) {
+	if !e.IsNoteOn() && !e.IsNoteOff() {
+		return m.note, false
+	}
+	if m.Channel == 0 && e.Channel() == 10 || m.Channel != 0 && e.Channel() != m.Channel {
+		return m.note, false
+	}
+	n := e.Data1 & 0x7F
+	if e.IsNoteOn() {
+		m.held[n/32] |= 1 << (n % 32)
+	} else {
+		m.held[n/32] &^= 1 << (n % 32)
+	}
+
+	note = 0
+	for i := 127; i > 0; i-- {
+		if m.held[i/32]&(1<<(i%32)) != 0 {
+			note = uint8(i)
+			break
+		}
+	}
+	changed = note != m.note
+	m.note = note
+	return note, changed
+}
+
+// Note returns the sounding note, or 0 when silent.
+func (m *Mono) Note() uint8 {
+	return m.note
+}
+
+// Reset releases all notes.
+func (m *Mono) Reset() {
+	*m = Mono{Channel: m.Channel}
+}
@@ -0,0 +1,265 @@
+// Package smf reads Standard MIDI Files (format 0 and 1) and plays them
+// back against a tempo map.
+//
+// Parse keeps meta and SysEx payloads as sub-slices of the input so that a
+// file embedded with go:embed is not copied.
+package smf
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Status bytes that are not channel messages.
+const (
+	StatusSysEx       = 0xF0
+	StatusSysExEscape = 0xF7
+	StatusMeta        = 0xFF
+)
+
+// Meta event types.
+const (
+	MetaText          = 0x01
+	MetaCopyright     = 0x02
+	MetaTrackName     = 0x03
+	MetaInstrument    = 0x04
+	MetaLyric         = 0x05
+	MetaMarker        = 0x06
+	MetaEndOfTrack    = 0x2F
+	MetaTempo         = 0x51
+	MetaTimeSignature = 0x58
+	MetaKeySignature  = 0x59
+)
+
+// DefaultTempo is the tempo in microseconds per quarter note until the first
+// tempo event (120 bpm).
+const DefaultTempo = 500000
+
+// Event is a MIDI, SysEx or meta event.
+type Event struct {
+	Tick   uint32 // absolute time in ticks
+	Track  int
+	Status byte // channel message status, StatusSysEx, StatusSysExEscape or StatusMeta
+	Data1  byte // first data byte, or the meta type
+	Data2  byte
+	Data   []byte // meta or SysEx payload
+}
+
+// IsMeta reports whether e is a meta event of type typ.
+func (e Event) IsMeta(typ byte) bool {
+	return e.Status == StatusMeta && e.Data1 == typ
+}
+
+// IsChannel reports whether e is a channel message.
+func (e Event) IsChannel() bool {
+	return e.Status >= 0x80 && e.Status < 0xF0
+}
+
+// Kind returns the upper nibble of a channel message status, e.g. 0x90 for
+// Note On.
+func (e Event) Kind() byte {
+	return e.Status & 0xF0
+}
+
+// Channel returns the 1-origin channel of a channel message.
+func (e Event) Channel() uint8 {
+	return e.Status&0x0F + 1
+}
+
+// IsNoteOn reports whether e is a Note On with non-zero velocity.
+func (e Event) IsNoteOn() bool {
+	return e.Kind() == 0x90 && e.Data2 > 0
+}
+
+// IsNoteOff reports whether e is a Note Off or a Note On with velocity 0.
+func (e Event) IsNoteOff() bool {
+	return e.Kind() == 0x80 || (e.Kind() == 0x90 && e.Data2 == 0)
+}
+
+// Tempo returns the microseconds per quarter note of a tempo meta event.
+// A tempo of 0, which only a broken file has, is not a tempo.
+func (e Event) Tempo() (uint32, bool) {
+	if !e.IsMeta(MetaTempo) || len(e.Data) != 3 {
+		return 0, false
+	}
+	t := uint32(e.Data[0])<<16 | uint32(e.Data[1])<<8 | uint32(e.Data[2])
+	return t, t > 0
+}
+
+// File is a parsed Standard MIDI File.
+type File struct {
+	Format   int
+	Division int // ticks per quarter note
+	Tracks   [][]Event
+}
+
+// Parse reads a format 0 or 1 file. SMPTE time division and format 2 are
+// not supported.
+func Parse(data []byte) (*File, error) {
+	r := reader{data: data}
+	id, chunk, err := r.chunk()
+	if err != nil {
+		return nil, err
+	}
+	if id != "MThd" || len(chunk) < 6 {
+		return nil, errors.New("smf: not a MIDI file")
+	}
+	f := &File{
+		Format:   int(chunk[0])<<8 | int(chunk[1]),
+		Division: int(chunk[4])<<8 | int(chunk[5]),
+	}
+	tracks := int(chunk[2])<<8 | int(chunk[3])
+	switch {
+	case f.Format > 1:
+		return nil, errors.New("smf: format " + strconv.Itoa(f.Format) + " is not supported")
+	case f.Division&0x8000 != 0:
+		return nil, errors.New("smf: SMPTE time division is not supported")
+	case f.Division == 0:
+		return nil, errors.New("smf: zero time division")
+	}
+
+	for len(f.Tracks) < tracks {
+		id, chunk, err := r.chunk()
+		if err != nil {
+			return nil, err
+		}
+		if id != "MTrk" {
+			continue // unknown chunks must be skipped
+		}
+		events, err := parseTrack(chunk, len(f.Tracks))
+		if err != nil {
+			return nil, errors.New("smf: track " + strconv.Itoa(len(f.Tracks)) + ": " + err.Error())
+		}
+		f.Tracks = append(f.Tracks, events)
+	}
+	return f, nil
+}
+
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) chunk() (string, []byte, error) {
+	if len(r.data)-r.pos < 8 {
+		return "", nil, errors.New("smf: unexpected end of file")
+	}
+	d := r.data[r.pos:]
+	n := int(d[4])<<24 | int(d[5])<<16 | int(d[6])<<8 | int(d[7])
+	if n < 0 || n > len(d)-8 {
+		return "", nil, errors.New("smf: chunk too long")
+	}
+	r.pos += 8 + n
+	return string(d[:4]), d[8 : 8+n], nil
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errors.New("unexpected end of track")
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+// varint reads a variable-length quantity.
+func (r *reader) varint() (uint32, error) {
+	var v uint32
+	for i := 0; i < 4; i++ {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<7 | uint32(b&0x7F)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("variable-length quantity too long")
+}
+
+func (r *reader) bytes(n uint32) ([]byte, error) {
+	if uint32(len(r.data)-r.pos) < n {
+		return nil, errors.New("unexpected end of track")
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func parseTrack(data []byte, track int) ([]Event, error) {
+	r := reader{data: data}
+	var (
+		events  []Event
+		tick    uint32
+		running byte
+	)
+	for r.pos < len(r.data) {
+		delta, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		tick += delta
+		e := Event{Tick: tick, Track: track}
+
+		b, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if b < 0x80 {
+			// running status: b is the first data byte
+			if running == 0 {
+				return nil, errors.New("data byte without status")
+			}
+			e.Status = running
+			r.pos--
+		} else {
+			e.Status = b
+		}
+
+		switch {
+		case e.Status == StatusMeta:
+			if e.Data1, err = r.byte(); err != nil {
+				return nil, err
+			}
+			fallthrough
+		case e.Status == StatusSysEx || e.Status == StatusSysExEscape:
+			n, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			if e.Data, err = r.bytes(n); err != nil {
+				return nil, err
+			}
+			running = 0
+		case e.Status >= 0xF0:
+			return nil, errors.New("unexpected status 0x" + strconv.FormatUint(uint64(e.Status), 16))
+		default:
+			running = e.Status
+			if e.Data1, err = r.byte(); err != nil {
+				return nil, err
+			}
+			if k := e.Kind(); k != 0xC0 && k != 0xD0 {
+				if e.Data2, err = r.byte(); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		events = append(events, e)
+		if e.IsMeta(MetaEndOfTrack) {
+			break
+		}
+	}
+	return events, nil
+}
+
+// TrackName returns the name of track i, or "" if it has none.
+func (f *File) TrackName(i int) string {
+	for _, e := range f.Tracks[i] {
+		if e.IsMeta(MetaTrackName) {
+			return string(e.Data)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package smf
+
+import (
+	"sort"
+	"time"
+)
+
+// Song is the tracks of a file merged into one time-ordered list, with a
+// tempo map to convert between ticks and time.
+type Song struct {
+	Name     string // name of the first track
+	Division int
+	Events   []Event // all tracks, ordered by tick and then by track
+	tempos   []tempoChange
+	meters   []meterChange
+	end      uint32 // tick of the last event
+}
+
+type tempoChange struct {
+	tick  uint32
+	at    time.Duration // time of tick
+	tempo uint32        // microseconds per quarter note
+}
+
+type meterChange struct {
+	tick  uint32
+	bar   int // 0-origin bar starting at tick
+	beats int // beats per bar
+	beat  int // ticks per beat
+}
+
+// Song merges the tracks of f.
+func (f *File) Song() *Song {
+	s := &Song{Division: f.Division}
+	if len(f.Tracks) > 0 {
+		s.Name = f.TrackName(0)
+	}
+	for _, t := range f.Tracks {
+		s.Events = append(s.Events, t...)
+	}
+	sort.SliceStable(s.Events, func(i, j int) bool {
+		return s.Events[i].Tick < s.Events[j].Tick
+	})
+
+	s.tempos = []tempoChange{{tempo: DefaultTempo}}
+	s.meters = []meterChange{{beats: 4, beat: f.Division}}
+	for _, e := range s.Events {
+		if e.Tick > s.end {
+			s.end = e.Tick
+		}
+		if e.IsMeta(MetaTimeSignature) && len(e.Data) >= 2 && e.Data[0] > 0 {
+			s.addMeter(e.Tick, int(e.Data[0]), f.Division*4>>e.Data[1])
+		}
+		tempo, ok := e.Tempo()
+		if !ok {
+			continue
+		}
+		last := &s.tempos[len(s.tempos)-1]
+		if last.tick == e.Tick {
+			last.tempo = tempo
+			continue
+		}
+		s.tempos = append(s.tempos, tempoChange{tick: e.Tick, at: s.TickTime(e.Tick), tempo: tempo})
+	}
+	return s
+}
+
+// tempoAt returns the tempo change in effect at tick.
+func (s *Song) tempoAt(tick uint32) tempoChange {
+	i := sort.Search(len(s.tempos), func(i int) bool { return s.tempos[i].tick > tick })
+	return s.tempos[i-1]
+}
+
+// TickTime returns the time of tick from the start of the song.
+func (s *Song) TickTime(tick uint32) time.Duration {
+	t := s.tempoAt(tick)
+	return t.at + time.Duration(uint64(tick-t.tick)*uint64(t.tempo)/uint64(s.Division))*time.Microsecond
+}
+
+// TimeTick returns the last tick at or before d.
+func (s *Song) TimeTick(d time.Duration) uint32 {
+	if d <= 0 {
+		return 0
+	}
+	i := sort.Search(len(s.tempos), func(i int) bool { return s.tempos[i].at > d })
+	t := s.tempos[i-1]
+	return t.tick + uint32(uint64((d-t.at)/time.Microsecond)*uint64(s.Division)/uint64(t.tempo))
+}
+
+// Tempo returns the tempo in beats per minute at tick.
+func (s *Song) Tempo(tick uint32) int {
+	t := s.tempoAt(tick).tempo
+	return int((60000000 + t/2) / t)
+}
+
+// Duration returns the time of the last event.
+func (s *Song) Duration() time.Duration {
+	return s.TickTime(s.end)
+}
+
+func (s *Song) addMeter(tick uint32, beats, beat int) {
+	if beat <= 0 {
+		beat = s.Division
+	}
+	last := &s.meters[len(s.meters)-1]
+	if last.tick == tick {
+		last.beats, last.beat = beats, beat
+		return
+	}
+	// a time signature takes effect at the start of a bar
+	bar, _ := s.BarBeat(tick)
+	s.meters = append(s.meters, meterChange{tick: tick, bar: bar, beats: beats, beat: beat})
+}
+
+// BarBeat returns the 0-origin bar and beat at tick according to the time
+// signatures. Files without one are in 4/4.
+func (s *Song) BarBeat(tick uint32) (bar, beat int) {
+	i := sort.Search(len(s.meters), func(i int) bool { return s.meters[i].tick > tick })
+	m := s.meters[i-1]
+	beats := int(tick-m.tick) / m.beat
+	return m.bar + beats/m.beats, beats % m.beats
+}
+
+// BarTick returns the tick at which the 0-origin bar starts.
+func (s *Song) BarTick(bar int) uint32 {
+	if bar < 0 {
+		return 0
+	}
+	i := sort.Search(len(s.meters), func(i int) bool { return s.meters[i].bar > bar })
+	m := s.meters[i-1]
+	return m.tick + uint32((bar-m.bar)*m.beats*m.beat)
+}
@@ -0,0 +1,61 @@
+package synth
+
+import "time"
+
+// MaxLevel is the loudest level of an envelope, the same as that of
+// jukebox.Speaker.
+const MaxLevel = 255
+
+// ADSR is a volume envelope. A note rises to MaxLevel in Attack, falls to
+// Sustain in Decay, stays there while the key is held and fades out in
+// Release after the key is released.
+type ADSR struct {
+	Attack  time.Duration
+	Decay   time.Duration
+	Sustain uint8 // 0 to MaxLevel
+	Release time.Duration
+}
+
+// Envelopes for the sounds of a small keyboard.
+var (
+	Organ = ADSR{Attack: 5 * time.Millisecond, Sustain: MaxLevel, Release: 20 * time.Millisecond}
+	Piano = ADSR{Attack: 5 * time.Millisecond, Decay: 1200 * time.Millisecond, Sustain: 0, Release: 150 * time.Millisecond}
+	Pluck = ADSR{Attack: 2 * time.Millisecond, Decay: 250 * time.Millisecond, Sustain: 0, Release: 60 * time.Millisecond}
+	Pad   = ADSR{Attack: 400 * time.Millisecond, Decay: 300 * time.Millisecond, Sustain: 180, Release: 600 * time.Millisecond}
+	Bell  = ADSR{Attack: 2 * time.Millisecond, Decay: 2500 * time.Millisecond, Sustain: 0, Release: 800 * time.Millisecond}
+)
+
+// Presets lists the predefined envelopes with names short enough for the
+// OLED.
+var Presets = []struct {
+	Name     string
+	Envelope ADSR
+}{
+	{"Organ", Organ},
+	{"Piano", Piano},
+	{"Pluck", Pluck},
+	{"Pad", Pad},
+	{"Bell", Bell},
+}
+
+// Level returns the level a time held after the key was pressed.
+func (e ADSR) Level(held time.Duration) uint8 {
+	if held < e.Attack {
+		return uint8(int64(MaxLevel) * int64(held) / int64(e.Attack))
+	}
+	held -= e.Attack
+	if held < e.Decay {
+		fall := int64(MaxLevel - int(e.Sustain))
+		return uint8(MaxLevel - fall*int64(held)/int64(e.Decay))
+	}
+	return e.Sustain
+}
+
+// Released returns the level a time after the key was released at level
+// from, and whether the note has faded out.
+func (e ADSR) Released(from uint8, since time.Duration) (uint8, bool) {
+	if since >= e.Release {
+		return 0, true
+	}
+	return uint8(int64(from) * int64(e.Release-since) / int64(e.Release)), false
+}
@@ -0,0 +1,235 @@
+// Package synth plays chords on a single piezo buzzer.
+//
+// A buzzer driven by PWM sounds one square wave at a time. Synth emulates up
+// to MaxVoices voices by fast arpeggiation: the voices that are sounding
+// take turns every Slot, quickly enough that the ear hears a chord. Each
+// voice has an ADSR envelope that is applied through the duty cycle of the
+// PWM, so notes can swell and fade instead of just switching on and off.
+//
+// Synth does not block. Call Update from the main loop at least every
+// millisecond or so.
+package synth
+
+import (
+	"time"
+
+	"github.com/tinygo-keeb/workshop/pitch"
+)
+
+// MaxVoices is the largest number of notes that sound at once.
+const MaxVoices = 4
+
+// DefaultSlot is how long each voice sounds in turn. Shorter slots sound more
+// like a chord but the pitch of a buzzer needs a few periods to settle.
+const DefaultSlot = 12 * time.Millisecond
+
+// Output is a buzzer whose pitch and loudness can be set, such as
+// jukebox.Speaker.
+type Output interface {
+	// SetPeriod sets the period of the square wave in nanoseconds.
+	SetPeriod(period uint64)
+	// SetLevel sets the loudness from 0 (silent) to MaxLevel.
+	SetLevel(level uint8)
+}
+
+type voice struct {
+	note     uint8
+	velocity uint8
+	on       time.Time // when the key was pressed
+	off      time.Time // when the key was released
+	from     uint8     // level when the key was released
+	released bool
+	active   bool
+	level    uint8 // level at the last Update
+}
+
+// Synth is a polyphonic synthesizer on one Output.
+type Synth struct {
+	Envelope ADSR
+	Tuning   pitch.Tuning
+	Slot     time.Duration
+
+	out    Output
+	voices []voice
+	turn   int       // voice sounding
+	next   time.Time // when the next voice takes its turn
+	period uint64    // period set on out
+	level  uint8     // level set on out
+}
+
+// New returns a Synth with the given number of voices (1 to MaxVoices) on
+// out with the Organ envelope.
+func New(out Output, voices int) *Synth {
+	if voices < 1 {
+		voices = 1
+	}
+	if voices > MaxVoices {
+		voices = MaxVoices
+	}
+	return &Synth{
+		Envelope: Organ,
+		Tuning:   pitch.Standard,
+		Slot:     DefaultSlot,
+		out:      out,
+		voices:   make([]voice, voices),
+	}
+}
+
+// NoteOn starts note with velocity (1 to 127) at now. If all the voices are
+// in use the one that has been sounding the longest, preferring released
+// ones, is taken over.
+func (s *Synth) NoteOn(note, velocity uint8, now time.Time) {
+	if velocity == 0 {
+		s.NoteOff(note, now)
+		return
+	}
+	if velocity > 127 {
+		velocity = 127
+	}
+	i := s.find(note)
+	if i < 0 {
+		i = s.steal()
+	}
+	s.voices[i] = voice{note: note, velocity: velocity, on: now, active: true}
+}
+
+// NoteOff releases note at now. The note fades out over the release time of
+// the envelope.
+func (s *Synth) NoteOff(note uint8, now time.Time) {
+	for i := range s.voices {
+		v := &s.voices[i]
+		if v.active && !v.released && v.note == note {
+			v.from = s.Envelope.Level(now.Sub(v.on))
+			v.off = now
+			v.released = true
+		}
+	}
+}
+
+// AllOff releases every note at now.
+func (s *Synth) AllOff(now time.Time) {
+	for i := range s.voices {
+		v := &s.voices[i]
+		if v.active && !v.released {
+			s.NoteOff(v.note, now)
+		}
+	}
+}
+
+// Silence stops every note at once.
+func (s *Synth) Silence() {
+	for i := range s.voices {
+		s.voices[i] = voice{}
+	}
+	s.set(s.period, 0)
+}
+
+// Active returns the number of notes sounding, including ones that are
+// fading out.
+func (s *Synth) Active() int {
+	n := 0
+	for _, v := range s.voices {
+		if v.active {
+			n++
+		}
+	}
+	return n
+}
+
+// find returns the voice playing note or -1.
+func (s *Synth) find(note uint8) int {
+	for i, v := range s.voices {
+		if v.active && v.note == note {
+			return i
+		}
+	}
+	return -1
+}
+
+// steal returns a free voice or the one to take over.
+func (s *Synth) steal() int {
+	best := -1
+	for i, v := range s.voices {
+		if !v.active {
+			return i
+		}
+		if best < 0 {
+			best = i
+			continue
+		}
+		b := s.voices[best]
+		switch {
+		case v.released && !b.released:
+			best = i
+		case v.released == b.released && v.on.Before(b.on):
+			best = i
+		}
+	}
+	return best
+}
+
+// Update advances the envelopes and gives the next voice its turn when the
+// slot of the sounding one has passed.
+func (s *Synth) Update(now time.Time) {
+	n := 0
+	for i := range s.voices {
+		v := &s.voices[i]
+		if !v.active {
+			continue
+		}
+		var level uint8
+		if v.released {
+			var done bool
+			level, done = s.Envelope.Released(v.from, now.Sub(v.off))
+			if done {
+				*v = voice{}
+				continue
+			}
+		} else {
+			held := now.Sub(v.on)
+			if s.Envelope.Sustain == 0 && held >= s.Envelope.Attack+s.Envelope.Decay {
+				// decayed to silence, free the voice for the others
+				*v = voice{}
+				continue
+			}
+			level = s.Envelope.Level(held)
+		}
+		v.level = uint8(int(level) * int(v.velocity) / 127)
+		n++
+	}
+	if n == 0 {
+		s.set(s.period, 0)
+		return
+	}
+
+	if !s.voices[s.turn].active || !now.Before(s.next) {
+		s.turn = s.following(s.turn)
+		s.next = now.Add(s.Slot)
+	}
+	v := s.voices[s.turn]
+	s.set(s.Tuning.Period(pitch.Note(v.note)), v.level)
+}
+
+// following returns the active voice after voice i.
+func (s *Synth) following(i int) int {
+	for range s.voices {
+		i = (i + 1) % len(s.voices)
+		if s.voices[i].active {
+			return i
+		}
+	}
+	return i
+}
+
+// set changes the output only when needed, as setting the period restarts
+// the square wave.
+func (s *Synth) set(period uint64, level uint8) {
+	if period != s.period && level > 0 {
+		s.out.SetPeriod(period)
+		s.period = period
+	}
+	if level != s.level {
+		s.out.SetLevel(level)
+		s.level = level
+	}
+}
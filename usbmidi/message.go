@@ -0,0 +1,272 @@
+package usbmidi
+
+// Type is the kind of a decoded message.
+type Type uint8
+
+const (
+	Invalid Type = iota
+	NoteOffMsg
+	NoteOnMsg
+	PolyPressureMsg
+	ControlChangeMsg
+	ProgramChangeMsg
+	ChannelPressureMsg
+	PitchBendMsg
+	MTCQuarterFrameMsg
+	SongPositionMsg
+	SongSelectMsg
+	TuneRequestMsg
+	TimingClockMsg
+	StartMsg
+	ContinueMsg
+	StopMsg
+	ActiveSensingMsg
+	SystemResetMsg
+	SysExMsg
+)
+
+var typeNames = [...]string{
+	Invalid:            "Invalid",
+	NoteOffMsg:         "NoteOff",
+	NoteOnMsg:          "NoteOn",
+	PolyPressureMsg:    "PolyPressure",
+	ControlChangeMsg:   "ControlChange",
+	ProgramChangeMsg:   "ProgramChange",
+	ChannelPressureMsg: "ChannelPressure",
+	PitchBendMsg:       "PitchBend",
+	MTCQuarterFrameMsg: "MTCQuarterFrame",
+	SongPositionMsg:    "SongPosition",
+	SongSelectMsg:      "SongSelect",
+	TuneRequestMsg:     "TuneRequest",
+	TimingClockMsg:     "TimingClock",
+	StartMsg:           "Start",
+	ContinueMsg:        "Continue",
+	StopMsg:            "Stop",
+	ActiveSensingMsg:   "ActiveSensing",
+	SystemResetMsg:     "SystemReset",
+	SysExMsg:           "SysEx",
+}
+
+func (t Type) String() string {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return "Invalid"
+}
+
+// Message is a decoded MIDI message.
+type Message struct {
+	Type    Type
+	Cable   uint8
+	Channel uint8 // 1-16 for channel messages, 0 otherwise
+	Data1   uint8
+	Data2   uint8
+	SysEx   []byte // complete SysEx message without 0xF0 / 0xF7, only valid until the next Feed
+}
+
+// Note returns the note number of NoteOn / NoteOff / PolyPressure.
+func (m Message) Note() uint8 { return m.Data1 }
+
+// Velocity returns the velocity of NoteOn / NoteOff.
+func (m Message) Velocity() uint8 { return m.Data2 }
+
+// Controller returns the controller number of ControlChange.
+func (m Message) Controller() uint8 { return m.Data1 }
+
+// Value returns the value of ControlChange, ProgramChange, ChannelPressure,
+// PolyPressure, SongSelect and MTCQuarterFrame.
+func (m Message) Value() uint8 {
+	switch m.Type {
+	case ControlChangeMsg, PolyPressureMsg:
+		return m.Data2
+	}
+	return m.Data1
+}
+
+// Bend returns the pitch bend value (0-0x3FFF).
+func (m Message) Bend() uint16 { return uint16(m.Data1) | uint16(m.Data2)<<7 }
+
+// SongPosition returns the Song Position Pointer in MIDI beats.
+func (m Message) SongPosition() uint16 { return uint16(m.Data1) | uint16(m.Data2)<<7 }
+
+// IsNoteOn reports whether m starts a note. NoteOn with velocity 0 is a
+// NoteOff.
+func (m Message) IsNoteOn() bool { return m.Type == NoteOnMsg && m.Data2 > 0 }
+
+// IsNoteOff reports whether m ends a note.
+func (m Message) IsNoteOff() bool {
+	return m.Type == NoteOffMsg || (m.Type == NoteOnMsg && m.Data2 == 0)
+}
+
+// Packet encodes m back into a packet. SysEx messages need AppendSysEx.
+func (m Message) Packet() Packet {
+	switch m.Type {
+	case NoteOffMsg:
+		return NoteOff(m.Cable, m.Channel, m.Data1, m.Data2)
+	case NoteOnMsg:
+		return NoteOn(m.Cable, m.Channel, m.Data1, m.Data2)
+	case PolyPressureMsg:
+		return PolyPressure(m.Cable, m.Channel, m.Data1, m.Data2)
+	case ControlChangeMsg:
+		return ControlChange(m.Cable, m.Channel, m.Data1, m.Data2)
+	case ProgramChangeMsg:
+		return ProgramChange(m.Cable, m.Channel, m.Data1)
+	case ChannelPressureMsg:
+		return ChannelPressure(m.Cable, m.Channel, m.Data1)
+	case PitchBendMsg:
+		return PitchBend(m.Cable, m.Channel, m.Bend())
+	case MTCQuarterFrameMsg:
+		return MTCQuarterFrame(m.Cable, m.Data1)
+	case SongPositionMsg:
+		return SongPosition(m.Cable, m.SongPosition())
+	case SongSelectMsg:
+		return SongSelect(m.Cable, m.Data1)
+	case TuneRequestMsg:
+		return TuneRequest(m.Cable)
+	case TimingClockMsg:
+		return TimingClock(m.Cable)
+	case StartMsg:
+		return Start(m.Cable)
+	case ContinueMsg:
+		return Continue(m.Cable)
+	case StopMsg:
+		return Stop(m.Cable)
+	case ActiveSensingMsg:
+		return Realtime(m.Cable, StatusActiveSensing)
+	case SystemResetMsg:
+		return Realtime(m.Cable, StatusSystemReset)
+	}
+	return Packet{}
+}
+
+// Decode decodes a single packet that is not part of a SysEx message.
+func Decode(p Packet) (Message, bool) {
+	m := Message{Cable: p.Cable(), Data1: p[2] & 0x7F, Data2: p[3] & 0x7F}
+	status := p[1]
+
+	switch p.CIN() {
+	case CINNoteOff, CINNoteOn, CINPolyPressure, CINControlChange,
+		CINProgramChange, CINChannelPressure, CINPitchBend:
+		// the CIN is the upper nibble of the status byte
+		if status>>4 != p.CIN() {
+			return Message{}, false
+		}
+		m.Type = NoteOffMsg + Type(status>>4-0x8)
+		m.Channel = status&0x0F + 1
+		if m.Type == ProgramChangeMsg || m.Type == ChannelPressureMsg {
+			m.Data2 = 0
+		}
+		return m, true
+	}
+
+	switch status {
+	case StatusMTCQuarter:
+		m.Type = MTCQuarterFrameMsg
+		m.Data2 = 0
+	case StatusSongPosition:
+		m.Type = SongPositionMsg
+	case StatusSongSelect:
+		m.Type = SongSelectMsg
+		m.Data2 = 0
+	case StatusTuneRequest:
+		m.Type = TuneRequestMsg
+	case StatusTimingClock:
+		m.Type = TimingClockMsg
+	case StatusStart:
+		m.Type = StartMsg
+	case StatusContinue:
+		m.Type = ContinueMsg
+	case StatusStop:
+		m.Type = StopMsg
+	case StatusActiveSensing:
+		m.Type = ActiveSensingMsg
+	case StatusSystemReset:
+		m.Type = SystemResetMsg
+	default:
+		return Message{}, false
+	}
+	if m.Type != SongPositionMsg && m.Type != MTCQuarterFrameMsg && m.Type != SongSelectMsg {
+		m.Data1, m.Data2 = 0, 0
+	}
+	return m, true
+}
+
+// Parser decodes a stream of packets and reassembles SysEx messages that
+// span several packets.
+type Parser struct {
+	// MaxSysEx limits the size of a reassembled SysEx message. Longer
+	// messages are dropped. 0 means 128 bytes.
+	MaxSysEx int
+
+	sysex    []byte
+	inSysEx  bool
+	overflow bool
+}
+
+// Feed decodes b, which holds one or more 4 byte packets as received by
+// midi.Port().SetRxHandler, and calls handle for every complete message.
+// Empty (all zero) padding packets are skipped.
+func (ps *Parser) Feed(b []byte, handle func(m Message)) {
+	for len(b) >= 4 {
+		var p Packet
+		copy(p[:], b[:4])
+		b = b[4:]
+		ps.FeedPacket(p, handle)
+	}
+}
+
+// FeedPacket decodes a single packet.
+func (ps *Parser) FeedPacket(p Packet, handle func(m Message)) {
+	cin := p.CIN()
+	switch {
+	case cin == CINSysExStart:
+		ps.appendSysEx(p[1:4])
+		return
+	case cin >= CINSysExEnd1 && cin <= CINSysExEnd3:
+		n := int(cin-CINSysExEnd1) + 1
+		if cin == CINSysExEnd1 && p[1] != StatusSysExEnd && !ps.inSysEx {
+			// single byte system common message (Tune Request)
+			break
+		}
+		ps.appendSysEx(p[1 : 1+n])
+		if ps.inSysEx && !ps.overflow {
+			handle(Message{Type: SysExMsg, Cable: p.Cable(), SysEx: ps.sysex})
+		}
+		ps.sysex = ps.sysex[:0]
+		ps.inSysEx = false
+		ps.overflow = false
+		return
+	case cin == CINMisc || cin == CINCableEvent:
+		return
+	}
+
+	if m, ok := Decode(p); ok {
+		handle(m)
+	}
+}
+
+func (ps *Parser) appendSysEx(b []byte) {
+	max := ps.MaxSysEx
+	if max == 0 {
+		max = 128
+	}
+	if ps.sysex == nil {
+		ps.sysex = make([]byte, 0, max)
+	}
+	for _, c := range b {
+		switch c {
+		case StatusSysExStart:
+			ps.sysex = ps.sysex[:0]
+			ps.inSysEx = true
+			ps.overflow = false
+			continue
+		case StatusSysExEnd:
+			continue
+		}
+		if len(ps.sysex) >= max {
+			ps.overflow = true
+			continue
+		}
+		ps.sysex = append(ps.sysex, c)
+	}
+}
@@ -0,0 +1,226 @@
+// Package usbmidi encodes and decodes USB-MIDI 1.0 event packets.
+//
+// Every MIDI message is carried in a 4 byte packet. The first byte holds the
+// cable number (upper nibble) and the Code Index Number (CIN, lower nibble),
+// which tells the receiver how many of the following 3 bytes are used.
+//
+// Channels are 1-origin (1-16) like machine/usb/adc/midi. The encoders
+// return a Packet that can be sent with midi.Port().Write:
+//
+//	pkt := usbmidi.ProgramChange(cable, channel, patch)
+//	m.Write(pkt[:])
+package usbmidi
+
+// Code Index Numbers (USB-MIDI 1.0, table 4-1).
+const (
+	CINMisc            = 0x0
+	CINCableEvent      = 0x1
+	CINSystemCommon2   = 0x2 // two byte system common message (MTC, Song Select)
+	CINSystemCommon3   = 0x3 // three byte system common message (SPP)
+	CINSysExStart      = 0x4 // SysEx starts or continues
+	CINSysExEnd1       = 0x5 // SysEx ends with one byte, or single byte system common
+	CINSysExEnd2       = 0x6 // SysEx ends with two bytes
+	CINSysExEnd3       = 0x7 // SysEx ends with three bytes
+	CINNoteOff         = 0x8
+	CINNoteOn          = 0x9
+	CINPolyPressure    = 0xA
+	CINControlChange   = 0xB
+	CINProgramChange   = 0xC
+	CINChannelPressure = 0xD
+	CINPitchBend       = 0xE
+	CINSingleByte      = 0xF // system realtime or a single unparsed byte
+)
+
+// Status bytes.
+const (
+	StatusNoteOff         = 0x80
+	StatusNoteOn          = 0x90
+	StatusPolyPressure    = 0xA0
+	StatusControlChange   = 0xB0
+	StatusProgramChange   = 0xC0
+	StatusChannelPressure = 0xD0
+	StatusPitchBend       = 0xE0
+
+	StatusSysExStart    = 0xF0
+	StatusMTCQuarter    = 0xF1
+	StatusSongPosition  = 0xF2
+	StatusSongSelect    = 0xF3
+	StatusTuneRequest   = 0xF6
+	StatusSysExEnd      = 0xF7
+	StatusTimingClock   = 0xF8
+	StatusStart         = 0xFA
+	StatusContinue      = 0xFB
+	StatusStop          = 0xFC
+	StatusActiveSensing = 0xFE
+	StatusSystemReset   = 0xFF
+)
+
+// PitchBendCenter is the pitch bend value of a centred wheel.
+const PitchBendCenter = 0x2000
+
+// Packet is one USB-MIDI event packet.
+type Packet [4]byte
+
+// Cable returns the virtual cable number.
+func (p Packet) Cable() uint8 {
+	return p[0] >> 4
+}
+
+// CIN returns the Code Index Number.
+func (p Packet) CIN() uint8 {
+	return p[0] & 0x0F
+}
+
+// Len returns the number of MIDI bytes carried by the packet.
+func (p Packet) Len() int {
+	switch p.CIN() {
+	case CINSystemCommon2, CINSysExEnd2, CINProgramChange, CINChannelPressure:
+		return 2
+	case CINSysExEnd1, CINSingleByte:
+		return 1
+	case CINMisc, CINCableEvent:
+		return 0
+	}
+	return 3
+}
+
+func header(cable, cin uint8) byte {
+	return (cable&0x0F)<<4 | cin
+}
+
+func channelMessage(cable, cin, status, channel, d1, d2 uint8) Packet {
+	return Packet{header(cable, cin), status | ((channel - 1) & 0x0F), d1 & 0x7F, d2 & 0x7F}
+}
+
+// ChannelMessage returns the packet of a channel message given as raw status
+// and data bytes, such as one read from a Standard MIDI File.
+func ChannelMessage(cable, status, d1, d2 uint8) Packet {
+	p := Packet{header(cable, status>>4), status, d1 & 0x7F, d2 & 0x7F}
+	if p.Len() < 3 {
+		p[3] = 0
+	}
+	return p
+}
+
+// NoteOff returns a Note Off packet.
+func NoteOff(cable, channel, note, velocity uint8) Packet {
+	return channelMessage(cable, CINNoteOff, StatusNoteOff, channel, note, velocity)
+}
+
+// NoteOn returns a Note On packet. A velocity of 0 means Note Off.
+func NoteOn(cable, channel, note, velocity uint8) Packet {
+	return channelMessage(cable, CINNoteOn, StatusNoteOn, channel, note, velocity)
+}
+
+// PolyPressure returns a Polyphonic Key Pressure packet.
+func PolyPressure(cable, channel, note, pressure uint8) Packet {
+	return channelMessage(cable, CINPolyPressure, StatusPolyPressure, channel, note, pressure)
+}
+
+// ControlChange returns a Control Change packet.
+func ControlChange(cable, channel, control, value uint8) Packet {
+	return channelMessage(cable, CINControlChange, StatusControlChange, channel, control, value)
+}
+
+// ProgramChange returns a Program Change packet. Unlike the 3 byte packet
+// sent by midi.Port().ProgramChange(), the unused last byte is zero which
+// works with every host we tried.
+func ProgramChange(cable, channel, program uint8) Packet {
+	return channelMessage(cable, CINProgramChange, StatusProgramChange, channel, program, 0)
+}
+
+// ChannelPressure returns a Channel Pressure (aftertouch) packet.
+func ChannelPressure(cable, channel, pressure uint8) Packet {
+	return channelMessage(cable, CINChannelPressure, StatusChannelPressure, channel, pressure, 0)
+}
+
+// PitchBend returns a Pitch Bend packet. bend is 0-0x3FFF with
+// PitchBendCenter meaning no bend.
+func PitchBend(cable, channel uint8, bend uint16) Packet {
+	return channelMessage(cable, CINPitchBend, StatusPitchBend, channel, uint8(bend&0x7F), uint8(bend>>7))
+}
+
+// MTCQuarterFrame returns a MIDI Time Code Quarter Frame packet.
+func MTCQuarterFrame(cable, value uint8) Packet {
+	return Packet{header(cable, CINSystemCommon2), StatusMTCQuarter, value & 0x7F, 0}
+}
+
+// SongPosition returns a Song Position Pointer packet. position counts
+// MIDI beats (sixteenth notes, 6 timing clocks) from the start of the song.
+func SongPosition(cable uint8, position uint16) Packet {
+	return Packet{header(cable, CINSystemCommon3), StatusSongPosition, uint8(position & 0x7F), uint8(position>>7) & 0x7F}
+}
+
+// SongSelect returns a Song Select packet.
+func SongSelect(cable, song uint8) Packet {
+	return Packet{header(cable, CINSystemCommon2), StatusSongSelect, song & 0x7F, 0}
+}
+
+// TuneRequest returns a Tune Request packet.
+func TuneRequest(cable uint8) Packet {
+	return Packet{header(cable, CINSysExEnd1), StatusTuneRequest, 0, 0}
+}
+
+// Realtime returns a system realtime packet such as StatusTimingClock or
+// StatusStart.
+func Realtime(cable, status uint8) Packet {
+	return Packet{header(cable, CINSingleByte), status, 0, 0}
+}
+
+// TimingClock returns a Timing Clock packet (24 per quarter note).
+func TimingClock(cable uint8) Packet { return Realtime(cable, StatusTimingClock) }
+
+// Start returns a Start packet.
+func Start(cable uint8) Packet { return Realtime(cable, StatusStart) }
+
+// Continue returns a Continue packet.
+func Continue(cable uint8) Packet { return Realtime(cable, StatusContinue) }
+
+// Stop returns a Stop packet.
+func Stop(cable uint8) Packet { return Realtime(cable, StatusStop) }
+
+// AppendSysEx splits a System Exclusive message into packets and appends
+// them to dst. msg may include the leading 0xF0 and trailing 0xF7; they are
+// added when missing.
+func AppendSysEx(dst []Packet, cable uint8, msg []byte) []Packet {
+	if len(msg) > 0 && msg[0] == StatusSysExStart {
+		msg = msg[1:]
+	}
+	if len(msg) > 0 && msg[len(msg)-1] == StatusSysExEnd {
+		msg = msg[:len(msg)-1]
+	}
+
+	// full stream including start and end bytes
+	n := len(msg) + 2
+	at := func(i int) byte {
+		switch i {
+		case 0:
+			return StatusSysExStart
+		case n - 1:
+			return StatusSysExEnd
+		}
+		return msg[i-1] & 0x7F
+	}
+
+	for i := 0; i < n; i += 3 {
+		rest := n - i
+		var p Packet
+		switch {
+		case rest > 3:
+			p = Packet{header(cable, CINSysExStart), at(i), at(i + 1), at(i + 2)}
+		case rest == 3:
+			p = Packet{header(cable, CINSysExEnd3), at(i), at(i + 1), at(i + 2)}
+		case rest == 2:
+			p = Packet{header(cable, CINSysExEnd2), at(i), at(i + 1), 0}
+		default:
+			p = Packet{header(cable, CINSysExEnd1), at(i), 0, 0}
+		}
+		dst = append(dst, p)
+	}
+	return dst
+}
+
+// SysEx is like AppendSysEx but returns a new slice.
+func SysEx(cable uint8, msg []byte) []Packet {
+	return AppendSysEx(nil, cable, msg)
+}
@@ -0,0 +1,272 @@
+package usbmidi
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Packet
+		want Packet
+	}{
+		{"NoteOff", NoteOff(0, 1, 60, 64), Packet{0x08, 0x80, 60, 64}},
+		{"NoteOn", NoteOn(0, 1, 60, 100), Packet{0x09, 0x90, 60, 100}},
+		{"NoteOn ch16", NoteOn(0, 16, 60, 100), Packet{0x09, 0x9F, 60, 100}},
+		{"NoteOn cable 1", NoteOn(1, 10, 36, 127), Packet{0x19, 0x99, 36, 127}},
+		{"NoteOn masks data", NoteOn(0, 1, 0xBC, 0xFF), Packet{0x09, 0x90, 0x3C, 0x7F}},
+		{"PolyPressure", PolyPressure(0, 2, 60, 10), Packet{0x0A, 0xA1, 60, 10}},
+		{"ControlChange", ControlChange(0, 1, 7, 100), Packet{0x0B, 0xB0, 7, 100}},
+		{"ProgramChange", ProgramChange(0, 3, 5), Packet{0x0C, 0xC2, 5, 0}},
+		{"ChannelPressure", ChannelPressure(0, 1, 80), Packet{0x0D, 0xD0, 80, 0}},
+		{"PitchBend center", PitchBend(0, 1, PitchBendCenter), Packet{0x0E, 0xE0, 0x00, 0x40}},
+		{"PitchBend max", PitchBend(0, 1, 0x3FFF), Packet{0x0E, 0xE0, 0x7F, 0x7F}},
+		{"MTCQuarterFrame", MTCQuarterFrame(0, 0x25), Packet{0x02, 0xF1, 0x25, 0}},
+		{"SongPosition", SongPosition(0, 0x1234), Packet{0x03, 0xF2, 0x34, 0x24}},
+		{"SongSelect", SongSelect(0, 3), Packet{0x02, 0xF3, 3, 0}},
+		{"TuneRequest", TuneRequest(0), Packet{0x05, 0xF6, 0, 0}},
+		{"TimingClock", TimingClock(0), Packet{0x0F, 0xF8, 0, 0}},
+		{"Start", Start(0), Packet{0x0F, 0xFA, 0, 0}},
+		{"Continue", Continue(0), Packet{0x0F, 0xFB, 0, 0}},
+		{"Stop", Stop(0), Packet{0x0F, 0xFC, 0, 0}},
+		{"ActiveSensing", Realtime(0, StatusActiveSensing), Packet{0x0F, 0xFE, 0, 0}},
+		{"SystemReset", Realtime(2, StatusSystemReset), Packet{0x2F, 0xFF, 0, 0}},
+		{"ChannelMessage 3 bytes", ChannelMessage(0, 0x93, 60, 100), Packet{0x09, 0x93, 60, 100}},
+		{"ChannelMessage 2 bytes", ChannelMessage(0, 0xC0, 5, 99), Packet{0x0C, 0xC0, 5, 0}},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got % X, want % X", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLen(t *testing.T) {
+	tests := []struct {
+		p    Packet
+		want int
+	}{
+		{NoteOn(0, 1, 60, 100), 3},
+		{ProgramChange(0, 1, 0), 2},
+		{ChannelPressure(0, 1, 0), 2},
+		{PitchBend(0, 1, 0), 3},
+		{MTCQuarterFrame(0, 0), 2},
+		{SongPosition(0, 0), 3},
+		{TuneRequest(0), 1},
+		{TimingClock(0), 1},
+		{Packet{}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Len(); got != tt.want {
+			t.Errorf("% X: Len() = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestAppendSysEx(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  []byte
+		want []Packet
+	}{
+		{"empty", nil, []Packet{
+			{0x06, 0xF0, 0xF7, 0},
+		}},
+		{"1 byte", []byte{0x01}, []Packet{
+			{0x07, 0xF0, 0x01, 0xF7},
+		}},
+		{"2 bytes", []byte{0x01, 0x02}, []Packet{
+			{0x04, 0xF0, 0x01, 0x02},
+			{0x05, 0xF7, 0, 0},
+		}},
+		{"3 bytes", []byte{0x01, 0x02, 0x03}, []Packet{
+			{0x04, 0xF0, 0x01, 0x02},
+			{0x06, 0x03, 0xF7, 0},
+		}},
+		{"4 bytes", []byte{0x01, 0x02, 0x03, 0x04}, []Packet{
+			{0x04, 0xF0, 0x01, 0x02},
+			{0x07, 0x03, 0x04, 0xF7},
+		}},
+		{"7 bytes", []byte{1, 2, 3, 4, 5, 6, 7}, []Packet{
+			{0x04, 0xF0, 1, 2},
+			{0x04, 3, 4, 5},
+			{0x07, 6, 7, 0xF7},
+		}},
+		{"with F0 and F7", []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}, []Packet{
+			{0x04, 0xF0, 0x7E, 0x7F},
+			{0x07, 0x06, 0x01, 0xF7},
+		}},
+		{"masks data", []byte{0x81}, []Packet{
+			{0x07, 0xF0, 0x01, 0xF7},
+		}},
+	}
+	for _, tt := range tests {
+		got := AppendSysEx(nil, 0, tt.msg)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d packets % X, want %d", tt.name, len(got), got, len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: packet %d = % X, want % X", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+
+	if got := SysEx(3, []byte{0x01}); got[0][0] != 0x37 {
+		t.Errorf("cable 3: header %02X, want 37", got[0][0])
+	}
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	msgs := []Message{
+		{Type: NoteOffMsg, Channel: 1, Data1: 60, Data2: 64},
+		{Type: NoteOnMsg, Channel: 16, Data1: 127, Data2: 1},
+		{Type: NoteOnMsg, Cable: 1, Channel: 10, Data1: 36, Data2: 0},
+		{Type: PolyPressureMsg, Channel: 2, Data1: 60, Data2: 10},
+		{Type: ControlChangeMsg, Channel: 1, Data1: 7, Data2: 100},
+		{Type: ProgramChangeMsg, Channel: 3, Data1: 5},
+		{Type: ChannelPressureMsg, Channel: 4, Data1: 80},
+		{Type: PitchBendMsg, Channel: 1, Data1: 0x00, Data2: 0x40},
+		{Type: MTCQuarterFrameMsg, Data1: 0x25},
+		{Type: SongPositionMsg, Data1: 0x34, Data2: 0x24},
+		{Type: SongSelectMsg, Data1: 3},
+		{Type: TuneRequestMsg},
+		{Type: TimingClockMsg},
+		{Type: StartMsg},
+		{Type: ContinueMsg},
+		{Type: StopMsg},
+		{Type: ActiveSensingMsg},
+		{Type: SystemResetMsg, Cable: 15},
+	}
+	for _, want := range msgs {
+		got, ok := Decode(want.Packet())
+		if !ok {
+			t.Errorf("%v: not decoded from % X", want.Type, want.Packet())
+			continue
+		}
+		if got.Type != want.Type || got.Cable != want.Cable || got.Channel != want.Channel ||
+			got.Data1 != want.Data1 || got.Data2 != want.Data2 {
+			t.Errorf("%v: got %+v, want %+v", want.Type, got, want)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, p := range []Packet{
+		{0x09, 0x80, 60, 64}, // CIN does not match the status byte
+		{0x0F, 0xF9, 0, 0},   // undefined realtime byte
+		{0x02, 0xF4, 0, 0},   // undefined system common byte
+	} {
+		if m, ok := Decode(p); ok {
+			t.Errorf("% X: decoded as %+v", p, m)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	m, _ := Decode(NoteOn(0, 1, 60, 0))
+	if m.IsNoteOn() || !m.IsNoteOff() {
+		t.Errorf("NoteOn with velocity 0 is not a NoteOff")
+	}
+	m, _ = Decode(PitchBend(0, 1, 0x1234))
+	if m.Bend() != 0x1234 {
+		t.Errorf("Bend() = %04X, want 1234", m.Bend())
+	}
+	m, _ = Decode(SongPosition(0, 0x0ABC))
+	if m.SongPosition() != 0x0ABC {
+		t.Errorf("SongPosition() = %04X, want 0ABC", m.SongPosition())
+	}
+	m, _ = Decode(ControlChange(0, 1, 7, 100))
+	if m.Controller() != 7 || m.Value() != 100 {
+		t.Errorf("ControlChange: Controller() = %d, Value() = %d", m.Controller(), m.Value())
+	}
+}
+
+// feed returns the messages that ps decodes from packets.
+func feed(ps *Parser, packets ...Packet) []Message {
+	var b []byte
+	for _, p := range packets {
+		b = append(b, p[:]...)
+	}
+	var msgs []Message
+	ps.Feed(b, func(m Message) {
+		if m.SysEx != nil {
+			m.SysEx = append([]byte(nil), m.SysEx...)
+		}
+		msgs = append(msgs, m)
+	})
+	return msgs
+}
+
+func TestParserSysEx(t *testing.T) {
+	for n := 0; n <= 10; n++ {
+		msg := make([]byte, n)
+		for i := range msg {
+			msg[i] = byte(i + 1)
+		}
+		var ps Parser
+		got := feed(&ps, SysEx(0, msg)...)
+		if len(got) != 1 || got[0].Type != SysExMsg || !bytes.Equal(got[0].SysEx, msg) {
+			t.Errorf("%d bytes: got %+v", n, got)
+		}
+	}
+}
+
+func TestParserTuneRequest(t *testing.T) {
+	// CIN 5 is a single byte system common message outside of SysEx...
+	var ps Parser
+	got := feed(&ps, TuneRequest(0))
+	if len(got) != 1 || got[0].Type != TuneRequestMsg {
+		t.Errorf("Tune Request: got %+v", got)
+	}
+
+	// ...and the end of a SysEx message inside it
+	got = feed(&ps, Packet{0x04, 0xF0, 0x01, 0x02}, Packet{0x05, 0xF7, 0, 0})
+	if len(got) != 1 || got[0].Type != SysExMsg || !bytes.Equal(got[0].SysEx, []byte{0x01, 0x02}) {
+		t.Errorf("SysEx end: got %+v", got)
+	}
+}
+
+func TestParserRealtimeInSysEx(t *testing.T) {
+	var ps Parser
+	got := feed(&ps,
+		Packet{0x04, 0xF0, 0x01, 0x02},
+		TimingClock(0),
+		Packet{0x04, 0x03, 0x04, 0x05},
+		Start(0),
+		Packet{0x06, 0x06, 0xF7, 0},
+	)
+	want := []Type{TimingClockMsg, StartMsg, SysExMsg}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want types %v", got, want)
+	}
+	for i, m := range got {
+		if m.Type != want[i] {
+			t.Errorf("message %d: %v, want %v", i, m.Type, want[i])
+		}
+	}
+	if !bytes.Equal(got[2].SysEx, []byte{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("SysEx = % X", got[2].SysEx)
+	}
+}
+
+func TestParserOverflow(t *testing.T) {
+	ps := Parser{MaxSysEx: 4}
+	if got := feed(&ps, SysEx(0, []byte{1, 2, 3, 4, 5})...); len(got) != 0 {
+		t.Errorf("long SysEx: got %+v", got)
+	}
+	// the next message is not affected
+	if got := feed(&ps, SysEx(0, []byte{1, 2})...); len(got) != 1 || !bytes.Equal(got[0].SysEx, []byte{1, 2}) {
+		t.Errorf("after overflow: got %+v", got)
+	}
+}
+
+func TestParserSkipsPadding(t *testing.T) {
+	var ps Parser
+	got := feed(&ps, Packet{}, NoteOn(0, 1, 60, 100), Packet{})
+	if len(got) != 1 || got[0].Type != NoteOnMsg {
+		t.Errorf("got %+v", got)
+	}
+}